@@ -0,0 +1,354 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// elasticPageSize is how many documents are requested per page by default
+const elasticPageSize = 1000
+
+func init() {
+	RegisterSource("elasticsearch", func(cfg SourceConfig) (CaptureSource, error) {
+		return NewElasticSource(cfg, false)
+	})
+	RegisterSource("opensearch", func(cfg SourceConfig) (CaptureSource, error) {
+		return NewElasticSource(cfg, true)
+	})
+}
+
+// ElasticOptions are the Elasticsearch and OpenSearch parts of a capture
+type ElasticOptions struct {
+	// Index is the index pattern to search, e.g. "logs-*"
+	Index string `json:"index"`
+	// TimeField is the field the time range applies to and events are sorted by
+	TimeField string `json:"timeField"`
+	// Query is a query DSL clause. When empty the capture's search string is
+	// used instead, either as query DSL JSON or as a KQL-ish string.
+	Query      json.RawMessage `json:"query"`
+	PageSize   int             `json:"pageSize"`
+	MaxResults int             `json:"maxResults"`
+	// DisablePIT pages with search_after alone, for users who can't open a
+	// point in time. Tiebreaker should then name a unique sortable field.
+	DisablePIT bool   `json:"disablePIT"`
+	KeepAlive  string `json:"keepAlive"`
+	Tiebreaker string `json:"tiebreaker"`
+	// AuthScheme is "ApiKey" (the default) or "Bearer" for the token, or
+	// "Basic" for Username and Password
+	AuthScheme         string `json:"authScheme"`
+	Username           string `json:"username"`
+	Password           string `json:"password"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+}
+
+// ElasticSource captures from an Elasticsearch or OpenSearch cluster, paging
+// with search_after over a point in time
+type ElasticSource struct {
+	BaseURL    string
+	Token      string
+	OpenSearch bool
+	Options    ElasticOptions
+	Client     *http.Client
+}
+
+// NewElasticSource creates an Elasticsearch or OpenSearch source; URL is the
+// cluster's base URL
+func NewElasticSource(cfg SourceConfig, openSearch bool) (CaptureSource, error) {
+	opts := ElasticOptions{TimeField: "@timestamp", PageSize: elasticPageSize, KeepAlive: "1m", AuthScheme: "ApiKey"}
+	if openSearch {
+		// OpenSearch has no implicit _shard_doc tiebreaker
+		opts.Tiebreaker = "_id"
+	}
+	if err := decodeOptions(cfg.Options, &opts); err != nil {
+		return nil, err
+	}
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("missing cluster URL")
+	}
+	if opts.Index == "" {
+		return nil, fmt.Errorf("missing index pattern")
+	}
+	if opts.PageSize <= 0 {
+		opts.PageSize = elasticPageSize
+	}
+
+	client := &http.Client{}
+	if opts.InsecureSkipVerify {
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	return &ElasticSource{
+		BaseURL:    strings.TrimSuffix(cfg.URL, "/"),
+		Token:      cfg.Token,
+		OpenSearch: openSearch,
+		Options:    opts,
+		Client:     client,
+	}, nil
+}
+
+// kqlKeyword matches the lowercase boolean operators KQL allows
+var kqlKeyword = regexp.MustCompile(`(?i)^(and|or|not)$`)
+
+// kqlToLucene turns a KQL-ish string into query_string syntax. Field
+// matches are the same in both; only the boolean operators must be upper case.
+func kqlToLucene(search string) string {
+	var out strings.Builder
+	inQuote := false
+	word := strings.Builder{}
+	flush := func() {
+		w := word.String()
+		if kqlKeyword.MatchString(w) {
+			w = strings.ToUpper(w)
+		}
+		out.WriteString(w)
+		word.Reset()
+	}
+	for _, r := range search {
+		switch {
+		case r == '"':
+			flush()
+			inQuote = !inQuote
+			out.WriteRune(r)
+		case inQuote:
+			out.WriteRune(r)
+		case r == ' ' || r == '(' || r == ')':
+			flush()
+			out.WriteRune(r)
+		default:
+			word.WriteRune(r)
+		}
+	}
+	flush()
+	return out.String()
+}
+
+// query builds the bool query: the search clause filtered to the time range
+func (e *ElasticSource) query(q Query) (map[string]interface{}, error) {
+	var clause interface{} = map[string]interface{}{"match_all": map[string]interface{}{}}
+	search := strings.TrimSpace(q.Search)
+	switch {
+	case len(e.Options.Query) > 0:
+		clause = e.Options.Query
+	case strings.HasPrefix(search, "{"):
+		var dsl map[string]interface{}
+		if err := json.Unmarshal([]byte(search), &dsl); err != nil {
+			return nil, fmt.Errorf("invalid query DSL: %v", err)
+		}
+		if inner, ok := dsl["query"]; ok {
+			clause = inner
+		} else {
+			clause = dsl
+		}
+	case search != "":
+		clause = map[string]interface{}{"query_string": map[string]interface{}{"query": kqlToLucene(search)}}
+	}
+
+	timeRange := map[string]interface{}{"format": "epoch_millis"}
+	if q.StartTime > 0 {
+		timeRange["gte"] = q.StartTime
+	}
+	if q.EndTime > 0 {
+		timeRange["lte"] = q.EndTime
+	}
+	filter := []interface{}{map[string]interface{}{"range": map[string]interface{}{e.Options.TimeField: timeRange}}}
+	for _, f := range q.Include {
+		filter = append(filter, elasticFilter(f))
+	}
+	mustNot := []interface{}{}
+	for _, f := range q.Exclude {
+		mustNot = append(mustNot, elasticFilter(f))
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"must":     []interface{}{clause},
+			"filter":   filter,
+			"must_not": mustNot,
+		},
+	}, nil
+}
+
+// do sends a request and decodes the JSON response
+func (e *ElasticSource) do(ctx context.Context, method, path string, payload interface{}) (map[string]interface{}, error) {
+	var body io.Reader
+	if payload != nil {
+		payloadBytes, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal payload: %w", err)
+		}
+		body = bytes.NewReader(payloadBytes)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, e.BaseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	switch {
+	case e.Options.AuthScheme == "Basic":
+		req.SetBasicAuth(e.Options.Username, e.Options.Password)
+	case e.Token != "":
+		req.Header.Set("Authorization", e.Options.AuthScheme+" "+e.Token)
+	}
+
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if len(respBody) > 1024 {
+			respBody = respBody[:1024]
+		}
+		return nil, fmt.Errorf("API request failed: HTTP %d - %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	var jsonResponse map[string]interface{}
+	if err := json.Unmarshal(respBody, &jsonResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return jsonResponse, nil
+}
+
+// openPIT opens a point in time over the index pattern
+func (e *ElasticSource) openPIT(ctx context.Context) (string, error) {
+	index := url.PathEscape(e.Options.Index)
+	keepAlive := url.QueryEscape(e.Options.KeepAlive)
+	if e.OpenSearch {
+		resp, err := e.do(ctx, http.MethodPost, "/"+index+"/_search/point_in_time?keep_alive="+keepAlive, nil)
+		if err != nil {
+			return "", err
+		}
+		id, _ := resp["pit_id"].(string)
+		return id, nil
+	}
+	resp, err := e.do(ctx, http.MethodPost, "/"+index+"/_pit?keep_alive="+keepAlive, nil)
+	if err != nil {
+		return "", err
+	}
+	id, _ := resp["id"].(string)
+	return id, nil
+}
+
+// closePIT releases a point in time. It runs even when the capture was
+// cancelled, so it doesn't use the capture's context.
+func (e *ElasticSource) closePIT(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var err error
+	if e.OpenSearch {
+		_, err = e.do(ctx, http.MethodDelete, "/_search/point_in_time", map[string]interface{}{"pit_id": []string{id}})
+	} else {
+		_, err = e.do(ctx, http.MethodDelete, "/_pit", map[string]interface{}{"id": id})
+	}
+	if err != nil {
+		fmt.Printf("⚠️ Failed to close point in time: %v\n", err)
+	}
+}
+
+// Fetch pages through every document the query matches in time order
+func (e *ElasticSource) Fetch(ctx context.Context, q Query, summary *Summary, report func(JobProgress)) ([]interface{}, error) {
+	query, err := e.query(q)
+	if err != nil {
+		return nil, err
+	}
+	sort := []interface{}{map[string]interface{}{e.Options.TimeField: map[string]interface{}{"order": "asc", "format": "epoch_millis"}}}
+	if e.Options.Tiebreaker != "" {
+		sort = append(sort, map[string]interface{}{e.Options.Tiebreaker: "asc"})
+	}
+
+	path := "/" + url.PathEscape(e.Options.Index) + "/_search"
+	pitID := ""
+	if !e.Options.DisablePIT {
+		if pitID, err = e.openPIT(ctx); err != nil {
+			return nil, fmt.Errorf("failed to open point in time: %w", err)
+		}
+		defer func() { e.closePIT(pitID) }()
+		path = "/_search"
+	} else if e.Options.Tiebreaker == "" {
+		summary.Warnings = append(summary.Warnings, "paging without a point in time or tiebreaker may skip documents with identical timestamps")
+	}
+
+	summary.Windows = 1
+	hits := []interface{}{}
+	var searchAfter interface{}
+	for {
+		payload := map[string]interface{}{
+			"size":             e.Options.PageSize,
+			"query":            query,
+			"sort":             sort,
+			"track_total_hits": summary.Pages == 0,
+		}
+		if pitID != "" {
+			payload["pit"] = map[string]interface{}{"id": pitID, "keep_alive": e.Options.KeepAlive}
+		}
+		if searchAfter != nil {
+			payload["search_after"] = searchAfter
+		}
+
+		resp, err := e.do(ctx, http.MethodPost, path, payload)
+		if err != nil {
+			return nil, err
+		}
+		if summary.Pages == 0 {
+			summary.Reported = searchTotal(resp)
+		}
+		summary.Pages++
+		if id, ok := resp["pit_id"].(string); ok && id != "" {
+			pitID = id
+		}
+
+		page := searchHits(resp)
+		hits = append(hits, page...)
+		if report != nil {
+			report(JobProgress{Pages: summary.Pages, Captured: len(hits), Reported: summary.Reported})
+		}
+		if e.Options.MaxResults > 0 && len(hits) >= e.Options.MaxResults {
+			hits = hits[:e.Options.MaxResults]
+			summary.Truncated = true
+			summary.Warnings = append(summary.Warnings, fmt.Sprintf("stopped at the %d result limit", e.Options.MaxResults))
+			break
+		}
+		if len(page) < e.Options.PageSize {
+			break
+		}
+		last, _ := page[len(page)-1].(map[string]interface{})
+		if searchAfter = last["sort"]; searchAfter == nil {
+			return nil, fmt.Errorf("search response has no sort values to page from")
+		}
+	}
+	return hits, nil
+}
+
+// Normalize returns a hit's _source, with @timestamp taken from the sort
+// value so any TimeField format is understood
+func (e *ElasticSource) Normalize(hit interface{}) (map[string]interface{}, bool) {
+	hitMap, ok := hit.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	source, ok := hitMap["_source"].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	if sort, ok := hitMap["sort"].([]interface{}); ok && len(sort) > 0 {
+		if ms, ok := EventTime(sort[0]); ok {
+			source["@timestamp"] = float64(ms)
+			return source, true
+		}
+	}
+	if value, ok := source[e.Options.TimeField]; ok {
+		source["@timestamp"] = value
+	}
+	return source, true
+}
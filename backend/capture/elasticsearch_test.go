@@ -0,0 +1,321 @@
+package capture
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testCluster is a fake Elasticsearch or OpenSearch cluster that pages a
+// fixed set of documents, sorted by time then _id, with search_after
+type testCluster struct {
+	t          *testing.T
+	openSearch bool
+	docs       []map[string]interface{}
+
+	mu       sync.Mutex
+	calls    []string
+	auth     []string
+	searches []map[string]interface{}
+	pits     map[string]bool
+	nextPIT  int
+}
+
+func newTestCluster(t *testing.T, openSearch bool, n int) (*testCluster, *httptest.Server) {
+	c := &testCluster{t: t, openSearch: openSearch, pits: map[string]bool{}}
+	for i := 0; i < n; i++ {
+		// Pairs of documents share a timestamp, so paging needs the tiebreaker
+		c.docs = append(c.docs, map[string]interface{}{"_id": fmt.Sprintf("doc-%03d", i), "ts": float64(1700000000000 + i/2)})
+	}
+	server := httptest.NewServer(c)
+	t.Cleanup(server.Close)
+	return c, server
+}
+
+// newPIT opens a point in time; each search moves it to a new ID, as the
+// real APIs may
+func (c *testCluster) newPIT() string {
+	c.nextPIT++
+	id := fmt.Sprintf("pit-%d", c.nextPIT)
+	c.pits[id] = true
+	return id
+}
+
+func (c *testCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, r.Method+" "+r.URL.RequestURI())
+	c.auth = append(c.auth, r.Header.Get("Authorization"))
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	reply := func(v interface{}) { json.NewEncoder(w).Encode(v) }
+	switch {
+	case !c.openSearch && r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/_pit"):
+		reply(map[string]interface{}{"id": c.newPIT()})
+	case c.openSearch && r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/_search/point_in_time"):
+		reply(map[string]interface{}{"pit_id": c.newPIT()})
+	case r.Method == http.MethodDelete:
+		var ids []interface{}
+		if c.openSearch {
+			ids, _ = body["pit_id"].([]interface{})
+		} else {
+			ids = []interface{}{body["id"]}
+		}
+		for _, id := range ids {
+			if !c.pits[fmt.Sprint(id)] {
+				http.Error(w, "no such point in time", http.StatusNotFound)
+				return
+			}
+			delete(c.pits, fmt.Sprint(id))
+		}
+		reply(map[string]interface{}{"succeeded": true})
+	case strings.HasSuffix(r.URL.Path, "/_search"):
+		c.searches = append(c.searches, body)
+		if pit, ok := body["pit"].(map[string]interface{}); ok {
+			id := fmt.Sprint(pit["id"])
+			if !c.pits[id] {
+				http.Error(w, "no such point in time", http.StatusNotFound)
+				return
+			}
+			delete(c.pits, id)
+		}
+		size := int(body["size"].(float64))
+		var after []interface{}
+		if a, ok := body["search_after"].([]interface{}); ok {
+			after = a
+		}
+		hits := []interface{}{}
+		for _, doc := range c.docs {
+			if after != nil && (doc["ts"].(float64) < after[0].(float64) ||
+				doc["ts"].(float64) == after[0].(float64) && doc["_id"].(string) <= after[1].(string)) {
+				continue
+			}
+			if len(hits) == size {
+				break
+			}
+			hits = append(hits, map[string]interface{}{
+				"_id":     doc["_id"],
+				"_source": map[string]interface{}{"message": doc["_id"], "ts": doc["ts"]},
+				"sort":    []interface{}{doc["ts"], doc["_id"]},
+			})
+		}
+		resp := map[string]interface{}{"hits": map[string]interface{}{"total": map[string]interface{}{"value": len(c.docs)}, "hits": hits}}
+		if _, ok := body["pit"]; ok {
+			resp["pit_id"] = c.newPIT()
+		}
+		reply(resp)
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func newTestElastic(t *testing.T, server *httptest.Server, openSearch bool, opts string) CaptureSource {
+	source, err := NewElasticSource(SourceConfig{URL: server.URL, Token: "key", Options: []byte(opts)}, openSearch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return source
+}
+
+func TestElasticFetchPagesWithPIT(t *testing.T) {
+	for _, openSearch := range []bool{false, true} {
+		cluster, server := newTestCluster(t, openSearch, 25)
+		source := newTestElastic(t, server, openSearch, `{"index": "logs-*", "timeField": "ts", "pageSize": 10, "tiebreaker": "_id"}`)
+
+		summary := &Summary{}
+		hits, err := source.Fetch(context.Background(), Query{StartTime: 1, EndTime: 2}, summary, nil)
+		if err != nil {
+			t.Fatalf("openSearch=%v: %v", openSearch, err)
+		}
+		if len(hits) != 25 || summary.Pages != 3 || summary.Reported != 25 {
+			t.Errorf("openSearch=%v: got %d hits in %d pages, reported %d", openSearch, len(hits), summary.Pages, summary.Reported)
+		}
+		seen := map[string]bool{}
+		for _, hit := range hits {
+			id := hit.(map[string]interface{})["_id"].(string)
+			if seen[id] {
+				t.Errorf("openSearch=%v: %s captured twice", openSearch, id)
+			}
+			seen[id] = true
+		}
+
+		openPath := "POST /logs-%2A/_pit?keep_alive=1m"
+		if openSearch {
+			openPath = "POST /logs-%2A/_search/point_in_time?keep_alive=1m"
+		}
+		if cluster.calls[0] != openPath {
+			t.Errorf("openSearch=%v: opened the PIT with %s", openSearch, cluster.calls[0])
+		}
+		if last := cluster.calls[len(cluster.calls)-1]; !strings.HasPrefix(last, "DELETE ") {
+			t.Errorf("openSearch=%v: last call %s, want the PIT closed", openSearch, last)
+		}
+		if len(cluster.pits) != 0 {
+			t.Errorf("openSearch=%v: points in time left open: %v", openSearch, cluster.pits)
+		}
+		for i, search := range cluster.searches {
+			if (search["search_after"] != nil) != (i > 0) {
+				t.Errorf("openSearch=%v: search %d search_after = %v", openSearch, i, search["search_after"])
+			}
+			if search["track_total_hits"] != (i == 0) {
+				t.Errorf("openSearch=%v: search %d track_total_hits = %v", openSearch, i, search["track_total_hits"])
+			}
+		}
+		for _, auth := range cluster.auth {
+			if auth != "ApiKey key" {
+				t.Errorf("openSearch=%v: Authorization = %q", openSearch, auth)
+			}
+		}
+
+		event, ok := source.Normalize(hits[0])
+		if !ok || event["@timestamp"] != float64(1700000000000) {
+			t.Errorf("openSearch=%v: Normalize() = %v", openSearch, event)
+		}
+	}
+}
+
+func TestElasticFetchWithoutPIT(t *testing.T) {
+	cluster, server := newTestCluster(t, false, 7)
+	source := newTestElastic(t, server, false, `{"index": "logs", "timeField": "ts", "pageSize": 3, "disablePIT": true, "maxResults": 5}`)
+
+	summary := &Summary{}
+	if _, err := source.Fetch(context.Background(), Query{}, summary, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Warnings) == 0 || !strings.Contains(summary.Warnings[0], "tiebreaker") {
+		t.Errorf("warnings = %v, want one about the missing tiebreaker", summary.Warnings)
+	}
+	cluster.calls = nil
+
+	source = newTestElastic(t, server, false, `{"index": "logs", "timeField": "ts", "pageSize": 3, "disablePIT": true, "tiebreaker": "_id", "maxResults": 5}`)
+	summary = &Summary{}
+	hits, err := source.Fetch(context.Background(), Query{}, summary, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 5 || !summary.Truncated {
+		t.Errorf("got %d hits, truncated %v; want 5, true", len(hits), summary.Truncated)
+	}
+	for _, call := range cluster.calls {
+		if call != "POST /logs/_search" {
+			t.Errorf("unexpected call %s", call)
+		}
+	}
+}
+
+func TestElasticFetchHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"security_exception"}`, http.StatusForbidden)
+	}))
+	defer server.Close()
+	source := newTestElastic(t, server, false, `{"index": "logs"}`)
+	_, err := source.Fetch(context.Background(), Query{}, &Summary{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "HTTP 403") || !strings.Contains(err.Error(), "point in time") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestElasticQuery(t *testing.T) {
+	source, err := NewElasticSource(SourceConfig{URL: "http://es:9200", Options: []byte(`{"index": "logs"}`)}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := source.(*ElasticSource)
+	timeRange := map[string]interface{}{"range": map[string]interface{}{"@timestamp": map[string]interface{}{"format": "epoch_millis", "gte": int64(1000), "lte": int64(2000)}}}
+
+	tests := []struct {
+		name   string
+		search string
+		clause interface{}
+	}{
+		{"empty", "", map[string]interface{}{"match_all": map[string]interface{}{}}},
+		{"KQL", `host.name:web01 and not user:"john and jane"`, map[string]interface{}{"query_string": map[string]interface{}{"query": `host.name:web01 AND NOT user:"john and jane"`}}},
+		{"DSL with query", `{"query": {"term": {"event.code": "4625"}}}`, map[string]interface{}{"term": map[string]interface{}{"event.code": "4625"}}},
+		{"bare DSL", `{"match": {"message": "denied"}}`, map[string]interface{}{"match": map[string]interface{}{"message": "denied"}}},
+	}
+	for _, tt := range tests {
+		got, err := e.query(Query{Search: tt.search, StartTime: 1000, EndTime: 2000})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		want := map[string]interface{}{"bool": map[string]interface{}{
+			"must":     []interface{}{tt.clause},
+			"filter":   []interface{}{timeRange},
+			"must_not": []interface{}{},
+		}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: query() = %v, want %v", tt.name, got, want)
+		}
+	}
+	if _, err := e.query(Query{Search: `{"query": `}); err == nil {
+		t.Error("invalid DSL accepted")
+	}
+
+	got, err := e.query(Query{
+		Include: []Filter{{Field: "event.code", Values: []string{"4624", "4625"}}},
+		Exclude: []Filter{{Field: "user.name", Operator: OpExists}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	boolQuery := got["bool"].(map[string]interface{})
+	if filter := boolQuery["filter"].([]interface{}); len(filter) != 2 || !reflect.DeepEqual(filter[1], map[string]interface{}{"terms": map[string]interface{}{"event.code": []string{"4624", "4625"}}}) {
+		t.Errorf("filter = %v", filter)
+	}
+	if mustNot := boolQuery["must_not"].([]interface{}); !reflect.DeepEqual(mustNot, []interface{}{map[string]interface{}{"exists": map[string]interface{}{"field": "user.name"}}}) {
+		t.Errorf("must_not = %v", mustNot)
+	}
+}
+
+func TestKQLToLucene(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"a and b", "a AND b"},
+		{"a or (b and not c)", "a OR (b AND NOT c)"},
+		{`msg:"this and that" or x`, `msg:"this and that" OR x`},
+		{"brand:android", "brand:android"},
+		{"AND", "AND"},
+	}
+	for _, tt := range tests {
+		if got := kqlToLucene(tt.in); got != tt.want {
+			t.Errorf("kqlToLucene(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestElasticAuth(t *testing.T) {
+	tests := []struct {
+		opts, token, want string
+	}{
+		{`{"index": "logs", "disablePIT": true}`, "key", "ApiKey key"},
+		{`{"index": "logs", "disablePIT": true, "authScheme": "Bearer"}`, "tok", "Bearer tok"},
+		{`{"index": "logs", "disablePIT": true, "authScheme": "Basic", "username": "elastic", "password": "pw"}`, "", "Basic ZWxhc3RpYzpwdw=="},
+		{`{"index": "logs", "disablePIT": true}`, "", ""},
+	}
+	for _, tt := range tests {
+		cluster, server := newTestCluster(t, false, 1)
+		source, err := NewElasticSource(SourceConfig{URL: server.URL, Token: tt.token, Options: []byte(tt.opts)}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := source.Fetch(context.Background(), Query{}, &Summary{}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if cluster.auth[0] != tt.want {
+			t.Errorf("%s: Authorization = %q, want %q", tt.opts, cluster.auth[0], tt.want)
+		}
+	}
+
+	for _, cfg := range []SourceConfig{{Options: []byte(`{"index": "logs"}`)}, {URL: "http://es:9200"}} {
+		if _, err := NewElasticSource(cfg, false); err == nil {
+			t.Errorf("%+v accepted", cfg)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package capture
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Filter operators. A filter with several values matches any of them.
+const (
+	OpIs       = "is"
+	OpPrefix   = "prefix"
+	OpWildcard = "wildcard"
+	OpExists   = "exists"
+	OpGT       = "gt"
+	OpGTE      = "gte"
+	OpLT       = "lt"
+	OpLTE      = "lte"
+)
+
+// Filter is a structured condition on one field. Sources translate filters
+// into their own syntax, so authors don't have to write it into the search.
+type Filter struct {
+	Field    string   `json:"field"`
+	Operator string   `json:"operator"` // "is" when empty
+	Values   []string `json:"values"`
+}
+
+// Op returns the filter's operator, defaulting to is
+func (f Filter) Op() string {
+	if f.Operator == "" {
+		return OpIs
+	}
+	return f.Operator
+}
+
+// Validate checks the filter has a field and the values its operator needs
+func (f Filter) Validate() error {
+	if strings.TrimSpace(f.Field) == "" {
+		return fmt.Errorf("filter has no field")
+	}
+	switch f.Op() {
+	case OpIs, OpPrefix, OpWildcard:
+		if len(f.Values) == 0 {
+			return fmt.Errorf("filter on %s needs at least one value", f.Field)
+		}
+	case OpExists:
+		if len(f.Values) > 0 {
+			return fmt.Errorf("exists filter on %s takes no values", f.Field)
+		}
+	case OpGT, OpGTE, OpLT, OpLTE:
+		if len(f.Values) != 1 {
+			return fmt.Errorf("%s filter on %s takes exactly one value", f.Op(), f.Field)
+		}
+	default:
+		return fmt.Errorf("unknown filter operator %q on %s", f.Operator, f.Field)
+	}
+	return nil
+}
+
+// Validate checks a query's include and exclude filters
+func (q Query) Validate() error {
+	for _, f := range q.Include {
+		if err := f.Validate(); err != nil {
+			return fmt.Errorf("include %v", err)
+		}
+	}
+	for _, f := range q.Exclude {
+		if err := f.Validate(); err != nil {
+			return fmt.Errorf("exclude %v", err)
+		}
+	}
+	return nil
+}
+
+// fluencyFilterOps checks every filter is one Fluency has a facet for. Its
+// facet filters match a key against one or more values, so the other
+// operators have to go in the search string instead.
+func fluencyFilterOps(filters []Filter) error {
+	for _, f := range filters {
+		if f.Op() != OpIs {
+			return fmt.Errorf("Fluency can only filter on exact values; put the %s filter on %s in the search string instead", f.Op(), f.Field)
+		}
+	}
+	return nil
+}
+
+// fluencyFilters turns filters into Fluency facet filters
+func fluencyFilters(filters []Filter) ([]map[string]interface{}, error) {
+	if err := fluencyFilterOps(filters); err != nil {
+		return nil, err
+	}
+	out := []map[string]interface{}{}
+	for _, f := range filters {
+		var value interface{} = f.Values
+		if len(f.Values) == 1 {
+			value = f.Values[0]
+		}
+		out = append(out, map[string]interface{}{"key": f.Field, "value": value})
+	}
+	return out, nil
+}
+
+// splunkOps are the SPL comparison operators
+var splunkOps = map[string]string{OpGT: ">", OpGTE: ">=", OpLT: "<", OpLTE: "<="}
+
+// splunkFieldChars are characters a field name can't contain in a search
+// clause, where field names are never quoted
+const splunkFieldChars = " =!<>()\"'|"
+
+// splunkFieldNames checks every filter names a field SPL search can match
+func splunkFieldNames(filters []Filter) error {
+	for _, f := range filters {
+		if strings.ContainsAny(f.Field, splunkFieldChars) {
+			return fmt.Errorf("Splunk can't filter on the field %q; rename it with | rename in the search instead", f.Field)
+		}
+	}
+	return nil
+}
+
+// splunkFilter turns a filter into an SPL search clause
+func splunkFilter(f Filter) string {
+	switch f.Op() {
+	case OpExists:
+		return f.Field + "=*"
+	case OpGT, OpGTE, OpLT, OpLTE:
+		// Numbers stay bare so Splunk compares them as numbers
+		value := f.Values[0]
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			value = strconv.Quote(value)
+		}
+		return f.Field + splunkOps[f.Op()] + value
+	}
+	terms := make([]string, len(f.Values))
+	for i, value := range f.Values {
+		if f.Op() == OpPrefix {
+			value = strings.ReplaceAll(value, "*", "") + "*"
+		}
+		terms[i] = f.Field + "=" + strconv.Quote(value)
+	}
+	if len(terms) == 1 {
+		return terms[0]
+	}
+	return "(" + strings.Join(terms, " OR ") + ")"
+}
+
+// splunkFilters adds filters to an SPL search. Terms go straight into a plain
+// search; searches that already pipe get a trailing search command.
+func splunkFilters(search string, include, exclude []Filter) string {
+	clauses := []string{}
+	for _, f := range include {
+		clauses = append(clauses, splunkFilter(f))
+	}
+	for _, f := range exclude {
+		clauses = append(clauses, "NOT "+splunkFilter(f))
+	}
+	if len(clauses) == 0 {
+		return search
+	}
+	if strings.Contains(search, "|") {
+		return search + " | search " + strings.Join(clauses, " ")
+	}
+	return strings.TrimSpace(search + " " + strings.Join(clauses, " "))
+}
+
+// elasticFilter turns a filter into a query DSL clause
+func elasticFilter(f Filter) map[string]interface{} {
+	switch f.Op() {
+	case OpExists:
+		return map[string]interface{}{"exists": map[string]interface{}{"field": f.Field}}
+	case OpGT, OpGTE, OpLT, OpLTE:
+		return map[string]interface{}{"range": map[string]interface{}{f.Field: map[string]interface{}{f.Op(): f.Values[0]}}}
+	case OpPrefix, OpWildcard:
+		should := make([]interface{}, len(f.Values))
+		for i, value := range f.Values {
+			should[i] = map[string]interface{}{f.Op(): map[string]interface{}{f.Field: value}}
+		}
+		if len(should) == 1 {
+			return should[0].(map[string]interface{})
+		}
+		return map[string]interface{}{"bool": map[string]interface{}{"should": should, "minimum_should_match": 1}}
+	}
+	return map[string]interface{}{"terms": map[string]interface{}{f.Field: f.Values}}
+}
@@ -0,0 +1,85 @@
+package capture
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplunkFilters(t *testing.T) {
+	tests := []struct {
+		name             string
+		search           string
+		include, exclude []Filter
+		want             string
+	}{
+		{"none", "search index=main", nil, nil, "search index=main"},
+		{"is", "search index=main", []Filter{{Field: "host", Values: []string{"web01"}}}, nil, `search index=main host="web01"`},
+		{"any of", "search index=main", []Filter{{Field: "EventCode", Values: []string{"4624", "4625"}}}, nil, `search index=main (EventCode="4624" OR EventCode="4625")`},
+		{"dotted field", "search index=main", []Filter{{Field: "user.name", Operator: OpPrefix, Values: []string{"adm*"}}}, nil, `search index=main user.name="adm*"`},
+		{"exists", "search index=main", nil, []Filter{{Field: "src_ip", Operator: OpExists}}, "search index=main NOT src_ip=*"},
+		{"numeric range", "search index=main", []Filter{{Field: "bytes", Operator: OpGTE, Values: []string{"1024"}}}, nil, "search index=main bytes>=1024"},
+		{"string range", "search index=main", []Filter{{Field: "user", Operator: OpLT, Values: []string{"m"}}}, nil, `search index=main user<"m"`},
+		{"piped search", "search index=main | stats count by host", []Filter{{Field: "host", Values: []string{"web01"}}}, nil, `search index=main | stats count by host | search host="web01"`},
+	}
+	for _, tt := range tests {
+		if got := splunkFilters(tt.search, tt.include, tt.exclude); got != tt.want {
+			t.Errorf("%s: splunkFilters() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFluencyFilters(t *testing.T) {
+	got, err := fluencyFilters([]Filter{
+		{Field: "host", Values: []string{"web01"}},
+		{Field: "EventCode", Operator: OpIs, Values: []string{"4624", "4625"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{
+		{"key": "host", "value": "web01"},
+		{"key": "EventCode", "value": []string{"4624", "4625"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fluencyFilters() = %v, want %v", got, want)
+	}
+}
+
+// Filters a source can't run are turned away before the capture starts
+func TestValidateQueryChecksTheSource(t *testing.T) {
+	fluency, err := NewFluencySource(SourceConfig{URL: "https://fluency.example.com", Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	splunk, err := NewSplunkSource(SourceConfig{URL: "https://splunk.example.com:8089", Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	elastic, err := NewElasticSource(SourceConfig{URL: "http://es:9200", Options: []byte(`{"index": "logs"}`)}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		source CaptureSource
+		query  Query
+		want   string
+	}{
+		{"fluency is", fluency, Query{Include: []Filter{{Field: "host", Values: []string{"a"}}}}, ""},
+		{"fluency prefix", fluency, Query{Include: []Filter{{Field: "host", Operator: OpPrefix, Values: []string{"a"}}}}, "exact values"},
+		{"fluency exclude exists", fluency, Query{Exclude: []Filter{{Field: "host", Operator: OpExists}}}, "exact values"},
+		{"splunk dotted field", splunk, Query{Include: []Filter{{Field: "user.name", Values: []string{"a"}}}}, ""},
+		{"splunk field with a space", splunk, Query{Include: []Filter{{Field: "user name", Values: []string{"a"}}}}, "can't filter"},
+		{"splunk field with a quote", splunk, Query{Exclude: []Filter{{Field: `x"y`, Operator: OpExists}}}, "can't filter"},
+		{"elastic anything", elastic, Query{Include: []Filter{{Field: "user name", Operator: OpWildcard, Values: []string{"a*"}}}}, ""},
+		{"bad filter", elastic, Query{Include: []Filter{{Field: "x", Operator: "near"}}}, "unknown filter operator"},
+	}
+	for _, tt := range tests {
+		err := ValidateQuery(tt.source, tt.query)
+		if tt.want == "" && err != nil || tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%s: ValidateQuery() = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// fluencyPageLimit is how many events are requested per page
+const fluencyPageLimit = 1000
+
+// fluencyMaxOffset is the deepest offset Fluency will page to (Elasticsearch's
+// default max_result_window). Larger ranges are split into smaller windows.
+const fluencyMaxOffset = 10000
+
+func init() {
+	RegisterSource("fluency", NewFluencySource)
+}
+
+// FluencyOptions are the Fluency-specific parts of a capture
+type FluencyOptions struct {
+	GridAccount string `json:"gridAccount"`
+	Partition   string `json:"partition"`
+	DataType    string `json:"dataType"`
+	// MustFilters and MustNotFilters are passed to Fluency's facets as they
+	// are, after the ones translated from the query's filters
+	MustFilters    []map[string]interface{} `json:"mustFilters"`
+	MustNotFilters []map[string]interface{} `json:"mustNotFilters"`
+}
+
+// FluencySource captures from Fluency's index zoom histogram API
+type FluencySource struct {
+	Site    string
+	Token   string
+	Options FluencyOptions
+	Client  *http.Client
+}
+
+// NewFluencySource creates a Fluency source; URL is the site's base URL
+func NewFluencySource(cfg SourceConfig) (CaptureSource, error) {
+	if cfg.URL == "" || cfg.Token == "" {
+		return nil, fmt.Errorf("missing site or token in siteConfig")
+	}
+	opts := FluencyOptions{Partition: "default", DataType: "event"}
+	if err := decodeOptions(cfg.Options, &opts); err != nil {
+		return nil, err
+	}
+	site := cfg.URL
+	if !strings.HasSuffix(site, "/") {
+		site += "/"
+	}
+	return &FluencySource{Site: site, Token: cfg.Token, Options: opts, Client: &http.Client{}}, nil
+}
+
+// extractHits reads response.hits.hits
+func extractHits(response map[string]interface{}) []interface{} {
+	// Check if "response" exists and is a map
+	respData, ok := response["response"].(map[string]interface{})
+	if !ok {
+		fmt.Println("Missing or invalid 'response' field in JSON")
+		return nil
+	}
+	return searchHits(respData)
+}
+
+// searchHits reads hits.hits from an Elasticsearch-style search response
+func searchHits(respData map[string]interface{}) []interface{} {
+	// Check if "hits" exists and is a map
+	hitsData, ok := respData["hits"].(map[string]interface{})
+	if !ok {
+		fmt.Println("Missing or invalid 'hits' field in JSON")
+		return nil
+	}
+
+	// Check if "hits.hits" exists and is an array
+	hitsInterface, ok := hitsData["hits"]
+	if !ok {
+		fmt.Println("Missing 'hits.hits' in response")
+		return nil
+	}
+
+	hits, ok := hitsInterface.([]interface{})
+	if !ok {
+		fmt.Println("Invalid format for 'hits.hits', expected an array")
+		return nil
+	}
+
+	return hits
+}
+
+// extractTotal reads response.hits.total. It returns -1 when missing.
+func extractTotal(response map[string]interface{}) int {
+	respData, ok := response["response"].(map[string]interface{})
+	if !ok {
+		return -1
+	}
+	return searchTotal(respData)
+}
+
+// searchTotal reads hits.total, which is either a number or {"value": n} as
+// in newer Elasticsearch. It returns -1 when missing.
+func searchTotal(respData map[string]interface{}) int {
+	hitsData, ok := respData["hits"].(map[string]interface{})
+	if !ok {
+		return -1
+	}
+	switch total := hitsData["total"].(type) {
+	case float64:
+		return int(total)
+	case map[string]interface{}:
+		if value, ok := total["value"].(float64); ok {
+			return int(value)
+		}
+	}
+	return -1
+}
+
+// CheckQuery turns away filters Fluency has no facet for
+func (f *FluencySource) CheckQuery(q Query) error {
+	if err := fluencyFilterOps(q.Include); err != nil {
+		return err
+	}
+	return fluencyFilterOps(q.Exclude)
+}
+
+// fetchPage requests a single page of events starting at offset
+func (f *FluencySource) fetchPage(ctx context.Context, q Query, offset, limit int) ([]interface{}, int, error) {
+	method := "POST"
+
+	baseURL := f.Site + "api/ds/get_index_zoom_histogram_lv3"
+	url := baseURL
+	if f.Options.GridAccount != "" {
+		url += "?gridaccount=" + f.Options.GridAccount
+	}
+
+	// Set headers
+	headers := map[string]string{
+		"Content-Type": "application/json",
+		"Accept":       "application/json",
+		"fluencytoken": f.Token,
+	}
+
+	mustFilters, err := fluencyFilters(q.Include)
+	if err != nil {
+		return nil, 0, err
+	}
+	mustNotFilters, err := fluencyFilters(q.Exclude)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Construct the JSON payload
+	payload := map[string]interface{}{
+		"kargs": map[string]interface{}{
+			"partition": f.Options.Partition,
+			"dataType":  f.Options.DataType,
+			"options": map[string]interface{}{
+				"dateFacetField": "@timestamp",
+				"facets": map[string]interface{}{
+					"facets":         []map[string]interface{}{},
+					"mustFilters":    append(mustFilters, f.Options.MustFilters...),
+					"mustNotFilters": append(mustNotFilters, f.Options.MustNotFilters...),
+					"dateFacets": []map[string]interface{}{
+						{
+							"name": "dateHistogram",
+							"key":  "@timestamp",
+						},
+					},
+				},
+				"dataType":    f.Options.DataType,
+				"searchStr":   q.Search,
+				"sortField":   "@timestamp",
+				"sortOrder":   "asc",
+				"range_from":  q.StartTime,
+				"range_to":    q.EndTime,
+				"fetchOffset": float64(offset),
+				"fetchLimit":  float64(limit),
+			},
+		},
+	}
+
+	// Convert struct to JSON
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Println("❌ Error marshaling JSON:", err)
+		return nil, 0, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	// Create request body from JSON
+	reqBody := bytes.NewReader(payloadBytes)
+
+	// Create HTTP request
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Add headers
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	// Send request
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Handle HTTP errors
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("API request failed: HTTP %d - %s", resp.StatusCode, resp.Status)
+	}
+
+	// Read response body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	// Check if response body is empty
+	if len(body) == 0 {
+		return nil, 0, fmt.Errorf("empty response body from API")
+	}
+
+	// Parse JSON response
+	var jsonResponse map[string]interface{}
+	err = json.Unmarshal(body, &jsonResponse)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+
+	// Extract response.hits.hits
+	hits := extractHits(jsonResponse)
+
+	return hits, extractTotal(jsonResponse), nil
+}
+
+// fetchWindow pages through one time window and returns the total the source
+// reported for it. If the window holds more events than the source lets us
+// page to, it is split in half and each half fetched on its own. Both halves
+// include the midpoint, so nothing is lost whether or not range_to is
+// inclusive; seen drops the hits that then arrive twice. report, if set, is
+// called after every page.
+func (f *FluencySource) fetchWindow(ctx context.Context, q Query, hits *[]interface{}, seen map[string]int, summary *Summary, report func(JobProgress)) (int, error) {
+	page, total, err := f.fetchPage(ctx, q, 0, fluencyPageLimit)
+	if err != nil {
+		return 0, err
+	}
+	summary.Pages++
+	if summary.Pages == 1 {
+		// The outermost window's total is the figure for the whole range
+		summary.Reported = total
+	}
+	notify := func() {
+		if report != nil {
+			report(JobProgress{Pages: summary.Pages, Captured: len(*hits), Reported: summary.Reported})
+		}
+	}
+
+	if total > fluencyMaxOffset && q.EndTime-q.StartTime > 1 {
+		mid := q.StartTime + (q.EndTime-q.StartTime)/2
+		left, right := q, q
+		left.EndTime = mid
+		right.StartTime = mid
+		if _, err := f.fetchWindow(ctx, left, hits, seen, summary, report); err != nil {
+			return 0, err
+		}
+		if _, err := f.fetchWindow(ctx, right, hits, seen, summary, report); err != nil {
+			return 0, err
+		}
+		return total, nil
+	}
+
+	summary.Windows++
+	window := summary.Windows
+	appendHits(hits, seen, window, page)
+	notify()
+	offset := len(page)
+	for len(page) == fluencyPageLimit && (total < 0 || offset < total) {
+		if offset+fluencyPageLimit > fluencyMaxOffset {
+			summary.Truncated = true
+			summary.Warnings = append(summary.Warnings, fmt.Sprintf("window %d-%d holds %d events, more than the %d the source pages to", q.StartTime, q.EndTime, total, fluencyMaxOffset))
+			break
+		}
+		page, _, err = f.fetchPage(ctx, q, offset, fluencyPageLimit)
+		if err != nil {
+			return 0, err
+		}
+		summary.Pages++
+		appendHits(hits, seen, window, page)
+		notify()
+		offset += len(page)
+	}
+	return total, nil
+}
+
+// appendHits adds a page of hits fetched in the given window, skipping any
+// whose _id was already seen. Hits without an _id are told apart by their
+// content, and only skipped when an earlier window already had them: two
+// identical events in one window are both real, while the same event in two
+// windows is the split's shared midpoint.
+func appendHits(hits *[]interface{}, seen map[string]int, window int, page []interface{}) {
+	for _, hit := range page {
+		key, byID := hitKey(hit)
+		if first, dup := seen[key]; dup && (byID || first != window) {
+			continue
+		}
+		seen[key] = window
+		*hits = append(*hits, hit)
+	}
+}
+
+// hitKey identifies a hit by its _id, or by a digest of its content when it
+// has none
+func hitKey(hit interface{}) (string, bool) {
+	if hitMap, ok := hit.(map[string]interface{}); ok {
+		if id, ok := hitMap["_id"].(string); ok && id != "" {
+			return "id:" + id, true
+		}
+	}
+	content, _ := json.Marshal(hit)
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:]), false
+}
+
+// Fetch pages through the whole range, splitting it when needed
+func (f *FluencySource) Fetch(ctx context.Context, q Query, summary *Summary, report func(JobProgress)) ([]interface{}, error) {
+	hits := []interface{}{}
+	total, err := f.fetchWindow(ctx, q, &hits, map[string]int{}, summary, report)
+	if err != nil {
+		return nil, err
+	}
+	// The outermost window's total is the figure for the whole range
+	summary.Reported = total
+	return hits, nil
+}
+
+// Normalize returns a hit's _source
+func (f *FluencySource) Normalize(hit interface{}) (map[string]interface{}, bool) {
+	hitMap, ok := hit.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	source, ok := hitMap["_source"].(map[string]interface{})
+	return source, ok
+}
@@ -0,0 +1,168 @@
+package capture
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestFluency serves events from the index zoom histogram API the way
+// Fluency pages them, with range_to inclusive or exclusive
+func newTestFluency(t *testing.T, events []map[string]interface{}, inclusive bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("fluencytoken") != "token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var body struct {
+			Kargs struct {
+				Options struct {
+					From   float64 `json:"range_from"`
+					To     float64 `json:"range_to"`
+					Offset float64 `json:"fetchOffset"`
+					Limit  float64 `json:"fetchLimit"`
+				} `json:"options"`
+			} `json:"kargs"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("bad payload: %v", err)
+		}
+		opts := body.Kargs.Options
+		matched := []interface{}{}
+		for _, event := range events {
+			ts := event["@timestamp"].(float64)
+			if ts < opts.From || ts > opts.To || !inclusive && ts == opts.To {
+				continue
+			}
+			hit := map[string]interface{}{"_source": event}
+			if id, ok := event["id"]; ok {
+				hit["_id"] = id
+			}
+			matched = append(matched, hit)
+		}
+		if int(opts.Offset) > fluencyMaxOffset {
+			http.Error(w, "result window is too large", http.StatusBadRequest)
+			return
+		}
+		page := matched[min(int(opts.Offset), len(matched)):min(int(opts.Offset+opts.Limit), len(matched))]
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"response": map[string]interface{}{
+				"hits": map[string]interface{}{"total": map[string]interface{}{"value": len(matched)}, "hits": page},
+			},
+		})
+	}))
+}
+
+// denseEvents puts perMs events on every millisecond of [0, ms)
+func denseEvents(ms, perMs int) []map[string]interface{} {
+	events := []map[string]interface{}{}
+	for i := 0; i < ms; i++ {
+		for j := 0; j < perMs; j++ {
+			events = append(events, map[string]interface{}{"id": fmt.Sprintf("%d-%d", i, j), "@timestamp": float64(i)})
+		}
+	}
+	return events
+}
+
+func TestFluencySplitsWindowsWithoutLoss(t *testing.T) {
+	events := denseEvents(1000, 12)
+	for _, inclusive := range []bool{true, false} {
+		server := newTestFluency(t, events, inclusive)
+		source, err := NewFluencySource(SourceConfig{URL: server.URL, Token: "token"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		summary := &Summary{}
+		hits, err := source.Fetch(context.Background(), Query{StartTime: 0, EndTime: 999}, summary, nil)
+		server.Close()
+		if err != nil {
+			t.Fatalf("inclusive=%v: Fetch: %v", inclusive, err)
+		}
+
+		want := len(events)
+		if !inclusive {
+			want -= 12 // the last millisecond is outside an exclusive range
+		}
+		seen := map[string]bool{}
+		for _, hit := range hits {
+			id := hit.(map[string]interface{})["_id"].(string)
+			if seen[id] {
+				t.Errorf("inclusive=%v: event %s captured twice", inclusive, id)
+			}
+			seen[id] = true
+		}
+		if len(hits) != want {
+			t.Errorf("inclusive=%v: captured %d events, want %d", inclusive, len(hits), want)
+		}
+		if summary.Windows < 2 || summary.Truncated {
+			t.Errorf("inclusive=%v: windows = %d, truncated = %v; want a split without truncation", inclusive, summary.Windows, summary.Truncated)
+		}
+	}
+}
+
+// Hits without an _id are deduplicated by content across split windows only,
+// so identical events within a window all survive
+func TestFluencySplitsWindowsWithoutIDs(t *testing.T) {
+	events := denseEvents(1000, 12)
+	for _, event := range events {
+		delete(event, "id")
+		event["n"] = 1 // every event on a millisecond looks the same
+	}
+	for _, inclusive := range []bool{true, false} {
+		server := newTestFluency(t, events, inclusive)
+		source, err := NewFluencySource(SourceConfig{URL: server.URL, Token: "token"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		summary := &Summary{}
+		hits, err := source.Fetch(context.Background(), Query{StartTime: 0, EndTime: 999}, summary, nil)
+		server.Close()
+		if err != nil {
+			t.Fatalf("inclusive=%v: Fetch: %v", inclusive, err)
+		}
+
+		want := len(events)
+		if !inclusive {
+			want -= 12
+		}
+		if len(hits) != want || summary.Windows < 2 {
+			t.Errorf("inclusive=%v: captured %d events in %d windows, want %d after a split", inclusive, len(hits), summary.Windows, want)
+		}
+	}
+}
+
+func TestFluencyPagesSmallRange(t *testing.T) {
+	events := denseEvents(25, 100)
+	server := newTestFluency(t, events, true)
+	defer server.Close()
+	source, err := NewFluencySource(SourceConfig{URL: server.URL, Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary := &Summary{}
+	hits, err := source.Fetch(context.Background(), Query{StartTime: 0, EndTime: 24}, summary, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != len(events) || summary.Pages != 3 || summary.Windows != 1 || summary.Reported != len(events) {
+		t.Errorf("got %d hits, %d pages, %d windows, %d reported; want %d hits in 3 pages of 1 window", len(hits), summary.Pages, summary.Windows, summary.Reported, len(events))
+	}
+}
+
+func TestFluencyHTTPError(t *testing.T) {
+	server := newTestFluency(t, nil, true)
+	defer server.Close()
+	source, err := NewFluencySource(SourceConfig{URL: server.URL, Token: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Fetch(context.Background(), Query{StartTime: 0, EndTime: 10}, &Summary{}, nil); err == nil {
+		t.Error("Fetch succeeded with a rejected token")
+	}
+}
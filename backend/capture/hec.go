@@ -0,0 +1,122 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// hecMaxBody caps a single HEC request
+const hecMaxBody = 10 << 20
+
+// hecReply answers the way Splunk's HTTP Event Collector does
+func hecReply(w http.ResponseWriter, status int, code int, text string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"text": text, "code": code})
+}
+
+// hecHandler serves the HEC endpoints senders use: event, raw and health
+func (r *Recorder) hecHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/services/collector/health", func(w http.ResponseWriter, req *http.Request) {
+		hecReply(w, http.StatusOK, 17, "HEC is healthy")
+	})
+	mux.HandleFunc("/services/collector", r.hecAuth(r.hecEvent))
+	mux.HandleFunc("/services/collector/event", r.hecAuth(r.hecEvent))
+	mux.HandleFunc("/services/collector/event/1.0", r.hecAuth(r.hecEvent))
+	mux.HandleFunc("/services/collector/raw", r.hecAuth(r.hecRaw))
+	mux.HandleFunc("/services/collector/raw/1.0", r.hecAuth(r.hecRaw))
+	return mux
+}
+
+// hecAuth checks the Splunk token when the recorder has one
+func (r *Recorder) hecAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			hecReply(w, http.StatusMethodNotAllowed, 6, "Invalid data format")
+			return
+		}
+		if r.Config.HECToken != "" {
+			auth := req.Header.Get("Authorization")
+			token := strings.TrimPrefix(strings.TrimPrefix(auth, "Splunk "), "Bearer ")
+			if auth == "" {
+				hecReply(w, http.StatusUnauthorized, 2, "Token is required")
+				return
+			}
+			if token != r.Config.HECToken {
+				hecReply(w, http.StatusForbidden, 4, "Invalid token")
+				return
+			}
+		}
+		next(w, req)
+	}
+}
+
+// hecEvent records each envelope in the body. The envelope is kept so a
+// replay sends the same host, source and sourcetype; its own time is replaced
+// by the receive time. The whole body is checked first, so a rejected request
+// records nothing, as with Splunk.
+func (r *Recorder) hecEvent(w http.ResponseWriter, req *http.Request) {
+	decoder := json.NewDecoder(io.LimitReader(req.Body, hecMaxBody))
+	envelopes := []map[string]interface{}{}
+	for {
+		var envelope map[string]interface{}
+		if err := decoder.Decode(&envelope); err == io.EOF {
+			break
+		} else if err != nil {
+			hecReply(w, http.StatusBadRequest, 6, "Invalid data format")
+			return
+		}
+		if _, ok := envelope["event"]; !ok {
+			hecReply(w, http.StatusBadRequest, 12, "Event field is required")
+			return
+		}
+		delete(envelope, "time")
+		envelopes = append(envelopes, envelope)
+	}
+	if len(envelopes) == 0 {
+		hecReply(w, http.StatusBadRequest, 5, "No data")
+		return
+	}
+	for _, envelope := range envelopes {
+		r.record(envelope)
+	}
+	hecReply(w, http.StatusOK, 0, "Success")
+}
+
+// hecRaw records each line of the body as an event, with metadata taken
+// from the query string as Splunk does
+func (r *Recorder) hecRaw(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	scanner := bufio.NewScanner(io.LimitReader(req.Body, hecMaxBody))
+	scanner.Buffer(make([]byte, 64*1024), hecMaxBody)
+	envelopes := []map[string]interface{}{}
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		envelope := map[string]interface{}{"event": line}
+		for _, key := range []string{"host", "source", "sourcetype", "index"} {
+			if value := query.Get(key); value != "" {
+				envelope[key] = value
+			}
+		}
+		envelopes = append(envelopes, envelope)
+	}
+	if scanner.Err() != nil {
+		hecReply(w, http.StatusBadRequest, 6, "Invalid data format")
+		return
+	}
+	if len(envelopes) == 0 {
+		hecReply(w, http.StatusBadRequest, 5, "No data")
+		return
+	}
+	for _, envelope := range envelopes {
+		r.record(envelope)
+	}
+	hecReply(w, http.StatusOK, 0, "Success")
+}
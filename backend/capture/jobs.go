@@ -0,0 +1,197 @@
+package capture
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JobStatus is where a capture job is in its life
+type JobStatus string
+
+const (
+	JobRunning   JobStatus = "running"
+	JobCompleted JobStatus = "completed"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+// jobRetention is how long a finished job and its stored result are kept
+const jobRetention = time.Hour
+
+// JobProgress is how far a running capture has got
+type JobProgress struct {
+	Pages    int `json:"pages"`
+	Captured int `json:"captured"`
+	Reported int `json:"reported"` // -1 until the source reports a total
+}
+
+// RunFunc performs a capture. It should stop when ctx is cancelled, call
+// report as it goes, and return the events plus a summary kept with the job.
+type RunFunc func(ctx context.Context, report func(JobProgress)) ([]interface{}, interface{}, error)
+
+// Job is a capture running in the background
+type Job struct {
+	ID         string      `json:"id"`
+	Status     JobStatus   `json:"status"`
+	Progress   JobProgress `json:"progress"`
+	Summary    interface{} `json:"summary,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	CreatedBy  string      `json:"created_by"`
+	CreatedAt  time.Time   `json:"created_at"`
+	FinishedAt time.Time   `json:"finished_at,omitempty"`
+
+	resultPath string
+	cancel     context.CancelFunc
+}
+
+// Manager runs capture jobs and keeps their results on disk
+type Manager struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+	dir  string
+}
+
+// NewManager stores job results under dir, creating it if needed
+func NewManager(dir string) (*Manager, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create capture result directory: %w", err)
+	}
+	return &Manager{jobs: map[string]*Job{}, dir: dir}, nil
+}
+
+// Start runs a capture for createdBy in the background and returns its job
+// straight away
+func (m *Manager) Start(createdBy string, run RunFunc) Job {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		ID:        uuid.NewString(),
+		Status:    JobRunning,
+		Progress:  JobProgress{Reported: -1},
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+		cancel:    cancel,
+	}
+
+	m.mu.Lock()
+	m.jobs[job.ID] = job
+	snapshot := *job
+	m.mu.Unlock()
+
+	go m.run(ctx, job, run)
+	return snapshot
+}
+
+func (m *Manager) run(ctx context.Context, job *Job, run RunFunc) {
+	defer job.cancel()
+
+	report := func(p JobProgress) {
+		m.mu.Lock()
+		job.Progress = p
+		m.mu.Unlock()
+	}
+	hits, summary, err := run(ctx, report)
+
+	var resultPath string
+	if err == nil {
+		resultPath, err = m.saveResult(job.ID, hits)
+	}
+
+	m.mu.Lock()
+	job.FinishedAt = time.Now()
+	job.Summary = summary
+	switch {
+	case ctx.Err() != nil:
+		job.Status = JobCancelled
+		if resultPath != "" {
+			os.Remove(resultPath)
+		}
+	case err != nil:
+		job.Status = JobFailed
+		job.Error = err.Error()
+	default:
+		job.Status = JobCompleted
+		job.resultPath = resultPath
+		job.Progress.Captured = len(hits)
+	}
+	m.mu.Unlock()
+
+	time.AfterFunc(jobRetention, func() { m.remove(job.ID) })
+}
+
+// saveResult writes the captured events to the job's result file
+func (m *Manager) saveResult(id string, hits []interface{}) (string, error) {
+	path := filepath.Join(m.dir, id+".json")
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create result file: %w", err)
+	}
+	defer file.Close()
+	if err := json.NewEncoder(file).Encode(hits); err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to write result file: %w", err)
+	}
+	return path, nil
+}
+
+// Get returns a snapshot of a job
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List returns snapshots of every known job
+func (m *Manager) List() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobs := make([]Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, *job)
+	}
+	return jobs
+}
+
+// Cancel stops a running job. It reports false if there is no such job.
+func (m *Manager) Cancel(id string) bool {
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	m.mu.Unlock()
+	if ok {
+		job.cancel()
+	}
+	return ok
+}
+
+// ResultPath is where a completed job's events are stored
+func (m *Manager) ResultPath(id string) (string, error) {
+	job, ok := m.Get(id)
+	if !ok {
+		return "", fmt.Errorf("capture job %s not found", id)
+	}
+	if job.Status != JobCompleted {
+		return "", fmt.Errorf("capture job %s is %s", id, job.Status)
+	}
+	return job.resultPath, nil
+}
+
+// remove forgets a job and deletes its result
+func (m *Manager) remove(id string) {
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	delete(m.jobs, id)
+	m.mu.Unlock()
+	if ok && job.resultPath != "" {
+		os.Remove(job.resultPath)
+	}
+}
@@ -0,0 +1,106 @@
+package capture
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// waitForJob polls until a job leaves the running state
+func waitForJob(t *testing.T, m *Manager, id string) Job {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, ok := m.Get(id)
+		if !ok {
+			t.Fatalf("job %s disappeared", id)
+		}
+		if job.Status != JobRunning {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s still running", id)
+	return Job{}
+}
+
+func TestJobCompletesAndStoresResult(t *testing.T) {
+	m, err := NewManager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := m.Start("alice", func(ctx context.Context, report func(JobProgress)) ([]interface{}, interface{}, error) {
+		report(JobProgress{Pages: 1, Captured: 2, Reported: 2})
+		return []interface{}{map[string]interface{}{"a": 1.0}, map[string]interface{}{"b": 2.0}}, "summary", nil
+	})
+	if started.Status != JobRunning || started.Progress.Reported != -1 || started.CreatedBy != "alice" {
+		t.Errorf("started job = %+v, want alice's, running with no reported total", started)
+	}
+
+	job := waitForJob(t, m, started.ID)
+	if job.Status != JobCompleted || job.Progress.Captured != 2 || job.Progress.Pages != 1 || job.Summary != "summary" {
+		t.Errorf("finished job = %+v", job)
+	}
+	path, err := m.ResultPath(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hits []map[string]interface{}
+	if err := json.Unmarshal(data, &hits); err != nil || len(hits) != 2 {
+		t.Errorf("stored result = %s, %v", data, err)
+	}
+
+	m.remove(job.ID)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("result file kept after the job was removed: %v", err)
+	}
+	if _, ok := m.Get(job.ID); ok {
+		t.Error("removed job still listed")
+	}
+}
+
+func TestJobFailure(t *testing.T) {
+	m, err := NewManager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := m.Start("alice", func(ctx context.Context, report func(JobProgress)) ([]interface{}, interface{}, error) {
+		return nil, nil, errors.New("source unreachable")
+	})
+	job := waitForJob(t, m, started.ID)
+	if job.Status != JobFailed || job.Error != "source unreachable" {
+		t.Errorf("failed job = %+v", job)
+	}
+	if _, err := m.ResultPath(job.ID); err == nil {
+		t.Error("failed job has a result")
+	}
+}
+
+func TestJobCancel(t *testing.T) {
+	m, err := NewManager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := m.Start("alice", func(ctx context.Context, report func(JobProgress)) ([]interface{}, interface{}, error) {
+		<-ctx.Done()
+		return nil, nil, ctx.Err()
+	})
+	if !m.Cancel(started.ID) {
+		t.Fatal("Cancel did not find the job")
+	}
+	if job := waitForJob(t, m, started.ID); job.Status != JobCancelled {
+		t.Errorf("cancelled job = %+v", job)
+	}
+	if m.Cancel("missing") {
+		t.Error("Cancel found a job that doesn't exist")
+	}
+	if len(m.List()) != 1 {
+		t.Errorf("List = %v, want the cancelled job", m.List())
+	}
+}
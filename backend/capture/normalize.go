@@ -0,0 +1,77 @@
+package capture
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// RelativeOffsets sorts events by time and rewrites @timestamp to the scenario
+// offset the replayer expects: microseconds from the first event, negated, as
+// scenarios captured from Fluency have always been stored. Events without a
+// usable time are placed at the start.
+func RelativeOffsets(events []map[string]interface{}) []map[string]interface{} {
+	times := make([]int64, len(events))
+	valid := make([]bool, len(events))
+	var first int64
+	found := false
+	for i, event := range events {
+		times[i], valid[i] = EventTime(event["@timestamp"])
+		if valid[i] && (!found || times[i] < first) {
+			first, found = times[i], true
+		}
+	}
+	for i := range times {
+		if !valid[i] {
+			times[i] = first
+		}
+	}
+	order := make([]int, len(events))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return times[order[a]] < times[order[b]] })
+
+	out := make([]map[string]interface{}, len(events))
+	for n, i := range order {
+		event := events[i]
+		event["@timestamp"] = float64((first - times[i]) * 1000)
+		out[n] = event
+	}
+	return out
+}
+
+// EventTime reads a timestamp as epoch milliseconds. It accepts numbers in
+// seconds, milliseconds, microseconds or nanoseconds and RFC 3339 strings.
+func EventTime(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return normalizeEpoch(v), true
+	case int64:
+		return normalizeEpoch(float64(v)), true
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return normalizeEpoch(f), true
+		}
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05-0700", "2006-01-02 15:04:05"} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t.UnixMilli(), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// normalizeEpoch works out the unit of an epoch number from its size
+func normalizeEpoch(v float64) int64 {
+	switch {
+	case v < 1e11:
+		return int64(v * 1000)
+	case v < 1e14:
+		return int64(v)
+	case v < 1e17:
+		return int64(v / 1e3)
+	default:
+		return int64(v / 1e6)
+	}
+}
@@ -0,0 +1,60 @@
+package capture
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEventTime(t *testing.T) {
+	const ms = 1700000000123
+	tests := []struct {
+		value interface{}
+		want  int64
+		ok    bool
+	}{
+		{float64(1700000000), 1700000000000, true},
+		{float64(ms), ms, true},
+		{float64(ms * 1000), ms, true},
+		{float64(ms * 1000000), ms, true},
+		{int64(ms), ms, true},
+		{"1700000000.123", ms, true},
+		{"2023-11-14T22:13:20.123Z", ms, true},
+		{"2023-11-14T23:13:20.123+01:00", ms, true},
+		{"2023-11-14T23:13:20+0100", 1700000000000, true},
+		{"2023-11-14 22:13:20", 1700000000000, true},
+		{"yesterday", 0, false},
+		{nil, 0, false},
+		{true, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := EventTime(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("EventTime(%#v) = %d, %v, want %d, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRelativeOffsets(t *testing.T) {
+	events := []map[string]interface{}{
+		{"id": "c", "@timestamp": "2023-11-14T22:13:22Z"},
+		{"id": "a", "@timestamp": float64(1700000000000)},
+		{"id": "none"},
+		{"id": "b", "@timestamp": float64(1700000000500000)},
+	}
+	got := RelativeOffsets(events)
+	var ids []string
+	var offsets []float64
+	for _, event := range got {
+		ids = append(ids, event["id"].(string))
+		offsets = append(offsets, event["@timestamp"].(float64))
+	}
+	if want := []string{"a", "none", "b", "c"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("order = %v, want %v", ids, want)
+	}
+	if want := []float64{0, 0, -500000, -2000000}; !reflect.DeepEqual(offsets, want) {
+		t.Errorf("offsets = %v, want %v", offsets, want)
+	}
+	if len(RelativeOffsets(nil)) != 0 {
+		t.Error("no events should give no events")
+	}
+}
@@ -0,0 +1,292 @@
+package capture
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recorderMaxEvents is the default cap on a recording session
+const recorderMaxEvents = 100000
+
+// recorderProgressEvery is how often a recording reports its count
+const recorderProgressEvery = time.Second
+
+// RecorderConfig says where a recorder listens. Addresses are host:port
+// strings such as ":5514"; empty ones are not opened. Syslog has no
+// authentication, so anyone who can reach a syslog listener can add events
+// to the recording; only HEC checks a token.
+type RecorderConfig struct {
+	SyslogUDP string `json:"syslogUdp"`
+	SyslogTCP string `json:"syslogTcp"`
+	HEC       string `json:"hec"`
+	// HECToken is the token senders must present; empty accepts any sender
+	HECToken string `json:"hecToken"`
+	// MaxEvents stops the recording once reached; 0 means recorderMaxEvents
+	MaxEvents int `json:"maxEvents"`
+}
+
+// RecorderLimits is where recorders may listen: one host and an inclusive
+// port range. Addresses that name no host are given Host.
+type RecorderLimits struct {
+	Host    string
+	MinPort int
+	MaxPort int
+}
+
+// The default limits keep recorders on loopback, so nothing off the machine
+// can send to an unauthenticated syslog listener unless configured to
+const (
+	defaultRecorderHost  = "127.0.0.1"
+	defaultRecorderPorts = "5500-5599"
+)
+
+// ParseRecorderLimits reads a listen host and a "min-max" port range, using
+// the defaults for empty values
+func ParseRecorderLimits(host, ports string) (RecorderLimits, error) {
+	if host == "" {
+		host = defaultRecorderHost
+	}
+	if ports == "" {
+		ports = defaultRecorderPorts
+	}
+	lo, hi, ok := strings.Cut(ports, "-")
+	if !ok {
+		hi = lo
+	}
+	limits := RecorderLimits{Host: host}
+	var err1, err2 error
+	limits.MinPort, err1 = strconv.Atoi(strings.TrimSpace(lo))
+	limits.MaxPort, err2 = strconv.Atoi(strings.TrimSpace(hi))
+	if err1 != nil || err2 != nil || limits.MinPort < 1 || limits.MaxPort > 65535 || limits.MinPort > limits.MaxPort {
+		return RecorderLimits{}, fmt.Errorf("invalid recorder port range %q", ports)
+	}
+	return limits, nil
+}
+
+// Apply checks every address in cfg is on the allowed host and port range,
+// filling in the host where it was left out
+func (l RecorderLimits) Apply(cfg *RecorderConfig) error {
+	for _, input := range []struct {
+		name string
+		addr *string
+	}{{"syslogUdp", &cfg.SyslogUDP}, {"syslogTcp", &cfg.SyslogTCP}, {"hec", &cfg.HEC}} {
+		if *input.addr == "" {
+			continue
+		}
+		host, portStr, err := net.SplitHostPort(*input.addr)
+		if err != nil {
+			return fmt.Errorf("invalid %s address %q", input.name, *input.addr)
+		}
+		if host == "" {
+			host = l.Host
+		} else if host != l.Host {
+			return fmt.Errorf("recorders may only listen on %s, not %s", l.Host, host)
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port < l.MinPort || port > l.MaxPort {
+			return fmt.Errorf("%s port %s is outside the allowed range %d-%d", input.name, portStr, l.MinPort, l.MaxPort)
+		}
+		*input.addr = net.JoinHostPort(host, portStr)
+	}
+	return nil
+}
+
+// Recorder is a CaptureSource that listens for events instead of searching
+// for them. Each event is stamped with the time it arrived, and Fetch returns
+// everything received until Stop is called.
+type Recorder struct {
+	Config RecorderConfig
+
+	udp net.PacketConn
+	tcp net.Listener
+	hec *http.Server
+	hln net.Listener
+
+	mu      sync.Mutex
+	events  []interface{}
+	dropped int
+	conns   map[net.Conn]bool
+	closed  bool
+
+	wg       sync.WaitGroup
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewRecorder opens the configured listeners. Nothing is recorded until Fetch runs.
+func NewRecorder(cfg RecorderConfig) (*Recorder, error) {
+	if cfg.SyslogUDP == "" && cfg.SyslogTCP == "" && cfg.HEC == "" {
+		return nil, fmt.Errorf("recorder needs at least one of syslogUdp, syslogTcp or hec")
+	}
+	if cfg.MaxEvents <= 0 {
+		cfg.MaxEvents = recorderMaxEvents
+	}
+	r := &Recorder{Config: cfg, conns: map[net.Conn]bool{}, stop: make(chan struct{})}
+
+	var err error
+	if cfg.SyslogUDP != "" {
+		if r.udp, err = net.ListenPacket("udp", cfg.SyslogUDP); err != nil {
+			r.closeListeners()
+			return nil, fmt.Errorf("failed to listen for syslog on udp %s: %v", cfg.SyslogUDP, err)
+		}
+	}
+	if cfg.SyslogTCP != "" {
+		if r.tcp, err = net.Listen("tcp", cfg.SyslogTCP); err != nil {
+			r.closeListeners()
+			return nil, fmt.Errorf("failed to listen for syslog on tcp %s: %v", cfg.SyslogTCP, err)
+		}
+	}
+	if cfg.HEC != "" {
+		if r.hln, err = net.Listen("tcp", cfg.HEC); err != nil {
+			r.closeListeners()
+			return nil, fmt.Errorf("failed to listen for HEC on %s: %v", cfg.HEC, err)
+		}
+		r.hec = &http.Server{Handler: r.hecHandler(), ReadHeaderTimeout: 10 * time.Second}
+	}
+	return r, nil
+}
+
+// Addrs returns the address each input is listening on, which tells the
+// ports picked when the config asked for port 0
+func (r *Recorder) Addrs() map[string]string {
+	addrs := map[string]string{}
+	if r.udp != nil {
+		addrs["syslogUdp"] = r.udp.LocalAddr().String()
+	}
+	if r.tcp != nil {
+		addrs["syslogTcp"] = r.tcp.Addr().String()
+	}
+	if r.hln != nil {
+		addrs["hec"] = r.hln.Addr().String()
+	}
+	return addrs
+}
+
+// Count returns how many events have been recorded so far
+func (r *Recorder) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.events)
+}
+
+// Stop ends the recording; Fetch then returns what was received
+func (r *Recorder) Stop() {
+	r.stopOnce.Do(func() { close(r.stop) })
+}
+
+// record stores an event with its receive time
+func (r *Recorder) record(event map[string]interface{}) {
+	event["@timestamp"] = float64(time.Now().UnixMilli())
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.events) >= r.Config.MaxEvents {
+		r.dropped++
+		r.Stop()
+		return
+	}
+	r.events = append(r.events, event)
+}
+
+// track remembers an open TCP connection so Stop can close it
+func (r *Recorder) track(conn net.Conn) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return false
+	}
+	r.conns[conn] = true
+	return true
+}
+
+func (r *Recorder) untrack(conn net.Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.conns, conn)
+	conn.Close()
+}
+
+// closeListeners shuts every input and open connection
+func (r *Recorder) closeListeners() {
+	if r.udp != nil {
+		r.udp.Close()
+	}
+	if r.tcp != nil {
+		r.tcp.Close()
+	}
+	if r.hec != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		r.hec.Shutdown(ctx)
+		cancel()
+	} else if r.hln != nil {
+		r.hln.Close()
+	}
+	r.mu.Lock()
+	r.closed = true
+	for conn := range r.conns {
+		conn.Close()
+	}
+	r.mu.Unlock()
+}
+
+// Fetch records until Stop is called, MaxEvents is reached or ctx is
+// cancelled. The query is ignored; a recording takes whatever is sent.
+func (r *Recorder) Fetch(ctx context.Context, q Query, summary *Summary, report func(JobProgress)) ([]interface{}, error) {
+	if r.udp != nil {
+		r.wg.Add(1)
+		go func() { defer r.wg.Done(); r.serveSyslogUDP(r.udp) }()
+	}
+	if r.tcp != nil {
+		r.wg.Add(1)
+		go func() { defer r.wg.Done(); r.serveSyslogTCP(r.tcp) }()
+	}
+	if r.hec != nil {
+		r.wg.Add(1)
+		go func() { defer r.wg.Done(); r.hec.Serve(r.hln) }()
+	}
+	fmt.Printf("🎙️ Recording on %v\n", r.Addrs())
+
+	ticker := time.NewTicker(recorderProgressEvery)
+	defer ticker.Stop()
+	var err error
+wait:
+	for {
+		select {
+		case <-ticker.C:
+			if report != nil {
+				report(JobProgress{Captured: r.Count(), Reported: -1})
+			}
+		case <-r.stop:
+			break wait
+		case <-ctx.Done():
+			err = ctx.Err()
+			break wait
+		}
+	}
+	r.closeListeners()
+	r.wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	summary.Windows = 1
+	if r.dropped > 0 {
+		summary.Truncated = true
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("stopped at the %d event limit; %d later events were dropped", r.Config.MaxEvents, r.dropped))
+	}
+	return r.events, nil
+}
+
+// Normalize returns recorded events as they are; they already carry their
+// receive time
+func (r *Recorder) Normalize(hit interface{}) (map[string]interface{}, bool) {
+	event, ok := hit.(map[string]interface{})
+	return event, ok
+}
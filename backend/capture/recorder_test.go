@@ -0,0 +1,118 @@
+package capture
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRecorderLimits(t *testing.T) {
+	tests := []struct {
+		host, ports string
+		want        RecorderLimits
+		err         bool
+	}{
+		{"", "", RecorderLimits{Host: "127.0.0.1", MinPort: 5500, MaxPort: 5599}, false},
+		{"0.0.0.0", "6000-6010", RecorderLimits{Host: "0.0.0.0", MinPort: 6000, MaxPort: 6010}, false},
+		{"::1", "514", RecorderLimits{Host: "::1", MinPort: 514, MaxPort: 514}, false},
+		{"", "6010-6000", RecorderLimits{}, true},
+		{"", "0-100", RecorderLimits{}, true},
+		{"", "6000-70000", RecorderLimits{}, true},
+		{"", "syslog", RecorderLimits{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRecorderLimits(tt.host, tt.ports)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParseRecorderLimits(%q, %q) = %+v, %v; want %+v, error %v", tt.host, tt.ports, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestRecorderLimitsApply(t *testing.T) {
+	limits := RecorderLimits{Host: "127.0.0.1", MinPort: 5500, MaxPort: 5599}
+	tests := []struct {
+		name string
+		cfg  RecorderConfig
+		want RecorderConfig
+		err  string
+	}{
+		{"fills in the host", RecorderConfig{SyslogUDP: ":5514", HEC: ":5588"}, RecorderConfig{SyslogUDP: "127.0.0.1:5514", HEC: "127.0.0.1:5588"}, ""},
+		{"allowed host", RecorderConfig{SyslogTCP: "127.0.0.1:5500"}, RecorderConfig{SyslogTCP: "127.0.0.1:5500"}, ""},
+		{"other host", RecorderConfig{SyslogTCP: "0.0.0.0:5514"}, RecorderConfig{}, "only listen on 127.0.0.1"},
+		{"port below the range", RecorderConfig{SyslogUDP: ":514"}, RecorderConfig{}, "outside the allowed range"},
+		{"port above the range", RecorderConfig{HEC: ":8088"}, RecorderConfig{}, "outside the allowed range"},
+		{"any port", RecorderConfig{HEC: ":0"}, RecorderConfig{}, "outside the allowed range"},
+		{"no port", RecorderConfig{SyslogUDP: "localhost"}, RecorderConfig{}, "invalid syslogUdp address"},
+	}
+	for _, tt := range tests {
+		cfg := tt.cfg
+		err := limits.Apply(&cfg)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: Apply() = %v, want an error mentioning %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || cfg != tt.want {
+			t.Errorf("%s: Apply() = %+v, %v; want %+v", tt.name, cfg, err, tt.want)
+		}
+	}
+}
+
+func testRecorder() *Recorder {
+	return &Recorder{Config: RecorderConfig{MaxEvents: 100}, conns: map[net.Conn]bool{}, stop: make(chan struct{})}
+}
+
+func TestReadSyslogStream(t *testing.T) {
+	long := strings.Repeat("x", syslogMaxMessage+1)
+	tests := []struct {
+		name   string
+		stream string
+		want   []string
+	}{
+		{"newline delimited", "<13>first\n\n<13>second", []string{"first", "second"}},
+		{"octet counted", "9 <13>first10 <13>second", []string{"first", "second"}},
+		{"count too large", "9 <13>first99999999 <13>second", []string{"first"}},
+		{"count never ends", "<13>first\n" + strings.Repeat("9", syslogMaxMessage+1), []string{"first"}},
+		{"line too long", "<13>first\n" + long + "\n<13>second\n", []string{"first"}},
+	}
+	for _, tt := range tests {
+		r := testRecorder()
+		r.readSyslogStream(strings.NewReader(tt.stream), "10.0.0.1")
+		got := []string{}
+		for _, event := range r.events {
+			got = append(got, event.(map[string]interface{})["message"].(string))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: recorded %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// A HEC request with one bad envelope is rejected whole, as Splunk does
+func TestHECRecordsOnlyValidRequests(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		status   int
+		recorded int
+	}{
+		{"events", "/services/collector/event", `{"event":"a"}{"event":"b","time":1}`, http.StatusOK, 2},
+		{"missing event", "/services/collector/event", `{"event":"a"}{"host":"h"}`, http.StatusBadRequest, 0},
+		{"bad JSON", "/services/collector/event", `{"event":"a"}{"event":`, http.StatusBadRequest, 0},
+		{"empty", "/services/collector/event", ``, http.StatusBadRequest, 0},
+		{"raw", "/services/collector/raw?host=h", "a\r\n\nb\n", http.StatusOK, 2},
+	}
+	for _, tt := range tests {
+		r := testRecorder()
+		w := httptest.NewRecorder()
+		r.hecHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+		if w.Code != tt.status || len(r.events) != tt.recorded {
+			t.Errorf("%s: status %d with %d recorded, want %d with %d", tt.name, w.Code, len(r.events), tt.status, tt.recorded)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package capture
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Query is what to capture: a search in the source's own language over a
+// time range in epoch milliseconds, narrowed by structured filters. Events
+// must match every include filter and no exclude filter.
+type Query struct {
+	Search    string   `json:"search"`
+	StartTime int64    `json:"start_time"`
+	EndTime   int64    `json:"end_time"`
+	Include   []Filter `json:"include"`
+	Exclude   []Filter `json:"exclude"`
+}
+
+// Summary describes a capture and how it compares with what the source reported
+type Summary struct {
+	Source    string   `json:"source"`
+	Captured  int      `json:"captured"`
+	Reported  int      `json:"reported"` // -1 when the source gave no total
+	Pages     int      `json:"pages"`
+	Windows   int      `json:"windows"`
+	Truncated bool     `json:"truncated"`
+	Warnings  []string `json:"warnings"`
+}
+
+// Result is a complete capture: scenario events with relative offsets
+// together with its summary
+type Result struct {
+	Hits []interface{} `json:"hits"`
+	Summary
+}
+
+// CaptureSource is a SIEM or log store scenarios can be captured from
+type CaptureSource interface {
+	// Fetch returns every raw hit the query matches, paging through the
+	// time range however the source needs to. summary is filled in as it
+	// goes and report, if set, is called after every page.
+	Fetch(ctx context.Context, q Query, summary *Summary, report func(JobProgress)) ([]interface{}, error)
+	// Normalize turns a raw hit into a scenario event whose @timestamp is an
+	// epoch time EventTime understands. ok is false for hits that aren't events.
+	Normalize(hit interface{}) (event map[string]interface{}, ok bool)
+}
+
+// QueryChecker is implemented by sources that can't run every query, so the
+// ones they can't are turned away before a capture starts
+type QueryChecker interface {
+	CheckQuery(q Query) error
+}
+
+// ValidateQuery checks a query's filters and that the source can run it
+func ValidateQuery(src CaptureSource, q Query) error {
+	if err := q.Validate(); err != nil {
+		return err
+	}
+	if checker, ok := src.(QueryChecker); ok {
+		return checker.CheckQuery(q)
+	}
+	return nil
+}
+
+// SourceConfig is how to reach a source. Options holds the source's own
+// settings, such as Fluency's partition or an Elasticsearch index.
+type SourceConfig struct {
+	URL     string          `json:"url"`
+	Token   string          `json:"token"`
+	Options json.RawMessage `json:"options"`
+}
+
+// SourceFactory creates a source from its configuration
+type SourceFactory func(cfg SourceConfig) (CaptureSource, error)
+
+var (
+	sourcesMu sync.Mutex
+	sources   = map[string]SourceFactory{}
+)
+
+// RegisterSource makes a source available by name
+func RegisterSource(name string, factory SourceFactory) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	sources[name] = factory
+}
+
+// NewSource creates the named source
+func NewSource(name string, cfg SourceConfig) (CaptureSource, error) {
+	sourcesMu.Lock()
+	factory, ok := sources[name]
+	sourcesMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown capture source %q", name)
+	}
+	return factory(cfg)
+}
+
+// SourceNames lists the registered sources
+func SourceNames() []string {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// decodeOptions reads a source's options, leaving defaults alone when none were given
+func decodeOptions(raw json.RawMessage, into interface{}) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw, into); err != nil {
+		return fmt.Errorf("invalid source options: %v", err)
+	}
+	return nil
+}
+
+// Run captures a query from a source and turns the hits into scenario events
+func Run(ctx context.Context, name string, src CaptureSource, q Query, report func(JobProgress)) (Result, error) {
+	if err := ValidateQuery(src, q); err != nil {
+		return Result{}, err
+	}
+	result := Result{Hits: []interface{}{}, Summary: Summary{Source: name, Reported: -1, Warnings: []string{}}}
+	hits, err := src.Fetch(ctx, q, &result.Summary, report)
+	if err != nil {
+		return Result{}, err
+	}
+
+	events := make([]map[string]interface{}, 0, len(hits))
+	skipped := 0
+	for _, hit := range hits {
+		event, ok := src.Normalize(hit)
+		if !ok {
+			skipped++
+			continue
+		}
+		events = append(events, event)
+	}
+	if skipped > 0 {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("skipped %d hits that were not events", skipped))
+	}
+	for _, event := range RelativeOffsets(events) {
+		result.Hits = append(result.Hits, event)
+	}
+
+	result.Captured = len(hits)
+	if result.Reported >= 0 && result.Captured != result.Reported {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("captured %d events but the source reported %d", result.Captured, result.Reported))
+	}
+	fmt.Printf("📦 Captured %d of %d reported events from %s in %d pages over %d windows\n", result.Captured, result.Reported, name, result.Pages, result.Windows)
+	return result, nil
+}
@@ -0,0 +1,165 @@
+package capture
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// splunkRequest is what the fake export endpoint received
+type splunkRequest struct {
+	path string
+	form url.Values
+	auth string
+}
+
+// newTestSplunk serves body from the export endpoint and records each request
+func newTestSplunk(t *testing.T, status int, body string) (*httptest.Server, *splunkRequest) {
+	got := &splunkRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("bad form: %v", err)
+		}
+		got.path, got.form, got.auth = r.URL.Path, r.PostForm, r.Header.Get("Authorization")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, got
+}
+
+func newTestSplunkSource(t *testing.T, server *httptest.Server, token string, opts string) CaptureSource {
+	source, err := NewSplunkSource(SourceConfig{URL: server.URL + "/", Token: token, Options: []byte(opts)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return source
+}
+
+func TestSplunkFetchStreamsResults(t *testing.T) {
+	stream := strings.Join([]string{
+		`{"preview":true,"result":{"_raw":"partial"}}`,
+		`{"preview":false,"result":{"_raw":"one","_time":"2023-11-14T22:13:20.000+00:00","host":"web01","_cd":"1:2"}}`,
+		`{"messages":[{"type":"WARN","text":"search was throttled"}]}`,
+		`{"preview":false,"result":{"_raw":"two","_time":"1700000001"}}`,
+		`{"preview":false,"lastrow":true}`,
+	}, "\n")
+	server, got := newTestSplunk(t, http.StatusOK, stream)
+	source := newTestSplunkSource(t, server, "token", `{}`)
+
+	summary := &Summary{}
+	var progress []JobProgress
+	hits, err := source.Fetch(context.Background(), Query{Search: "index=main error", StartTime: 1700000000000, EndTime: 1700000060500}, summary, func(p JobProgress) {
+		progress = append(progress, p)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.path != "/services/search/jobs/export" {
+		t.Errorf("path = %s", got.path)
+	}
+	if got.auth != "Bearer token" {
+		t.Errorf("Authorization = %q", got.auth)
+	}
+	wantForm := url.Values{
+		"search":        {"search index=main error"},
+		"output_mode":   {"json"},
+		"earliest_time": {"1700000000.000"},
+		"latest_time":   {"1700000060.500"},
+	}
+	if !reflect.DeepEqual(got.form, wantForm) {
+		t.Errorf("form = %v, want %v", got.form, wantForm)
+	}
+
+	if len(hits) != 2 {
+		t.Fatalf("got %d hits, want the 2 final results", len(hits))
+	}
+	if len(summary.Warnings) != 1 || !strings.Contains(summary.Warnings[0], "throttled") {
+		t.Errorf("warnings = %v", summary.Warnings)
+	}
+	if len(progress) == 0 || progress[len(progress)-1].Captured != 2 {
+		t.Errorf("progress = %+v", progress)
+	}
+
+	event, ok := source.Normalize(hits[0])
+	want := map[string]interface{}{"_raw": "one", "host": "web01", "@timestamp": float64(1700000000000)}
+	if !ok || !reflect.DeepEqual(event, want) {
+		t.Errorf("Normalize() = %v, want %v", event, want)
+	}
+}
+
+func TestSplunkFetchStopsAtMaxResults(t *testing.T) {
+	stream := strings.Repeat(`{"preview":false,"result":{"_raw":"x"}}`+"\n", 10)
+	server, _ := newTestSplunk(t, http.StatusOK, stream)
+	source := newTestSplunkSource(t, server, "token", `{"maxResults": 4}`)
+
+	summary := &Summary{}
+	hits, err := source.Fetch(context.Background(), Query{Search: "| tstats count"}, summary, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 4 || !summary.Truncated {
+		t.Errorf("got %d hits, truncated %v; want 4, true", len(hits), summary.Truncated)
+	}
+}
+
+func TestSplunkFetchErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"unauthorized", http.StatusUnauthorized, `{"messages":[{"type":"WARN","text":"call not properly authenticated"}]}`, "HTTP 401"},
+		{"bad search", http.StatusOK, `{"messages":[{"type":"ERROR","text":"Unknown search command 'foo'"}]}`, "Unknown search command"},
+		{"fatal", http.StatusOK, `{"preview":false,"result":{"_raw":"x"}}` + "\n" + `{"messages":[{"type":"FATAL","text":"disk full"}]}`, "disk full"},
+		{"cut off", http.StatusOK, `{"preview":false,"result":{"_raw":`, "failed to read"},
+	}
+	for _, tt := range tests {
+		server, _ := newTestSplunk(t, tt.status, tt.body)
+		source := newTestSplunkSource(t, server, "token", `{}`)
+		_, err := source.Fetch(context.Background(), Query{Search: "index=main"}, &Summary{}, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want it to mention %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestSplunkAuthAndNamespace(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		opts     string
+		wantAuth string
+		wantPath string
+	}{
+		{"session key", "abc", `{"authScheme": "Splunk"}`, "Splunk abc", "/services/search/jobs/export"},
+		{"basic", "", `{"authScheme": "Basic", "username": "admin", "password": "changeme"}`, "Basic YWRtaW46Y2hhbmdlbWU=", "/services/search/jobs/export"},
+		{"app", "abc", `{"app": "search"}`, "Bearer abc", "/servicesNS/-/search/search/jobs/export"},
+		{"app and owner", "abc", `{"app": "my app", "owner": "jdoe"}`, "Bearer abc", "/servicesNS/jdoe/my app/search/jobs/export"},
+	}
+	for _, tt := range tests {
+		server, got := newTestSplunk(t, http.StatusOK, "")
+		source := newTestSplunkSource(t, server, tt.token, tt.opts)
+		if _, err := source.Fetch(context.Background(), Query{Search: "index=main"}, &Summary{}, nil); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got.auth != tt.wantAuth || got.path != tt.wantPath {
+			t.Errorf("%s: sent %q to %s, want %q to %s", tt.name, got.auth, got.path, tt.wantAuth, tt.wantPath)
+		}
+	}
+
+	for _, opts := range []string{`{}`, `{"authScheme": "Basic"}`} {
+		if _, err := NewSplunkSource(SourceConfig{URL: "https://splunk:8089", Options: []byte(opts)}); err == nil {
+			t.Errorf("missing credentials with %s accepted", opts)
+		}
+	}
+	if _, err := NewSplunkSource(SourceConfig{Token: "abc"}); err == nil {
+		t.Error("missing URL accepted")
+	}
+}
@@ -0,0 +1,193 @@
+package capture
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// syslogMaxMessage caps a single syslog message, on either transport
+const syslogMaxMessage = 64 * 1024
+
+var syslogSeverities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// ParseSyslog turns a syslog line into an event. It understands RFC 5424 and
+// the BSD format of RFC 3164; anything else is kept as a bare message.
+func ParseSyslog(line string) map[string]interface{} {
+	line = strings.TrimRight(line, "\r\n\x00")
+	event := map[string]interface{}{"_raw": line, "message": line}
+
+	rest := line
+	if strings.HasPrefix(rest, "<") {
+		end := strings.IndexByte(rest, '>')
+		if end > 1 && end <= 4 {
+			if pri, err := strconv.Atoi(rest[1:end]); err == nil && pri <= 191 {
+				event["facility"] = pri / 8
+				event["severity"] = syslogSeverities[pri%8]
+				rest = rest[end+1:]
+			}
+		}
+	}
+	if _, ok := event["facility"]; !ok {
+		return event
+	}
+
+	if strings.HasPrefix(rest, "1 ") {
+		parseRFC5424(rest[2:], event)
+	} else {
+		parseRFC3164(rest, event)
+	}
+	return event
+}
+
+// parseRFC5424 reads TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+func parseRFC5424(rest string, event map[string]interface{}) {
+	fields := strings.SplitN(rest, " ", 6)
+	if len(fields) < 6 {
+		event["message"] = rest
+		return
+	}
+	names := []string{"syslog_timestamp", "hostname", "app_name", "proc_id", "msg_id"}
+	for i, name := range names {
+		if fields[i] != "-" {
+			event[name] = fields[i]
+		}
+	}
+
+	msg := fields[5]
+	if strings.HasPrefix(msg, "-") {
+		msg = strings.TrimPrefix(msg[1:], " ")
+	} else if strings.HasPrefix(msg, "[") {
+		// Structured data runs to the first ] that isn't escaped and isn't
+		// followed by another element
+		end := -1
+		for i := 1; i < len(msg); i++ {
+			if msg[i] == '\\' {
+				i++
+				continue
+			}
+			if msg[i] == ']' && (i+1 == len(msg) || msg[i+1] != '[') {
+				end = i
+				break
+			}
+		}
+		if end > 0 {
+			event["structured_data"] = msg[:end+1]
+			msg = strings.TrimPrefix(msg[end+1:], " ")
+		}
+	}
+	event["message"] = strings.TrimPrefix(msg, "\ufeff")
+}
+
+// parseRFC3164 reads "Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG"
+func parseRFC3164(rest string, event map[string]interface{}) {
+	if len(rest) >= 16 && rest[3] == ' ' && rest[15] == ' ' {
+		event["syslog_timestamp"] = rest[:15]
+		rest = rest[16:]
+		if host, after, ok := strings.Cut(rest, " "); ok {
+			event["hostname"] = host
+			rest = after
+		}
+	}
+	if tag, msg, ok := strings.Cut(rest, ": "); ok && !strings.Contains(tag, " ") {
+		if name, pid, ok := strings.Cut(tag, "["); ok {
+			event["app_name"] = name
+			event["proc_id"] = strings.TrimSuffix(pid, "]")
+		} else {
+			event["app_name"] = tag
+		}
+		rest = msg
+	}
+	event["message"] = rest
+}
+
+// serveSyslogUDP records one message per datagram until the connection is closed
+func (r *Recorder) serveSyslogUDP(conn net.PacketConn) {
+	buf := make([]byte, syslogMaxMessage)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		for _, line := range strings.Split(strings.TrimRight(string(buf[:n]), "\n"), "\n") {
+			event := ParseSyslog(line)
+			event["input"] = "syslog/udp"
+			event["source_ip"] = hostOf(addr.String())
+			r.record(event)
+		}
+	}
+}
+
+// serveSyslogTCP accepts connections until the listener is closed
+func (r *Recorder) serveSyslogTCP(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		if !r.track(conn) {
+			conn.Close()
+			return
+		}
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			defer r.untrack(conn)
+			r.readSyslogStream(conn, hostOf(conn.RemoteAddr().String()))
+		}()
+	}
+}
+
+// readSyslogStream reads RFC 6587 framed messages: octet counted when a
+// frame starts with a digit, newline delimited otherwise. A frame longer than
+// syslogMaxMessage, or a malformed count, drops the connection.
+func (r *Recorder) readSyslogStream(conn io.Reader, sourceIP string) {
+	reader := bufio.NewReaderSize(conn, syslogMaxMessage)
+	for {
+		first, err := reader.Peek(1)
+		if err != nil {
+			return
+		}
+		var line string
+		if first[0] >= '0' && first[0] <= '9' {
+			// The buffer bounds how far ReadSlice looks for the space
+			count, err := reader.ReadSlice(' ')
+			if err != nil {
+				return
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(string(count)))
+			if err != nil || n <= 0 || n > syslogMaxMessage {
+				return
+			}
+			frame := make([]byte, n)
+			if _, err := io.ReadFull(reader, frame); err != nil {
+				return
+			}
+			line = string(frame)
+		} else {
+			slice, err := reader.ReadSlice('\n')
+			if err == bufio.ErrBufferFull || (err != nil && len(slice) == 0) {
+				return
+			}
+			line = string(slice)
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		event := ParseSyslog(line)
+		event["input"] = "syslog/tcp"
+		event["source_ip"] = sourceIP
+		r.record(event)
+	}
+}
+
+// hostOf strips the port from an address
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
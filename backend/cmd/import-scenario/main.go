@@ -0,0 +1,67 @@
+// Command import-scenario converts exported log files into a scenario file
+// the replay package can play.
+//
+//	import-scenario -format evtx -o scenario.json Security.evtx Sysmon.evtx
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"backend/importer"
+)
+
+func main() {
+	format := flag.String("format", "", "input format: "+strings.Join(importer.Formats(), ", "))
+	output := flag.String("o", "", "scenario file to write (default stdout)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: import-scenario -format FORMAT [-o scenario.json] FILE...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *format == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	files := []importer.File{}
+	for _, name := range flag.Args() {
+		file, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		files = append(files, importer.File{Name: name, Reader: file})
+	}
+
+	result, err := importer.Import(*format, files)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(1)
+	}
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(os.Stderr, "⚠️ %s\n", warning)
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		out = file
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result.Hits); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ failed to write scenario: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,192 @@
+package detect
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Severity is how bad it is for a finding to end up in a stored scenario
+type Severity string
+
+const (
+	SeverityLow    Severity = "low"
+	SeverityMedium Severity = "medium"
+	SeverityHigh   Severity = "high"
+)
+
+// maxFindings caps how many findings a report lists; counts stay exact
+const maxFindings = 500
+
+// Rule finds one kind of sensitive data in string values
+type Rule struct {
+	Name     string
+	Severity Severity
+	Pattern  *regexp.Regexp
+	// Valid, if set, must accept a match for it to count, e.g. a Luhn check
+	Valid func(match string) bool
+	// Confirm, if set, decides from the field path and the text just before
+	// a match whether it is reported at Severity. Unconfirmed matches are
+	// reported at Unconfirmed instead, or dropped when that is empty.
+	Confirm     func(path, before, match string) bool
+	Unconfirmed Severity
+}
+
+// confirmWindow is how much text before a match Confirm gets to see
+const confirmWindow = 32
+
+// RuleSpec is a rule as written in configuration
+type RuleSpec struct {
+	Name     string   `json:"name"`
+	Severity Severity `json:"severity"`
+	Pattern  string   `json:"pattern"`
+}
+
+// Compile turns a configured rule into a Rule
+func (s RuleSpec) Compile() (Rule, error) {
+	if s.Name == "" {
+		return Rule{}, fmt.Errorf("rule has no name")
+	}
+	switch s.Severity {
+	case SeverityLow, SeverityMedium, SeverityHigh:
+	default:
+		return Rule{}, fmt.Errorf("rule %s has unknown severity %q", s.Name, s.Severity)
+	}
+	re, err := regexp.Compile(s.Pattern)
+	if err != nil {
+		return Rule{}, fmt.Errorf("rule %s has a bad pattern: %v", s.Name, err)
+	}
+	return Rule{Name: s.Name, Severity: s.Severity, Pattern: re}, nil
+}
+
+// InternalDomainRule flags host and domain names under the given suffixes,
+// e.g. "corp.example.com"
+func InternalDomainRule(suffixes []string) (Rule, bool) {
+	quoted := []string{}
+	for _, suffix := range suffixes {
+		if suffix = strings.Trim(strings.ToLower(suffix), "."); suffix != "" {
+			quoted = append(quoted, regexp.QuoteMeta(suffix))
+		}
+	}
+	if len(quoted) == 0 {
+		return Rule{}, false
+	}
+	pattern := `(?i)\b(?:[a-z0-9-]+\.)*(?:` + strings.Join(quoted, "|") + `)\b`
+	return Rule{Name: "internal_domain", Severity: SeverityMedium, Pattern: regexp.MustCompile(pattern)}, true
+}
+
+// Finding is one match in one event
+type Finding struct {
+	Record   int      `json:"record"`
+	Path     string   `json:"path"`
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Sample   string   `json:"sample"` // the match with most of it masked
+}
+
+// Report is the result of scanning a batch of events
+type Report struct {
+	Findings  []Finding      `json:"findings"`
+	Counts    map[string]int `json:"counts"`
+	High      int            `json:"high"`
+	Truncated bool           `json:"truncated"`
+}
+
+// Blocking reports whether there are high-severity findings
+func (r Report) Blocking() bool {
+	return r.High > 0
+}
+
+// Detector scans events with a set of rules
+type Detector struct {
+	rules []Rule
+}
+
+// New creates a Detector from the built-in rules plus any extra ones
+func New(extra ...Rule) *Detector {
+	return &Detector{rules: append(DefaultRules(), extra...)}
+}
+
+// Rules lists the rules the detector uses
+func (d *Detector) Rules() []Rule {
+	return d.rules
+}
+
+// Scan walks every string value of every event and reports what the rules match
+func (d *Detector) Scan(events []interface{}) Report {
+	report := Report{Findings: []Finding{}, Counts: map[string]int{}}
+	for i, event := range events {
+		d.walk(i, "", event, &report)
+	}
+	sort.SliceStable(report.Findings, func(a, b int) bool {
+		return severityRank[report.Findings[a].Severity] > severityRank[report.Findings[b].Severity]
+	})
+	return report
+}
+
+var severityRank = map[Severity]int{SeverityLow: 0, SeverityMedium: 1, SeverityHigh: 2}
+
+func (d *Detector) walk(record int, path string, value interface{}, report *Report) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			d.walk(record, childPath, v[key], report)
+		}
+	case []interface{}:
+		for i, child := range v {
+			d.walk(record, fmt.Sprintf("%s[%d]", path, i), child, report)
+		}
+	case string:
+		d.check(record, path, v, report)
+	}
+}
+
+func (d *Detector) check(record int, path, value string, report *Report) {
+	for _, rule := range d.rules {
+		for _, loc := range rule.Pattern.FindAllStringIndex(value, -1) {
+			match := value[loc[0]:loc[1]]
+			if rule.Valid != nil && !rule.Valid(match) {
+				continue
+			}
+			severity := rule.Severity
+			if rule.Confirm != nil && !rule.Confirm(path, value[max(0, loc[0]-confirmWindow):loc[0]], match) {
+				if severity = rule.Unconfirmed; severity == "" {
+					continue
+				}
+			}
+			report.Counts[rule.Name]++
+			if severity == SeverityHigh {
+				report.High++
+			}
+			if len(report.Findings) >= maxFindings {
+				report.Truncated = true
+				continue
+			}
+			report.Findings = append(report.Findings, Finding{
+				Record:   record,
+				Path:     path,
+				Rule:     rule.Name,
+				Severity: severity,
+				Sample:   mask(match),
+			})
+		}
+	}
+}
+
+// mask keeps just enough of a match to recognise it
+func mask(match string) string {
+	if len(match) <= 6 {
+		return strings.Repeat("*", len(match))
+	}
+	return match[:2] + strings.Repeat("*", len(match)-4) + match[len(match)-2:]
+}
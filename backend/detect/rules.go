@@ -0,0 +1,109 @@
+package detect
+
+import (
+	"regexp"
+	"strings"
+)
+
+// DefaultRules are the built-in detectors. Add to them with New or RuleSpec.
+func DefaultRules() []Rule {
+	return []Rule{
+		{Name: "private_key", Severity: SeverityHigh, Pattern: regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |PGP )?PRIVATE KEY( BLOCK)?-----`)},
+		{Name: "aws_access_key", Severity: SeverityHigh, Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+		{Name: "aws_secret_key", Severity: SeverityHigh, Pattern: regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?[A-Za-z0-9/+=]{40}`)},
+		{Name: "gcp_api_key", Severity: SeverityHigh, Pattern: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+		{Name: "azure_storage_key", Severity: SeverityHigh, Pattern: regexp.MustCompile(`(?i)AccountKey=[A-Za-z0-9+/=]{80,}`)},
+		{Name: "github_token", Severity: SeverityHigh, Pattern: regexp.MustCompile(`\b(?:ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36}\b`)},
+		{Name: "slack_token", Severity: SeverityHigh, Pattern: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`)},
+		{Name: "password_assignment", Severity: SeverityHigh, Pattern: regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|secret|api[_-]?key)["']?\s*[:=]\s*["']?[^\s"',;&]{6,}`)},
+		{Name: "jwt", Severity: SeverityMedium, Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\b`)},
+		{Name: "credit_card", Severity: SeverityHigh, Unconfirmed: SeverityMedium, Pattern: regexp.MustCompile(`\b[2-6](?:\d[ -]?){11,17}\d\b`), Valid: validCard, Confirm: cardContext},
+		{Name: "us_ssn", Severity: SeverityHigh, Pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`), Valid: validSSN},
+		{Name: "uk_nino", Severity: SeverityHigh, Pattern: regexp.MustCompile(`\b[A-CEGHJ-PR-TW-Z]{2}\d{6}[A-D]\b`)},
+		{Name: "email", Severity: SeverityMedium, Pattern: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+		{Name: "internal_hostname", Severity: SeverityLow, Pattern: regexp.MustCompile(`(?i)\b[a-z0-9-]+(?:\.[a-z0-9-]+)*\.(?:local|corp|internal|intranet|lan)\b`)},
+	}
+}
+
+// cardRange is a block of issuer identification numbers and the card number
+// lengths issued under it
+type cardRange struct {
+	lo, hi  int // inclusive
+	digits  int // how many leading digits lo and hi cover
+	lengths []int
+}
+
+var cardRanges = []cardRange{
+	{4, 4, 1, []int{13, 16, 19}},             // Visa
+	{51, 55, 2, []int{16}},                   // Mastercard
+	{2221, 2720, 4, []int{16}},               // Mastercard 2-series
+	{34, 34, 2, []int{15}},                   // American Express
+	{37, 37, 2, []int{15}},                   // American Express
+	{300, 305, 3, []int{14, 16, 17, 18, 19}}, // Diners Club
+	{36, 36, 2, []int{14, 16, 17, 18, 19}},   // Diners Club
+	{38, 39, 2, []int{16, 17, 18, 19}},       // Diners Club
+	{3528, 3589, 4, []int{16, 17, 18, 19}},   // JCB
+	{6011, 6011, 4, []int{16, 17, 18, 19}},   // Discover
+	{644, 649, 3, []int{16, 17, 18, 19}},     // Discover
+	{65, 65, 2, []int{16, 17, 18, 19}},       // Discover
+	{62, 62, 2, []int{16, 17, 18, 19}},       // UnionPay
+}
+
+// cardGrouping matches numbers written the way cards print them
+var cardGrouping = regexp.MustCompile(`^(?:\d{4} \d{4} \d{4} \d{4}|\d{4}-\d{4}-\d{4}-\d{4}|\d{4} \d{6} \d{4,5}|\d{4}-\d{6}-\d{4,5})$`)
+
+// cardKeyword is a field name or nearby text that says a number is a card
+var cardKeyword = regexp.MustCompile(`(?i)card|credit|\bcc|\bpan\b|visa|master|amex|payment`)
+
+// validCard accepts numbers in a known card range with the right length and
+// check digit, ignoring spaces and dashes
+func validCard(match string) bool {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(match)
+	known := false
+	for _, r := range cardRanges {
+		if len(digits) < r.digits {
+			continue
+		}
+		prefix := 0
+		for _, c := range digits[:r.digits] {
+			prefix = prefix*10 + int(c-'0')
+		}
+		if prefix >= r.lo && prefix <= r.hi {
+			for _, n := range r.lengths {
+				known = known || len(digits) == n
+			}
+		}
+	}
+	return known && luhn(digits)
+}
+
+// cardContext confirms a card number that is grouped like a printed card or
+// whose field or surrounding text mentions cards. Bare digit runs are more
+// often event, process or record IDs, a tenth of which pass the Luhn check.
+func cardContext(path, before, match string) bool {
+	return cardGrouping.MatchString(match) || cardKeyword.MatchString(path) || cardKeyword.MatchString(before)
+}
+
+// luhn checks the check digit of a string of digits
+func luhn(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// validSSN drops numbers the SSA never issues
+func validSSN(match string) bool {
+	area, group, serial := match[:3], match[4:6], match[7:]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
@@ -0,0 +1,91 @@
+package detect
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// withCheckDigit appends the Luhn check digit to a number
+func withCheckDigit(body string) string {
+	for d := 0; d <= 9; d++ {
+		if n := fmt.Sprintf("%s%d", body, d); luhn(n) {
+			return n
+		}
+	}
+	panic("unreachable")
+}
+
+// cardSeverity scans one field and returns the credit_card finding's severity
+func cardSeverity(field, value string) Severity {
+	report := New().Scan([]interface{}{map[string]interface{}{field: value}})
+	for _, f := range report.Findings {
+		if f.Rule == "credit_card" {
+			return f.Severity
+		}
+	}
+	return ""
+}
+
+func TestCreditCardRule(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		value string
+		want  Severity
+	}{
+		{"visa grouped with spaces", "message", "paid with 4111 1111 1111 1111 today", SeverityHigh},
+		{"visa grouped with dashes", "message", "4111-1111-1111-1111", SeverityHigh},
+		{"amex grouped", "message", "3782 822463 10005", SeverityHigh},
+		{"mastercard in a card field", "payment.card_number", "5555555555554444", SeverityHigh},
+		{"mastercard 2-series near a keyword", "message", "cc=2223003122003222", SeverityHigh},
+		{"discover near a keyword", "message", "Card number: 6011111111111117", SeverityHigh},
+		{"bare card number is only medium", "message", "ref 4111111111111111", SeverityMedium},
+		{"mixed separators are not a printed card", "message", "4111 1111-1111 1111", SeverityMedium},
+		{"failed check digit", "card_number", "4111111111111112", ""},
+		{"unknown issuer range", "card_number", withCheckDigit("500000000000000"), ""},
+		{"wrong length for issuer", "card_number", withCheckDigit("378282246310005"), ""},
+		{"visa with 15 digits", "card_number", withCheckDigit("41111111111111"), ""},
+		{"Luhn-valid ID outside issuer ranges", "ProcessId", withCheckDigit("310000000000000"), ""},
+	}
+	for _, tt := range tests {
+		if got := cardSeverity(tt.field, tt.value); got != tt.want {
+			t.Errorf("%s: %s=%q gave %q, want %q", tt.name, tt.field, tt.value, got, tt.want)
+		}
+	}
+}
+
+// Random numeric IDs pass the Luhn check a tenth of the time; none of them
+// may block an upload unless something says they are card numbers
+func TestCreditCardRuleIgnoresNumericIDs(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	events := []interface{}{}
+	for i := 0; i < 5000; i++ {
+		id := fmt.Sprintf("%d%015d", 2+r.Intn(5), r.Int63n(1e15))
+		events = append(events, map[string]interface{}{"EventRecordID": id, "message": "process " + id + " exited"})
+	}
+	report := New().Scan(events)
+	if report.Blocking() {
+		t.Errorf("numeric IDs produced %d high-severity findings", report.High)
+	}
+}
+
+func TestUSSSNRule(t *testing.T) {
+	tests := []struct {
+		value string
+		found bool
+	}{
+		{"ssn 123-45-6789", true},
+		{"000-12-3456", false},
+		{"666-12-3456", false},
+		{"912-12-3456", false},
+		{"123-00-4567", false},
+		{"123-45-0000", false},
+	}
+	for _, tt := range tests {
+		report := New().Scan([]interface{}{map[string]interface{}{"message": tt.value}})
+		if found := report.Counts["us_ssn"] > 0; found != tt.found {
+			t.Errorf("%q: found = %v, want %v", tt.value, found, tt.found)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"backend/config"
+
+	"firebase.google.com/go/auth"
+)
+
+// unverifiedUser is recorded when a request has no valid Firebase ID token
+const unverifiedUser = "unverified"
+
+// verifyRequest checks the Firebase ID token in the Authorization header
+func verifyRequest(r *http.Request) (*auth.Token, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil, false
+	}
+	return verifyToken(token)
+}
+
+// verifyToken checks a Firebase ID token
+func verifyToken(token string) (*auth.Token, bool) {
+	if token == "" || config.FirebaseApp == nil {
+		return nil, false
+	}
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Auth(ctx)
+	if err != nil {
+		return nil, false
+	}
+	verified, err := client.VerifyIDToken(ctx, token)
+	if err != nil {
+		return nil, false
+	}
+	return verified, true
+}
+
+// verifiedUser works out who made a request from its Firebase ID token. A uid
+// the client merely claims is never trusted, so without a valid token the
+// request is recorded as unverified.
+func verifiedUser(r *http.Request) string {
+	if verified, ok := verifyRequest(r); ok {
+		return verified.UID
+	}
+	return unverifiedUser
+}
+
+// requestAdmin reports whether a request carries a verified Firebase ID token
+// with the admin custom claim, and whose it is. A claimed uid is never enough.
+func requestAdmin(r *http.Request) (string, bool) {
+	verified, ok := verifyRequest(r)
+	if !ok {
+		return "", false
+	}
+	admin, _ := verified.Claims["admin"].(bool)
+	return verified.UID, admin
+}
+
+// ownedBy reports whether a verified user may act on something owner
+// created: the owner themselves, or an admin. Nothing recorded as unverified
+// belongs to anyone but admins.
+func ownedBy(verified *auth.Token, owner string) bool {
+	if admin, _ := verified.Claims["admin"].(bool); admin {
+		return true
+	}
+	return owner != "" && owner != unverifiedUser && verified.UID == owner
+}
+
+// requestOwns reports whether a request carries a verified ID token of the
+// owner or of an admin
+func requestOwns(r *http.Request, owner string) bool {
+	verified, ok := verifyRequest(r)
+	return ok && ownedBy(verified, owner)
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"backend/capture"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	captureJobsOnce sync.Once
+	captureJobs     *capture.Manager
+	captureJobsErr  error
+)
+
+// captureJobManager returns the manager that keeps capture results in the temp directory
+func captureJobManager() (*capture.Manager, error) {
+	captureJobsOnce.Do(func() {
+		captureJobs, captureJobsErr = capture.NewManager(filepath.Join(os.TempDir(), "soctrainer-captures"))
+	})
+	return captureJobs, captureJobsErr
+}
+
+// StartCaptureJobHandler starts a capture in the background and returns its
+// job ID. The job and its result belong to the user who started it.
+func StartCaptureJobHandler(w http.ResponseWriter, r *http.Request) {
+	verified, ok := verifyRequest(r)
+	if !ok {
+		http.Error(w, "Sign in to start a capture", http.StatusForbidden)
+		return
+	}
+
+	var req captureRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	plan, err := req.plan()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	jobs, err := captureJobManager()
+	if err != nil {
+		http.Error(w, "Capture jobs are unavailable", http.StatusInternalServerError)
+		log.Printf("Capture jobs are unavailable: %v", err)
+		return
+	}
+
+	job := jobs.Start(verified.UID, func(ctx context.Context, report func(capture.JobProgress)) ([]interface{}, interface{}, error) {
+		result, err := plan.run(ctx, report)
+		if err != nil {
+			return nil, nil, err
+		}
+		return result.Hits, result.CaptureSummary, nil
+	})
+	log.Printf("📥 %s started capture job %s", verified.UID, job.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// ListCaptureJobsHandler returns the caller's capture jobs, newest first.
+// Admins see every job.
+func ListCaptureJobsHandler(w http.ResponseWriter, r *http.Request) {
+	verified, ok := verifyRequest(r)
+	if !ok {
+		http.Error(w, "Sign in to list capture jobs", http.StatusForbidden)
+		return
+	}
+	jobs, err := captureJobManager()
+	if err != nil {
+		http.Error(w, "Capture jobs are unavailable", http.StatusInternalServerError)
+		return
+	}
+	list := []capture.Job{}
+	for _, job := range jobs.List() {
+		if ownedBy(verified, job.CreatedBy) {
+			list = append(list, job)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// ownCaptureJob looks up the capture job named in the URL and checks the
+// caller started it or is an admin. It writes the error response when not.
+func ownCaptureJob(w http.ResponseWriter, r *http.Request) (*capture.Manager, capture.Job, bool) {
+	verified, ok := verifyRequest(r)
+	if !ok {
+		http.Error(w, "Sign in to use capture jobs", http.StatusForbidden)
+		return nil, capture.Job{}, false
+	}
+	jobs, err := captureJobManager()
+	if err != nil {
+		http.Error(w, "Capture jobs are unavailable", http.StatusInternalServerError)
+		return nil, capture.Job{}, false
+	}
+	job, ok := jobs.Get(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Capture job not found", http.StatusNotFound)
+		return nil, capture.Job{}, false
+	}
+	if !ownedBy(verified, job.CreatedBy) {
+		http.Error(w, "Only the user who started a capture job or an admin can use it", http.StatusForbidden)
+		return nil, capture.Job{}, false
+	}
+	return jobs, job, true
+}
+
+// GetCaptureJobHandler returns a capture job's status and progress
+func GetCaptureJobHandler(w http.ResponseWriter, r *http.Request) {
+	_, job, ok := ownCaptureJob(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// CaptureJobResultHandler returns the events of a completed capture job
+func CaptureJobResultHandler(w http.ResponseWriter, r *http.Request) {
+	jobs, job, ok := ownCaptureJob(w, r)
+	if !ok {
+		return
+	}
+	id := job.ID
+	path, err := jobs.ResultPath(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=capture-%s.json", id))
+	http.ServeFile(w, r, path)
+}
+
+// CancelCaptureJobHandler stops a running capture job
+func CancelCaptureJobHandler(w http.ResponseWriter, r *http.Request) {
+	jobs, job, ok := ownCaptureJob(w, r)
+	if !ok {
+		return
+	}
+	id := job.ID
+	if !jobs.Cancel(id) {
+		http.Error(w, "Capture job not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("🛑 Cancelled capture job %s", id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// captureJobProfile is the sanitization profile a capture job applied, if any
+func captureJobProfile(id string) *AppliedProfile {
+	jobs, err := captureJobManager()
+	if err != nil {
+		return nil
+	}
+	job, ok := jobs.Get(id)
+	if !ok {
+		return nil
+	}
+	summary, ok := job.Summary.(CaptureSummary)
+	if !ok {
+		return nil
+	}
+	return summary.Profile
+}
+
+// CaptureSourcesHandler lists the sources captures can use
+func CaptureSourcesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(capture.SourceNames())
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"backend/capture"
+
+	"github.com/gorilla/mux"
+)
+
+// Capture results are whatever the source returned, so every capture job
+// endpoint turns away requests without a verified ID token
+func TestCaptureJobHandlersRequireSignIn(t *testing.T) {
+	jobs, err := captureJobManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := jobs.Start("alice", func(ctx context.Context, report func(capture.JobProgress)) ([]interface{}, interface{}, error) {
+		return []interface{}{}, nil, nil
+	})
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		body    string
+	}{
+		{"start", StartCaptureJobHandler, http.MethodPost, `{"source": "splunk"}`},
+		{"list", ListCaptureJobsHandler, http.MethodGet, ""},
+		{"get", GetCaptureJobHandler, http.MethodGet, ""},
+		{"result", CaptureJobResultHandler, http.MethodGet, ""},
+		{"cancel", CancelCaptureJobHandler, http.MethodDelete, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(tt.method, "/api/capture/jobs", strings.NewReader(tt.body))
+		r.Header.Set("Authorization", "Bearer not-a-token")
+		r = mux.SetURLVars(r, map[string]string{"id": job.ID})
+		tt.handler(w, r)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, http.StatusForbidden)
+		}
+	}
+	if got, _ := jobs.Get(job.ID); got.Status == capture.JobCancelled {
+		t.Error("job was cancelled without a verified token")
+	}
+}
@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/replay"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// checkpointCollection is the Firestore collection replay checkpoints live in
+const checkpointCollection = "replay_sessions"
+
+// checkpointInterval is the most often a running replay writes its checkpoint.
+// Records acknowledged since the last write are sent again when a replay is
+// resumed after a crash, so delivery is at least once; a clean shutdown
+// flushes every checkpoint first (see FlushCheckpoints).
+const checkpointInterval = 2 * time.Second
+
+// errNotInterrupted is returned when a checkpoint to resume has already been
+// picked up, or was never interrupted
+var errNotInterrupted = errors.New("replay is not interrupted")
+
+// liveCheckpoints holds the latest checkpoint of every replay this process is
+// running, for flushing on shutdown
+var (
+	liveCheckpoints   = map[string]ReplayCheckpoint{}
+	liveCheckpointsMu sync.Mutex
+)
+
+// Checkpoint statuses
+const (
+	CheckpointRunning     = "running"
+	CheckpointInterrupted = "interrupted"
+	CheckpointCompleted   = "completed"
+	CheckpointFailed      = "failed"
+)
+
+// ReplayCheckpoint is everything needed to start a replay, or to pick one up
+// again after a restart from the last acknowledged record. The HEC token is
+// kept by reference: only the profile holding it is stored.
+type ReplayCheckpoint struct {
+	SessionID       string    `firestore:"session_id" json:"session_id"`
+	ScenarioName    string    `firestore:"scenario_name" json:"scenario_name"`
+	ScenarioID      string    `firestore:"scenario_id" json:"scenario_id"`
+	ScenarioVersion string    `firestore:"scenario_version" json:"scenario_version"`
+	StartedBy       string    `firestore:"started_by" json:"started_by"`
+	FileURL         string    `firestore:"file_url" json:"file_url"`
+	HECURL          string    `firestore:"hec_url" json:"hec_url"`
+	ProfileID       string    `firestore:"profile_id" json:"profile_id,omitempty"`
+	HECToken        string    `firestore:"-" json:"-"` // never stored; resolved from ProfileID
+	Anchor          int64     `firestore:"anchor" json:"anchor"`
+	Speed           float64   `firestore:"speed" json:"speed"`
+	Workers         int       `firestore:"workers" json:"workers"`
+	PartitionKey    string    `firestore:"partition_key" json:"partition_key"`
+	Acked           int       `firestore:"acked" json:"acked"`
+	Total           int       `firestore:"total" json:"total"`
+	Status          string    `firestore:"status" json:"status"`
+	Error           string    `firestore:"error" json:"error,omitempty"`
+	StartedAt       time.Time `firestore:"started_at" json:"started_at"`
+	UpdatedAt       time.Time `firestore:"updated_at" json:"updated_at"`
+}
+
+// options turns the stored parameters back into replay options
+func (cp ReplayCheckpoint) options() replay.Options {
+	opts := replay.DefaultOptions
+	if cp.Workers > 0 {
+		opts.Workers = cp.Workers
+	}
+	opts.PartitionKey = cp.PartitionKey
+	opts.Anchor = cp.Anchor
+	opts.Speed = cp.Speed
+	opts.StartAt = cp.Acked
+	return opts
+}
+
+// saveCheckpoint writes a checkpoint to Firestore, replacing any earlier one
+func saveCheckpoint(cp ReplayCheckpoint) error {
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return fmt.Errorf("error initializing Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	cp.UpdatedAt = time.Now()
+	_, err = client.Collection(checkpointCollection).Doc(cp.SessionID).Set(ctx, cp)
+	if err != nil {
+		return fmt.Errorf("error saving checkpoint: %v", err)
+	}
+	return nil
+}
+
+// loadCheckpoint reads the checkpoint of a single session
+func loadCheckpoint(sessionID string) (ReplayCheckpoint, error) {
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return ReplayCheckpoint{}, fmt.Errorf("error initializing Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	doc, err := client.Collection(checkpointCollection).Doc(sessionID).Get(ctx)
+	if err != nil {
+		return ReplayCheckpoint{}, fmt.Errorf("error fetching checkpoint: %v", err)
+	}
+	var cp ReplayCheckpoint
+	if err := doc.DataTo(&cp); err != nil {
+		return ReplayCheckpoint{}, fmt.Errorf("error decoding checkpoint: %v", err)
+	}
+	return cp, nil
+}
+
+// listCheckpoints returns every checkpoint with the given status
+func listCheckpoints(status string) ([]ReplayCheckpoint, error) {
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	query := client.Collection(checkpointCollection).Where("status", "==", status).Documents(ctx)
+	checkpoints := []ReplayCheckpoint{}
+	for {
+		doc, err := query.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error fetching checkpoints: %v", err)
+		}
+		var cp ReplayCheckpoint
+		if err := doc.DataTo(&cp); err != nil {
+			log.Printf("⚠️ Skipping unreadable checkpoint %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+	return checkpoints, nil
+}
+
+// claimCheckpoint flips an interrupted checkpoint to running. The read and
+// write share a transaction, so of two resumes racing for the same replay only
+// one gets to start it.
+func claimCheckpoint(sessionID string) error {
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return fmt.Errorf("error initializing Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	ref := client.Collection(checkpointCollection).Doc(sessionID)
+	return client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return fmt.Errorf("error fetching checkpoint: %v", err)
+		}
+		if status, _ := doc.Data()["status"].(string); status != CheckpointInterrupted {
+			return errNotInterrupted
+		}
+		return tx.Update(ref, []firestore.Update{
+			{Path: "status", Value: CheckpointRunning},
+			{Path: "updated_at", Value: time.Now()},
+		})
+	})
+}
+
+// resolveHEC fills in the HEC destination of a checkpoint from its profile
+func (cp *ReplayCheckpoint) resolveHEC() error {
+	if cp.ProfileID == "" {
+		return fmt.Errorf("replay %s has no profile to take the HEC token from", cp.SessionID)
+	}
+	hecURL, hecToken, err := FetchProfileHEC(cp.ProfileID)
+	if err != nil {
+		return err
+	}
+	cp.HECURL, cp.HECToken = hecURL, hecToken
+	return nil
+}
+
+// MarkInterruptedReplays is called once at startup. Any replay still recorded
+// as running belonged to a previous process, so it is marked interrupted and
+// returned for resuming.
+func MarkInterruptedReplays() ([]ReplayCheckpoint, error) {
+	running, err := listCheckpoints(CheckpointRunning)
+	if err != nil {
+		return nil, err
+	}
+	for i := range running {
+		running[i].Status = CheckpointInterrupted
+		if err := saveCheckpoint(running[i]); err != nil {
+			return nil, err
+		}
+	}
+	return listCheckpoints(CheckpointInterrupted)
+}
+
+// advance folds a progress update into the checkpoint and reports whether the
+// replay has ended, in which case the checkpoint should be written right away
+func (cp *ReplayCheckpoint) advance(progress replay.ReplayProgress) bool {
+	if progress.Total > 0 {
+		cp.Acked = progress.Acked
+		cp.Total = progress.Total
+	}
+	if !progress.Final {
+		return false
+	}
+	switch {
+	case progress.Phase == replay.PhaseDownloading:
+		// Nothing was sent, so the replay can still be resumed once the file is back
+		cp.Status = CheckpointInterrupted
+	case progress.Status == replay.StatusFailed:
+		cp.Status = CheckpointFailed
+	default:
+		cp.Status = CheckpointCompleted
+	}
+	cp.Error = progress.Error
+	return true
+}
+
+// watchCheckpoint keeps a session's checkpoint up to date until the replay ends
+func watchCheckpoint(session *ReplaySession, cp ReplayCheckpoint) {
+	defer func() {
+		liveCheckpointsMu.Lock()
+		delete(liveCheckpoints, cp.SessionID)
+		liveCheckpointsMu.Unlock()
+	}()
+
+	var lastSave time.Time
+	followProgress(session, func(progress replay.ReplayProgress) {
+		final := cp.advance(progress)
+		liveCheckpointsMu.Lock()
+		liveCheckpoints[cp.SessionID] = cp
+		liveCheckpointsMu.Unlock()
+		if !final && time.Since(lastSave) < checkpointInterval {
+			return
+		}
+
+		if err := saveCheckpoint(cp); err != nil {
+			log.Printf("⚠️ Failed to checkpoint replay %s: %v", cp.SessionID, err)
+			return
+		}
+		lastSave = time.Now()
+	})
+}
+
+// FlushCheckpoints is called on shutdown. It writes the latest acknowledged
+// position of every running replay and marks it interrupted, so resuming
+// doesn't send again what was acknowledged since the last periodic write.
+func FlushCheckpoints() {
+	liveCheckpointsMu.Lock()
+	checkpoints := make([]ReplayCheckpoint, 0, len(liveCheckpoints))
+	for _, cp := range liveCheckpoints {
+		checkpoints = append(checkpoints, cp)
+	}
+	liveCheckpointsMu.Unlock()
+
+	for _, cp := range checkpoints {
+		cp.Status = CheckpointInterrupted
+		if err := saveCheckpoint(cp); err != nil {
+			log.Printf("⚠️ Failed to checkpoint replay %s: %v", cp.SessionID, err)
+		}
+	}
+}
+
+// InterruptedReplaysHandler lists replays that stopped because the server went away
+func InterruptedReplaysHandler(w http.ResponseWriter, r *http.Request) {
+	checkpoints, err := listCheckpoints(CheckpointInterrupted)
+	if err != nil {
+		http.Error(w, "Failed to list interrupted replays", http.StatusInternalServerError)
+		log.Printf("Failed to list interrupted replays: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(checkpoints)
+}
+
+// ResumeReplayHandler restarts an interrupted replay from its last acknowledged record
+func ResumeReplayHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	verified, ok := verifyRequest(r)
+	if !ok {
+		http.Error(w, "Sign in to resume a replay", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		SessionID string `json:"session_id"`
+		HECToken  string `json:"hec_token"` // only for replays started without a profile
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SessionID == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if _, running := getReplaySession(req.SessionID); running {
+		http.Error(w, "Replay is already running", http.StatusConflict)
+		return
+	}
+
+	cp, err := loadCheckpoint(req.SessionID)
+	if err != nil {
+		http.Error(w, "Replay checkpoint not found", http.StatusNotFound)
+		return
+	}
+	if !ownedBy(verified, cp.StartedBy) {
+		http.Error(w, "Only the user who started a replay or an admin can resume it", http.StatusForbidden)
+		return
+	}
+	if cp.Status != CheckpointInterrupted {
+		http.Error(w, fmt.Sprintf("Replay is %s, only interrupted replays can be resumed", cp.Status), http.StatusConflict)
+		return
+	}
+
+	if req.HECToken != "" {
+		cp.HECToken = req.HECToken
+	} else if cp.ProfileID != "" && !ownedBy(verified, cp.ProfileID) {
+		http.Error(w, "Only the profile's owner can replay with its HEC token", http.StatusForbidden)
+		return
+	} else if err := cp.resolveHEC(); err != nil {
+		http.Error(w, "Could not resolve the HEC token; send hec_token to resume", http.StatusConflict)
+		log.Printf("Failed to resolve HEC token for replay %s: %v", cp.SessionID, err)
+		return
+	}
+
+	if err := claimCheckpoint(cp.SessionID); err == errNotInterrupted {
+		http.Error(w, "Replay was resumed by another request", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to resume replay", http.StatusInternalServerError)
+		log.Printf("Failed to claim checkpoint %s: %v", cp.SessionID, err)
+		return
+	}
+
+	session := startReplay(cp)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    "Replay resumed successfully",
+		"session_id": session.ID,
+		"resumed_at": cp.Acked,
+	})
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"backend/replay"
+)
+
+func TestCheckpointAdvance(t *testing.T) {
+	downloadFailed := replay.FailedProgress(errors.New("failed to download file: HTTP 503"))
+	downloadFailed.Phase = replay.PhaseDownloading
+
+	tests := []struct {
+		name     string
+		progress replay.ReplayProgress
+		final    bool
+		acked    int
+		status   string
+	}{
+		{"sending", replay.ReplayProgress{Phase: replay.PhaseSending, Acked: 40, Total: 100}, false, 40, CheckpointRunning},
+		{"before the total is known", replay.ReplayProgress{Phase: replay.PhaseDownloading}, false, 10, CheckpointRunning},
+		{"completed", replay.ReplayProgress{Phase: replay.PhaseDone, Final: true, Status: replay.StatusCompleted, Acked: 100, Total: 100}, true, 100, CheckpointCompleted},
+		{"completed with errors", replay.ReplayProgress{Phase: replay.PhaseDone, Final: true, Status: replay.StatusCompletedWithErrors, Acked: 100, Total: 100}, true, 100, CheckpointCompleted},
+		{"every record failed", replay.ReplayProgress{Phase: replay.PhaseFailed, Final: true, Status: replay.StatusFailed, Acked: 100, Total: 100}, true, 100, CheckpointFailed},
+		{"download failed", downloadFailed, true, 10, CheckpointInterrupted},
+	}
+	for _, tt := range tests {
+		cp := ReplayCheckpoint{SessionID: "s1", Acked: 10, Total: 100, Status: CheckpointRunning}
+		final := cp.advance(tt.progress)
+		if final != tt.final || cp.Acked != tt.acked || cp.Status != tt.status || cp.Error != tt.progress.Error {
+			t.Errorf("%s: final = %v, acked = %d, status = %s, error = %q; want %v, %d, %s",
+				tt.name, final, cp.Acked, cp.Status, cp.Error, tt.final, tt.acked, tt.status)
+		}
+	}
+}
+
+// Resuming and replaying with a profile both need a verified caller before
+// anything is looked up
+func TestReplayHandlersRequireSignIn(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+	}{
+		{"resume", ResumeReplayHandler, `{"session_id":"s1"}`},
+		{"replay with a profile", ReplayHandler, `{"profile_id":"alice","scenario_name":"test"}`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer forged")
+		rec := httptest.NewRecorder()
+		tt.handler(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, http.StatusForbidden)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+
+	"backend/detect"
+)
+
+// detectorConfigFile optionally adds rules and internal domains to the built-in detector
+const detectorConfigFile = "config/detector_rules.json"
+
+var (
+	detectorOnce sync.Once
+	detector     *detect.Detector
+)
+
+// sensitiveDataDetector returns the detector, loading detectorConfigFile the first time
+func sensitiveDataDetector() *detect.Detector {
+	detectorOnce.Do(func() {
+		extra := []detect.Rule{}
+		defer func() { detector = detect.New(extra...) }()
+
+		data, err := os.ReadFile(detectorConfigFile)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("⚠️ Could not read %s: %v", detectorConfigFile, err)
+			}
+			return
+		}
+		var cfg struct {
+			Rules           []detect.RuleSpec `json:"rules"`
+			InternalDomains []string          `json:"internal_domains"`
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			log.Printf("⚠️ Could not parse %s: %v", detectorConfigFile, err)
+			return
+		}
+		for _, spec := range cfg.Rules {
+			rule, err := spec.Compile()
+			if err != nil {
+				log.Printf("⚠️ Skipping detector rule: %v", err)
+				continue
+			}
+			extra = append(extra, rule)
+		}
+		if rule, ok := detect.InternalDomainRule(cfg.InternalDomains); ok {
+			extra = append(extra, rule)
+		}
+		log.Printf("🔎 Loaded %d extra detector rules", len(extra))
+	})
+	return detector
+}
+
+// scanEvents reports sensitive data in a batch of events
+func scanEvents(events []interface{}) detect.Report {
+	return sensitiveDataDetector().Scan(events)
+}
+
+// writeFindings responds with an error message and the findings behind it
+func writeFindings(w http.ResponseWriter, status int, message string, report detect.Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":    message,
+		"findings": report,
+	})
+}
+
+// ScanHandler reports sensitive data in inline events or a capture job's result
+func ScanHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Events []interface{} `json:"events"`
+		JobID  string        `json:"job_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	events := req.Events
+	if req.JobID != "" {
+		var err error
+		events, err = loadCaptureResult(req.JobID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scanEvents(events))
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"backend/importer"
+
+	"github.com/gorilla/mux"
+)
+
+// importMaxUpload caps the files of one import request
+const importMaxUpload = 100 << 20
+
+// ImportFormatsHandler lists the file formats scenarios can be imported from
+func ImportFormatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(importer.Formats())
+}
+
+// ImportScenarioHandler converts uploaded log files into one scenario. The
+// events come back for review and are saved through the upload endpoint, so
+// they are sanitized and scanned like any other scenario.
+func ImportScenarioHandler(w http.ResponseWriter, r *http.Request) {
+	format := mux.Vars(r)["format"]
+	if err := r.ParseMultipartForm(importMaxUpload); err != nil {
+		log.Printf("❌ Failed to parse form: %v", err)
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+	headers := r.MultipartForm.File["file"]
+	if len(headers) == 0 {
+		http.Error(w, "No files uploaded", http.StatusBadRequest)
+		return
+	}
+
+	files := make([]importer.File, 0, len(headers))
+	for _, header := range headers {
+		file, err := header.Open()
+		if err != nil {
+			http.Error(w, "Failed to read uploaded file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		files = append(files, importer.File{Name: header.Filename, Reader: file})
+	}
+
+	result, err := importer.Import(format, files)
+	if err != nil {
+		log.Printf("❌ Import of %d %s files failed: %v", len(files), format, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/config"
+	"backend/sanitize"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"google.golang.org/api/iterator"
+)
+
+// profileCollection is the Firestore collection sanitization profiles live
+// in; each profile keeps its history in a "versions" subcollection
+const profileCollection = "sanitization_profiles"
+
+// SanitizationProfile is a named rule set that captures and uploads can use
+type SanitizationProfile struct {
+	ID          string         `firestore:"id" json:"id"`
+	Name        string         `firestore:"name" json:"name"`
+	Description string         `firestore:"description" json:"description"`
+	Version     int            `firestore:"version" json:"version"`
+	Rules       sanitize.Rules `firestore:"rules" json:"rules"`
+	CreatedBy   string         `firestore:"created_by" json:"created_by"`
+	UpdatedBy   string         `firestore:"updated_by" json:"updated_by"`
+	CreatedAt   time.Time      `firestore:"created_at" json:"created_at"`
+	UpdatedAt   time.Time      `firestore:"updated_at" json:"updated_at"`
+}
+
+// ProfileVersion is one saved revision of a profile's rules
+type ProfileVersion struct {
+	Version   int            `firestore:"version" json:"version"`
+	Rules     sanitize.Rules `firestore:"rules" json:"rules"`
+	Note      string         `firestore:"note" json:"note,omitempty"`
+	CreatedBy string         `firestore:"created_by" json:"created_by"`
+	CreatedAt time.Time      `firestore:"created_at" json:"created_at"`
+}
+
+// AppliedProfile records which profile version sanitized a scenario, and at which stage
+type AppliedProfile struct {
+	ID      string `firestore:"id" json:"id"`
+	Name    string `firestore:"name" json:"name"`
+	Version int    `firestore:"version" json:"version"`
+	Stage   string `firestore:"stage" json:"stage"` // "capture" or "upload"
+}
+
+// validateRules checks a rule set without needing a scenario's key
+func validateRules(rules sanitize.Rules) error {
+	_, err := sanitize.New(rules, make([]byte, scenarioKeySize))
+	return err
+}
+
+// listProfiles returns every profile at its current version
+func listProfiles() ([]SanitizationProfile, error) {
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	profiles := []SanitizationProfile{}
+	docs := client.Collection(profileCollection).OrderBy("name", firestore.Asc).Documents(ctx)
+	for {
+		doc, err := docs.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error fetching profiles: %v", err)
+		}
+		var profile SanitizationProfile
+		if err := doc.DataTo(&profile); err != nil {
+			log.Printf("⚠️ Skipping unreadable profile %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, nil
+}
+
+// loadProfile reads a profile at its current version
+func loadProfile(id string) (SanitizationProfile, error) {
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return SanitizationProfile{}, fmt.Errorf("error initializing Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	doc, err := client.Collection(profileCollection).Doc(id).Get(ctx)
+	if err != nil {
+		return SanitizationProfile{}, fmt.Errorf("error fetching profile: %v", err)
+	}
+	var profile SanitizationProfile
+	if err := doc.DataTo(&profile); err != nil {
+		return SanitizationProfile{}, fmt.Errorf("error decoding profile: %v", err)
+	}
+	return profile, nil
+}
+
+// listProfileVersions returns a profile's history, newest first
+func listProfileVersions(id string) ([]ProfileVersion, error) {
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	versions := []ProfileVersion{}
+	docs := client.Collection(profileCollection).Doc(id).Collection("versions").OrderBy("version", firestore.Desc).Documents(ctx)
+	for {
+		doc, err := docs.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error fetching profile versions: %v", err)
+		}
+		var version ProfileVersion
+		if err := doc.DataTo(&version); err != nil {
+			log.Printf("⚠️ Skipping unreadable profile version %s/%s: %v", id, doc.Ref.ID, err)
+			continue
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+// loadProfileVersion reads one version of a profile; version 0 means the current one
+func loadProfileVersion(id string, version int) (SanitizationProfile, error) {
+	profile, err := loadProfile(id)
+	if err != nil || version == 0 || version == profile.Version {
+		return profile, err
+	}
+
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return SanitizationProfile{}, fmt.Errorf("error initializing Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	doc, err := client.Collection(profileCollection).Doc(id).Collection("versions").Doc(strconv.Itoa(version)).Get(ctx)
+	if err != nil {
+		return SanitizationProfile{}, fmt.Errorf("error fetching profile version %d: %v", version, err)
+	}
+	var old ProfileVersion
+	if err := doc.DataTo(&old); err != nil {
+		return SanitizationProfile{}, fmt.Errorf("error decoding profile version: %v", err)
+	}
+	profile.Version = old.Version
+	profile.Rules = old.Rules
+	return profile, nil
+}
+
+// saveProfileVersion stores a profile together with its new version in one transaction
+func saveProfileVersion(profile SanitizationProfile, note string) error {
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return fmt.Errorf("error initializing Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	ref := client.Collection(profileCollection).Doc(profile.ID)
+	version := ProfileVersion{
+		Version:   profile.Version,
+		Rules:     profile.Rules,
+		Note:      note,
+		CreatedBy: profile.UpdatedBy,
+		CreatedAt: profile.UpdatedAt,
+	}
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Set(ref, profile); err != nil {
+			return err
+		}
+		return tx.Create(ref.Collection("versions").Doc(strconv.Itoa(profile.Version)), version)
+	})
+	if err != nil {
+		return fmt.Errorf("error saving profile: %v", err)
+	}
+	return nil
+}
+
+// profileRules resolves the profile a capture or upload asked for and adds
+// any inline rules after it
+func profileRules(profileID string, version int, inline sanitize.Rules, stage string) (sanitize.Rules, *AppliedProfile, error) {
+	if profileID == "" {
+		return inline, nil, nil
+	}
+	profile, err := loadProfileVersion(profileID, version)
+	if err != nil {
+		return sanitize.Rules{}, nil, err
+	}
+	applied := &AppliedProfile{ID: profile.ID, Name: profile.Name, Version: profile.Version, Stage: stage}
+	return profile.Rules.Merge(inline), applied, nil
+}
+
+// ListProfilesHandler returns every sanitization profile
+func ListProfilesHandler(w http.ResponseWriter, r *http.Request) {
+	profiles, err := listProfiles()
+	if err != nil {
+		http.Error(w, "Failed to list profiles", http.StatusInternalServerError)
+		log.Printf("Failed to list profiles: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profiles)
+}
+
+// GetProfileHandler returns a profile, at ?version= if given
+func GetProfileHandler(w http.ResponseWriter, r *http.Request) {
+	version, _ := strconv.Atoi(r.URL.Query().Get("version"))
+	profile, err := loadProfileVersion(mux.Vars(r)["id"], version)
+	if err != nil {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// ListProfileVersionsHandler returns a profile's version history
+func ListProfileVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	versions, err := listProfileVersions(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Failed to list profile versions", http.StatusInternalServerError)
+		log.Printf("Failed to list profile versions: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// profileRequest is the body for creating or changing a profile
+type profileRequest struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Rules       sanitize.Rules `json:"rules"`
+	Note        string         `json:"note"`
+}
+
+// CreateProfileHandler saves a new profile as version 1
+func CreateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	var req profileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if err := validateRules(req.Rules); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	user := verifiedUser(r)
+	profile := SanitizationProfile{
+		ID:          uuid.NewString(),
+		Name:        req.Name,
+		Description: req.Description,
+		Version:     1,
+		Rules:       req.Rules,
+		CreatedBy:   user,
+		UpdatedBy:   user,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := saveProfileVersion(profile, req.Note); err != nil {
+		http.Error(w, "Failed to save profile", http.StatusInternalServerError)
+		log.Printf("Failed to save profile: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(profile)
+}
+
+// UpdateProfileHandler saves changed rules as the next version of a profile
+func UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	profile, err := loadProfile(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	var req profileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if err := validateRules(req.Rules); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Name != "" {
+		profile.Name = req.Name
+	}
+	profile.Description = req.Description
+	profile.Rules = req.Rules
+	profile.Version++
+	profile.UpdatedBy = verifiedUser(r)
+	profile.UpdatedAt = time.Now()
+	if err := saveProfileVersion(profile, req.Note); err != nil {
+		http.Error(w, "Failed to save profile", http.StatusInternalServerError)
+		log.Printf("Failed to save profile %s: %v", profile.ID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
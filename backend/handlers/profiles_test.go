@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"backend/sanitize"
+)
+
+func TestValidateRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules sanitize.Rules
+		ok    bool
+	}{
+		{"empty", sanitize.Rules{}, true},
+		{"drop and set", sanitize.Rules{Drop: []string{"user.password"}, Set: []sanitize.SetRule{{Field: "host.name", Replace: "redacted"}}}, true},
+		{"pseudonymize", sanitize.Rules{Pseudonymize: []sanitize.PseudonymRule{{Field: "user.name", Type: sanitize.EntityUser}}}, true},
+		{"hash without a scenario", sanitize.Rules{Actions: []sanitize.FieldAction{{Path: "user.email", Action: sanitize.ActionHash}}}, true},
+		{"anonymize every IP", sanitize.Rules{AnonymizeIPs: sanitize.IPAnonymizeRule{All: true}}, true},
+		{"bad path", sanitize.Rules{Drop: []string{"a..b"}}, false},
+		{"unknown entity type", sanitize.Rules{Pseudonymize: []sanitize.PseudonymRule{{Field: "x", Type: "ssn"}}}, false},
+		{"unknown action", sanitize.Rules{Actions: []sanitize.FieldAction{{Path: "x", Action: "shred"}}}, false},
+		{"truncate without a length", sanitize.Rules{Actions: []sanitize.FieldAction{{Path: "x", Action: sanitize.ActionTruncate}}}, false},
+		{"bad regular expression", sanitize.Rules{Actions: []sanitize.FieldAction{{Path: "x", Action: sanitize.ActionReplace, Pattern: "("}}}, false},
+		{"empty find", sanitize.Rules{Replace: []sanitize.ReplaceRule{{Find: "", Replace: "x"}}}, false},
+	}
+	for _, tt := range tests {
+		if err := validateRules(tt.rules); (err == nil) != tt.ok {
+			t.Errorf("%s: validateRules() = %v, want ok = %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+// Without a profile the inline rules are used as they are and nothing is recorded
+func TestProfileRulesWithoutProfile(t *testing.T) {
+	inline := sanitize.Rules{Drop: []string{"user.password"}}
+	rules, applied, err := profileRules("", 0, inline, "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != nil {
+		t.Errorf("applied = %+v, want nil", applied)
+	}
+	if !reflect.DeepEqual(rules, inline) {
+		t.Errorf("rules = %+v, want %+v", rules, inline)
+	}
+}
+
+// Bad requests are turned away before anything is stored
+func TestCreateProfileHandlerRejectsBadRequests(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"not JSON", `{`},
+		{"no name", `{"rules": {"drop": ["user.password"]}}`},
+		{"bad rules", `{"name": "pii", "rules": {"drop": ["a..b"]}}`},
+		{"unknown action", `{"name": "pii", "rules": {"actions": [{"path": "x", "action": "shred"}]}}`},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/sanitize/profiles", strings.NewReader(tt.body))
+		CreateProfileHandler(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+
+	"backend/capture"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+var (
+	recordersMu sync.Mutex
+	recorders   = map[string]*capture.Recorder{}
+)
+
+// recordRequest starts a recording. The capture fields pick the
+// sanitization profile and rules applied when it is saved.
+type recordRequest struct {
+	captureRequest
+	Recorder capture.RecorderConfig `json:"recorder"`
+}
+
+// RecorderSession is a recording and the capture job that will hold its events
+type RecorderSession struct {
+	ID       string            `json:"id"`
+	Listen   map[string]string `json:"listen"`
+	HECToken string            `json:"hecToken,omitempty"`
+	Received int               `json:"received"`
+	Job      capture.Job       `json:"job"`
+}
+
+// recorderSession describes a running recorder
+func recorderSession(id string, rec *capture.Recorder) RecorderSession {
+	session := RecorderSession{ID: id, Listen: rec.Addrs(), HECToken: rec.Config.HECToken, Received: rec.Count()}
+	if jobs, err := captureJobManager(); err == nil {
+		session.Job, _ = jobs.Get(id)
+	}
+	return session
+}
+
+// recorderLimits reads where recorders may listen from RECORDER_HOST and
+// RECORDER_PORTS, e.g. "0.0.0.0" and "5500-5599"
+func recorderLimits() (capture.RecorderLimits, error) {
+	return capture.ParseRecorderLimits(os.Getenv("RECORDER_HOST"), os.Getenv("RECORDER_PORTS"))
+}
+
+// StartRecorderHandler opens the requested listeners and records what they
+// receive as a capture job. The job completes when the recorder is stopped,
+// and its result is a scenario with relative offsets like any other capture.
+// Syslog senders are not authenticated, so only admins may open listeners,
+// and only on the configured host and ports.
+func StartRecorderHandler(w http.ResponseWriter, r *http.Request) {
+	admin, ok := requestAdmin(r)
+	if !ok {
+		http.Error(w, "Only an admin can start a recorder", http.StatusForbidden)
+		return
+	}
+
+	var req recordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	limits, err := recorderLimits()
+	if err != nil {
+		http.Error(w, "Recorders are misconfigured", http.StatusInternalServerError)
+		log.Printf("Recorders are misconfigured: %v", err)
+		return
+	}
+	if err := limits.Apply(&req.Recorder); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jobs, err := captureJobManager()
+	if err != nil {
+		http.Error(w, "Capture jobs are unavailable", http.StatusInternalServerError)
+		log.Printf("Capture jobs are unavailable: %v", err)
+		return
+	}
+	sanitizer, applied, err := req.sanitizer()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Recorder.HEC != "" && req.Recorder.HECToken == "" {
+		req.Recorder.HECToken = uuid.NewString()
+	}
+	rec, err := capture.NewRecorder(req.Recorder)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	plan := capturePlan{sourceName: "recorder", source: rec, sanitizer: sanitizer, profile: applied}
+	ready := make(chan struct{})
+	var id string
+	job := jobs.Start(admin, func(ctx context.Context, report func(capture.JobProgress)) ([]interface{}, interface{}, error) {
+		<-ready
+		defer func() {
+			recordersMu.Lock()
+			delete(recorders, id)
+			recordersMu.Unlock()
+		}()
+		result, err := plan.run(ctx, report)
+		if err != nil {
+			return nil, nil, err
+		}
+		return result.Hits, result.CaptureSummary, nil
+	})
+	id = job.ID
+	recordersMu.Lock()
+	recorders[id] = rec
+	recordersMu.Unlock()
+	close(ready)
+	log.Printf("🎙️ %s started recorder %s on %v", admin, id, rec.Addrs())
+
+	session := RecorderSession{ID: id, Listen: rec.Addrs(), HECToken: rec.Config.HECToken, Job: job}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(session)
+}
+
+// ListRecordersHandler returns the recorders that are still listening. Their
+// HEC tokens are included, so only admins may list them.
+func ListRecordersHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		http.Error(w, "Only an admin can list recorders", http.StatusForbidden)
+		return
+	}
+
+	recordersMu.Lock()
+	list := make([]RecorderSession, 0, len(recorders))
+	for id, rec := range recorders {
+		list = append(list, recorderSession(id, rec))
+	}
+	recordersMu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Job.CreatedAt.After(list[j].Job.CreatedAt) })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// StopRecorderHandler stops a recorder. Its capture job then completes and
+// the recording is fetched from the job's result.
+func StopRecorderHandler(w http.ResponseWriter, r *http.Request) {
+	admin, ok := requestAdmin(r)
+	if !ok {
+		http.Error(w, "Only an admin can stop a recorder", http.StatusForbidden)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	recordersMu.Lock()
+	rec, ok := recorders[id]
+	recordersMu.Unlock()
+	if !ok {
+		http.Error(w, "Recorder not found", http.StatusNotFound)
+		return
+	}
+	session := recorderSession(id, rec)
+	rec.Stop()
+	log.Printf("⏹️ %s stopped recorder %s after %d events", admin, id, session.Received)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(session)
+}
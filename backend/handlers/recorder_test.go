@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// Recorders open unauthenticated listeners, so every recorder endpoint turns
+// away requests without an admin's ID token
+func TestRecorderHandlersRequireAdmin(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		body    string
+	}{
+		{"start", StartRecorderHandler, http.MethodPost, `{"recorder": {"syslogUdp": ":5514"}}`},
+		{"list", ListRecordersHandler, http.MethodGet, ""},
+		{"stop", StopRecorderHandler, http.MethodPost, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(tt.method, "/api/recorder", strings.NewReader(tt.body))
+		r.Header.Set("Authorization", "Bearer not-a-token")
+		r = mux.SetURLVars(r, map[string]string{"id": "missing"})
+		tt.handler(w, r)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, http.StatusForbidden)
+		}
+	}
+}
@@ -5,24 +5,40 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
-	"path/filepath"
+	"strconv"
+	"time"
+
 	"backend/config"
 	"backend/replay"
 
 	"google.golang.org/api/iterator"
 )
 
-// Global channel for progress updates
-var progressChan chan replay.ReplayProgress
+// previewDefaultLimit is how many records a preview returns when no limit is given
+const previewDefaultLimit = 20
 
-// FetchScenarioFile retrieves the scenario file URL from Firestore
-func FetchScenarioFile(scenarioName string) (string, error) {
+// sseHeartbeat is how often an idle progress stream gets a comment line so
+// proxies don't close it
+var sseHeartbeat = 15 * time.Second
+
+// ScenarioRef identifies the exact scenario file a replay used
+type ScenarioRef struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	FileURL string `json:"file_url"`
+	Version string `json:"version"`
+}
+
+// FetchScenario looks a scenario up by name in Firestore. The version is the
+// document's "version" field when set, otherwise its last update time.
+func FetchScenario(scenarioName string) (ScenarioRef, error) {
 	ctx := context.Background()
 	client, err := config.FirebaseApp.Firestore(ctx) // ✅ Assign both values
 	if err != nil {
-		return "", fmt.Errorf("error initializing Firestore client: %v", err)
+		return ScenarioRef{}, fmt.Errorf("error initializing Firestore client: %v", err)
 	}
 	defer client.Close()
 
@@ -35,16 +51,29 @@ func FetchScenarioFile(scenarioName string) (string, error) {
 			break
 		}
 		if err != nil {
-			return "", fmt.Errorf("error fetching scenario: %v", err)
+			return ScenarioRef{}, fmt.Errorf("error fetching scenario: %v", err)
 		}
 
 		scenarioData := doc.Data()
 		if fileURL, ok := scenarioData["stream"].(string); ok {
-			return fileURL, nil
+			version := doc.UpdateTime.UTC().Format(time.RFC3339)
+			if v, ok := scenarioData["version"]; ok {
+				version = fmt.Sprint(v)
+			}
+			return ScenarioRef{ID: doc.Ref.ID, Name: scenarioName, FileURL: fileURL, Version: version}, nil
 		}
 	}
 
-	return "", fmt.Errorf("scenario not found")
+	return ScenarioRef{}, fmt.Errorf("scenario not found")
+}
+
+// FetchScenarioFile retrieves the scenario file URL from Firestore
+func FetchScenarioFile(scenarioName string) (string, error) {
+	scenario, err := FetchScenario(scenarioName)
+	if err != nil {
+		return "", err
+	}
+	return scenario.FileURL, nil
 }
 
 // DownloadFile downloads a file from Firebase Storage
@@ -55,8 +84,12 @@ func DownloadFile(fileURL string) (string, error) {
 	}
 	defer resp.Body.Close()
 
-	tempFilePath := filepath.Join(os.TempDir(), "scenario.json")
-	file, err := os.Create(tempFilePath)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download file: HTTP %d", resp.StatusCode)
+	}
+
+	// Each download gets its own file so concurrent replays and previews don't clobber each other
+	file, err := os.CreateTemp("", "scenario-*.json")
 	if err != nil {
 		return "", fmt.Errorf("failed to create temp file: %v", err)
 	}
@@ -64,10 +97,11 @@ func DownloadFile(fileURL string) (string, error) {
 
 	_, err = io.Copy(file, resp.Body)
 	if err != nil {
+		os.Remove(file.Name())
 		return "", fmt.Errorf("failed to save scenario file: %v", err)
 	}
 
-	return tempFilePath, nil
+	return file.Name(), nil
 }
 
 // ReplayHandler starts a replay using Firebase Storage URL
@@ -78,9 +112,14 @@ func ReplayHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		HECToken     string `json:"hec_token"`
-		HECURL       string `json:"hec_url"`
-		ScenarioName string `json:"scenario_name"`
+		ProfileID    string  `json:"profile_id"` // profile holding the HEC URL and token
+		HECToken     string  `json:"hec_token"`  // Optional, used when no profile is given
+		HECURL       string  `json:"hec_url"`
+		ScenarioName string  `json:"scenario_name"`
+		Workers      int     `json:"workers"`       // Optional, concurrent HEC senders
+		PartitionKey string  `json:"partition_key"` // Optional, field that keeps per-key order
+		Anchor       int64   `json:"anchor"`        // Optional, unix ms the scenario starts at
+		Speed        float64 `json:"speed"`         // Optional, playback multiplier; 0 sends unpaced
 	}
 
 	err := json.NewDecoder(r.Body).Decode(&req)
@@ -89,40 +128,215 @@ func ReplayHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A profile's HEC token is only for its owner
+	if req.ProfileID != "" && !requestOwns(r, req.ProfileID) {
+		http.Error(w, "Only the profile's owner can replay with its HEC token", http.StatusForbidden)
+		return
+	}
+
 	// Fetch scenario file URL from Firestore
+	scenario, err := FetchScenario(req.ScenarioName)
+	if err != nil {
+		http.Error(w, "Scenario not found in Firestore", http.StatusNotFound)
+		return
+	}
+
+	// Take the HEC destination from the profile so only the reference is stored
+	if req.ProfileID != "" {
+		hecURL, hecToken, err := FetchProfileHEC(req.ProfileID)
+		if err != nil {
+			http.Error(w, "Profile has no HEC URL or token", http.StatusBadRequest)
+			return
+		}
+		req.HECURL, req.HECToken = hecURL, hecToken
+	}
+
+	// Pin the anchor now so a resumed replay produces the same timestamps
+	anchor := req.Anchor
+	if anchor == 0 {
+		anchor = time.Now().UnixMilli()
+	}
+
+	session := startReplay(ReplayCheckpoint{
+		ScenarioName:    req.ScenarioName,
+		ScenarioID:      scenario.ID,
+		ScenarioVersion: scenario.Version,
+		StartedBy:       verifiedUser(r),
+		FileURL:         scenario.FileURL,
+		HECURL:          req.HECURL,
+		ProfileID:       req.ProfileID,
+		HECToken:        req.HECToken,
+		Anchor:          anchor,
+		Speed:           req.Speed,
+		Workers:         req.Workers,
+		PartitionKey:    req.PartitionKey,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Replay started successfully", "session_id": session.ID})
+}
+
+// startReplay creates a session and runs the replay described by cp in the
+// background, checkpointing as it goes. A checkpoint with a SessionID and
+// Acked position resumes that session.
+func startReplay(cp ReplayCheckpoint) *ReplaySession {
+	opts := cp.options()
+	resumed := cp.SessionID != ""
+
+	// Start a new progress channel; the session broadcasts it to every subscriber
+	progress := make(chan replay.ReplayProgress)
+	session := newReplaySession(cp.SessionID, cp.ScenarioName, cp.StartedBy, opts.Speed, progress)
+
+	cp.SessionID = session.ID
+	cp.Status = CheckpointRunning
+	if cp.StartedAt.IsZero() {
+		cp.StartedAt = session.StartedAt
+	}
+	if err := saveCheckpoint(cp); err != nil {
+		log.Printf("⚠️ Failed to checkpoint replay %s: %v", cp.SessionID, err)
+	}
+	go watchCheckpoint(session, cp)
+	go recordRun(session, cp)
+
+	// Start replay in a goroutine
+	go func() {
+		progress <- replay.ReplayProgress{Phase: replay.PhaseDownloading, Acked: cp.Acked, Total: cp.Total}
+
+		// Download scenario file locally
+		localFilePath, err := DownloadFile(cp.FileURL)
+		if err != nil {
+			fmt.Println("Error downloading scenario file:", err)
+			failed := replay.FailedProgress(err)
+			if resumed {
+				// Keeps the checkpoint interrupted so the resume can be tried again
+				failed.Phase = replay.PhaseDownloading
+			}
+			progress <- failed
+			close(progress)
+			return
+		}
+		defer os.Remove(localFilePath)
+
+		replay.ReplayRecordsWithOptions(localFilePath, cp.HECURL, cp.HECToken, opts, session.Control, progress)
+	}()
+
+	return session
+}
+
+// PreviewHandler shows what a replay would send without sending anything
+func PreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		HECToken     string  `json:"hec_token"`
+		HECURL       string  `json:"hec_url"`
+		ScenarioName string  `json:"scenario_name"`
+		Anchor       int64   `json:"anchor"` // Optional, unix ms the scenario starts at
+		Speed        float64 `json:"speed"`  // Optional, playback multiplier; 0 sends unpaced
+		Limit        int     `json:"limit"`  // Optional, number of records to return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.Limit <= 0 {
+		req.Limit = previewDefaultLimit
+	}
+
 	fileURL, err := FetchScenarioFile(req.ScenarioName)
 	if err != nil {
 		http.Error(w, "Scenario not found in Firestore", http.StatusNotFound)
 		return
 	}
 
-	// Download scenario file locally
 	localFilePath, err := DownloadFile(fileURL)
 	if err != nil {
 		http.Error(w, "Failed to download scenario file", http.StatusInternalServerError)
 		return
 	}
+	defer os.Remove(localFilePath)
 
-	// Start a new progress channel
-	progressChan = make(chan replay.ReplayProgress)
-
-	// Start replay in a goroutine
-	go replay.ReplayRecords(localFilePath, req.HECURL, req.HECToken, progressChan)
+	preview, err := replay.PreviewRecords(localFilePath, replay.TimingOptions{Anchor: req.Anchor, Speed: req.Speed}, req.Limit)
+	if err != nil {
+		http.Error(w, "Failed to read scenario file", http.StatusInternalServerError)
+		log.Printf("Failed to preview scenario %q: %v", req.ScenarioName, err)
+		return
+	}
+	if req.HECURL == "" || req.HECToken == "" {
+		preview.Schedule.Warnings = append(preview.Schedule.Warnings, "HEC URL or token is empty; a real replay would fail")
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Replay started successfully"})
+	json.NewEncoder(w).Encode(preview)
 }
 
-// ProgressHandler streams replay progress using SSE
+// ProgressHandler streams replay progress using SSE. Any number of clients may
+// subscribe to a session; reconnecting clients send Last-Event-ID and receive
+// the updates they missed.
 func ProgressHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := getReplaySession(r.URL.Query().Get("session"))
+	if !ok {
+		http.Error(w, "Replay session not found", http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("lastEventId")
+	}
+	var lastEventID int64
+	if lastID != "" {
+		parsed, err := strconv.ParseInt(lastID, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastEventID = parsed
+	}
+
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
-	flusher, _ := w.(http.Flusher)
-	for progress := range progressChan {
-		progressJSON, _ := json.Marshal(progress)
-		fmt.Fprintf(w, "data: %s\n\n", progressJSON)
-		flusher.Flush()
+	backlog, events, cancel := session.Progress.Subscribe(lastEventID)
+	defer cancel()
+
+	writeEvent := func(event replay.ProgressEvent) {
+		progressJSON, _ := json.Marshal(event.Progress)
+		fmt.Fprintf(w, "id: %d\ndata: %s\n\n", event.ID, progressJSON)
+	}
+
+	for _, event := range backlog {
+		writeEvent(event)
 	}
-}
\ No newline at end of file
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			writeEvent(event)
+			flusher.Flush()
+		}
+	}
+}
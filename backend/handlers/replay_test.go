@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/replay"
+)
+
+// readSSE collects the lines of a progress stream until it ends
+func readSSE(t *testing.T, url, lastEventID string) []string {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	lines := []string{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestProgressHandlerResumesAndHeartbeats(t *testing.T) {
+	defer func(interval time.Duration) { sseHeartbeat = interval }(sseHeartbeat)
+	sseHeartbeat = 20 * time.Millisecond
+
+	progress := make(chan replay.ReplayProgress)
+	session := newReplaySession("", "test", "alice", 0, progress)
+	defer removeReplaySession(session.ID)
+	progress <- replay.ReplayProgress{Rec: 1}
+	progress <- replay.ReplayProgress{Rec: 2}
+
+	server := httptest.NewServer(http.HandlerFunc(ProgressHandler))
+	defer server.Close()
+	go func() {
+		// Quiet long enough for a heartbeat, then finish
+		time.Sleep(100 * time.Millisecond)
+		progress <- replay.ReplayProgress{Rec: 3, Final: true}
+		close(progress)
+	}()
+	lines := readSSE(t, server.URL+"?session="+session.ID, "1")
+
+	ids, heartbeats, final := []string{}, 0, false
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			ids = append(ids, strings.TrimPrefix(line, "id: "))
+		case line == ": heartbeat":
+			heartbeats++
+		case strings.Contains(line, `"final":true`):
+			final = true
+		}
+	}
+	if strings.Join(ids, ",") != "2,3" {
+		t.Errorf("event IDs after Last-Event-ID 1 = %v, want 2,3", ids)
+	}
+	if heartbeats == 0 {
+		t.Error("no heartbeat while the stream was idle")
+	}
+	if !final {
+		t.Errorf("stream %q has no final event", lines)
+	}
+}
+
+func TestProgressHandlerErrors(t *testing.T) {
+	progress := make(chan replay.ReplayProgress)
+	session := newReplaySession("", "test", "alice", 0, progress)
+	defer func() { close(progress); removeReplaySession(session.ID) }()
+
+	tests := []struct {
+		session     string
+		lastEventID string
+		want        int
+	}{
+		{"missing", "", http.StatusNotFound},
+		{session.ID, "not-a-number", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/api/replay/progress?session="+tt.session, nil)
+		r.Header.Set("Last-Event-ID", tt.lastEventID)
+		ProgressHandler(w, r)
+		if w.Code != tt.want {
+			t.Errorf("session %q with Last-Event-ID %q: status %d, want %d", tt.session, tt.lastEventID, w.Code, tt.want)
+		}
+	}
+}
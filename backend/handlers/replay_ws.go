@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/replay"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsPingInterval keeps idle control connections alive through proxies
+const wsPingInterval = 15 * time.Second
+
+// wsWriteTimeout bounds how long a single message write may take
+const wsWriteTimeout = 5 * time.Second
+
+// wsMaxMessage caps a control message from the client; commands are tiny
+const wsMaxMessage = 4096
+
+// Close reasons: a normal close means the replay is over, try-again-later
+// means the client fell behind and should reconnect
+const (
+	wsStreamEnded = "replay stream ended"
+	wsFellBehind  = "client fell behind, reconnect"
+)
+
+// allowedWebSocketOrigins mirrors the CORS origins configured in main.go
+var allowedWebSocketOrigins = map[string]bool{
+	"http://localhost:8888": true,
+}
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		return origin == "" || allowedWebSocketOrigins[origin]
+	},
+}
+
+// ReplayCommand is a control message sent by the UI over the WebSocket
+type ReplayCommand struct {
+	Command string  `json:"command"` // pause, resume, speed or seek
+	Speed   float64 `json:"speed"`   // for speed
+	Index   int     `json:"index"`   // for seek, the next record to send
+}
+
+// ReplayMessage is what the server sends over the WebSocket
+type ReplayMessage struct {
+	Type     string                 `json:"type"` // progress, ack or error
+	ID       int64                  `json:"id,omitempty"`
+	Progress *replay.ReplayProgress `json:"progress,omitempty"`
+	Command  string                 `json:"command,omitempty"`
+	Control  *replay.ControlState   `json:"control,omitempty"`
+	Error    string                 `json:"error,omitempty"`
+}
+
+// applyReplayCommand runs a single command against a session's controls
+func applyReplayCommand(control *replay.Controller, cmd ReplayCommand) error {
+	switch cmd.Command {
+	case "pause":
+		control.Pause()
+	case "resume":
+		control.Resume()
+	case "speed":
+		return control.SetSpeed(cmd.Speed)
+	case "seek":
+		return control.Seek(cmd.Index)
+	default:
+		return fmt.Errorf("unknown command %q", cmd.Command)
+	}
+	return nil
+}
+
+// ReplaySocketHandler is a bidirectional control channel for one replay session.
+// The client receives the same progress events as the SSE stream and may send
+// pause, resume, speed and seek commands. Only the user who started the replay
+// or an admin may connect; browsers can't set headers on a WebSocket, so the
+// ID token may also come in the token query parameter.
+func ReplaySocketHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := getReplaySession(r.URL.Query().Get("session"))
+	if !ok {
+		http.Error(w, "Replay session not found", http.StatusNotFound)
+		return
+	}
+	verified, ok := verifyRequest(r)
+	if !ok {
+		verified, ok = verifyToken(r.URL.Query().Get("token"))
+	}
+	if !ok || !ownedBy(verified, session.StartedBy) {
+		http.Error(w, "Only the user who started this replay can control it", http.StatusForbidden)
+		return
+	}
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("❌ WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(wsMaxMessage)
+
+	// Only this goroutine writes; the reader hands its replies over. The
+	// request context isn't cancelled once the connection is hijacked, so the
+	// reader watches done to stop when this loop returns.
+	replies := make(chan ReplayMessage, 8)
+	readerDone := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(readerDone)
+		for {
+			var cmd ReplayCommand
+			if err := conn.ReadJSON(&cmd); err != nil {
+				return
+			}
+			reply := ReplayMessage{Type: "ack", Command: cmd.Command}
+			if err := applyReplayCommand(session.Control, cmd); err != nil {
+				reply = ReplayMessage{Type: "error", Command: cmd.Command, Error: err.Error()}
+			} else {
+				state := session.Control.State()
+				reply.Control = &state
+			}
+			select {
+			case replies <- reply:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// Start from the latest event; anything published since comes in the backlog
+	latest, hasLatest := session.Progress.Latest()
+	backlog, events, cancel := session.Progress.Subscribe(latest.ID)
+	defer cancel()
+	if hasLatest {
+		backlog = append([]replay.ProgressEvent{latest}, backlog...)
+	}
+	var sentID int64
+	for _, event := range backlog {
+		sentID = event.ID
+		if err := writeReplayMessage(conn, ReplayMessage{Type: "progress", ID: event.ID, Progress: &event.Progress}); err != nil {
+			return
+		}
+	}
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		var msg ReplayMessage
+		select {
+		case <-readerDone:
+			return
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+			continue
+		case msg = <-replies:
+		case event, ok := <-events:
+			if !ok {
+				// This client fell behind while the replay is still running; it
+				// should reconnect rather than treat the replay as over
+				if !session.Progress.Done() {
+					conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, wsFellBehind), time.Now().Add(wsWriteTimeout))
+					return
+				}
+				if latest, ok := session.Progress.Latest(); ok && latest.Progress.Final && latest.ID > sentID {
+					writeReplayMessage(conn, ReplayMessage{Type: "progress", ID: latest.ID, Progress: &latest.Progress})
+				}
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, wsStreamEnded), time.Now().Add(wsWriteTimeout))
+				return
+			}
+			msg = ReplayMessage{Type: "progress", ID: event.ID, Progress: &event.Progress}
+			sentID = event.ID
+		}
+		if err := writeReplayMessage(conn, msg); err != nil {
+			return
+		}
+	}
+}
+
+func writeReplayMessage(conn *websocket.Conn, msg ReplayMessage) error {
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return conn.WriteJSON(msg)
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"backend/replay"
+)
+
+func TestApplyReplayCommand(t *testing.T) {
+	control := replay.NewController(1)
+	tests := []struct {
+		cmd  ReplayCommand
+		ok   bool
+		want replay.ControlState
+	}{
+		{ReplayCommand{Command: "pause"}, true, replay.ControlState{Paused: true, Speed: 1}},
+		{ReplayCommand{Command: "speed", Speed: 3}, true, replay.ControlState{Paused: true, Speed: 3}},
+		{ReplayCommand{Command: "speed", Speed: -1}, false, replay.ControlState{Paused: true, Speed: 3}},
+		{ReplayCommand{Command: "resume"}, true, replay.ControlState{Speed: 3}},
+		{ReplayCommand{Command: "seek", Index: -4}, false, replay.ControlState{Speed: 3}},
+		{ReplayCommand{Command: "rewind"}, false, replay.ControlState{Speed: 3}},
+	}
+	for _, tt := range tests {
+		err := applyReplayCommand(control, tt.cmd)
+		if (err == nil) != tt.ok || control.State() != tt.want {
+			t.Errorf("%+v: err = %v, state = %+v; want ok %v, %+v", tt.cmd, err, control.State(), tt.ok, tt.want)
+		}
+	}
+}
+
+// Only the user who started a replay, or an admin, may open its control channel
+func TestReplaySocketHandlerRequiresOwner(t *testing.T) {
+	progress := make(chan replay.ReplayProgress)
+	session := newReplaySession("", "test", "alice", 0, progress)
+	defer func() { close(progress); removeReplaySession(session.ID) }()
+
+	tests := []struct {
+		url    string
+		header string
+		want   int
+	}{
+		{"/api/replay/ws?session=missing", "", http.StatusNotFound},
+		{"/api/replay/ws?session=" + session.ID, "", http.StatusForbidden},
+		{"/api/replay/ws?session=" + session.ID, "Bearer not-a-token", http.StatusForbidden},
+		{"/api/replay/ws?session=" + session.ID + "&token=not-a-token", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		r.Header.Set("Authorization", tt.header)
+		ReplaySocketHandler(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s with %q: status %d, want %d", tt.url, tt.header, w.Code, tt.want)
+		}
+	}
+}
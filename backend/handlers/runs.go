@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/config"
+	"backend/replay"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gorilla/mux"
+	"google.golang.org/api/iterator"
+)
+
+// runCollection is the Firestore collection finished and running replays are recorded in
+const runCollection = "replay_runs"
+
+// runListDefaultLimit is how many runs ListRunsHandler returns by default
+const runListDefaultLimit = 50
+
+// ReplayRun is the audit record of one replay: what went where, and how it went
+type ReplayRun struct {
+	SessionID       string         `firestore:"session_id" json:"session_id"`
+	StartedBy       string         `firestore:"started_by" json:"started_by"`
+	ScenarioName    string         `firestore:"scenario_name" json:"scenario_name"`
+	ScenarioID      string         `firestore:"scenario_id" json:"scenario_id"`
+	ScenarioVersion string         `firestore:"scenario_version" json:"scenario_version"`
+	HECURL          string         `firestore:"hec_url" json:"hec_url"`
+	HECToken        string         `firestore:"hec_token" json:"hec_token"` // always redacted
+	Anchor          int64          `firestore:"anchor" json:"anchor"`
+	Speed           float64        `firestore:"speed" json:"speed"`
+	Workers         int            `firestore:"workers" json:"workers"`
+	PartitionKey    string         `firestore:"partition_key" json:"partition_key"`
+	Status          string         `firestore:"status" json:"status"`
+	Total           int            `firestore:"total" json:"total"`
+	Sent            int            `firestore:"sent" json:"sent"`
+	Failed          int            `firestore:"failed" json:"failed"`
+	Retried         int            `firestore:"retried" json:"retried"`
+	Bytes           int64          `firestore:"bytes" json:"bytes"`
+	Error           string         `firestore:"error" json:"error,omitempty"`
+	Errors          map[string]int `firestore:"errors" json:"errors,omitempty"`
+	StartedAt       time.Time      `firestore:"started_at" json:"started_at"`
+	FinishedAt      time.Time      `firestore:"finished_at" json:"finished_at,omitempty"`
+	DurationMs      int64          `firestore:"duration_ms" json:"duration_ms"`
+}
+
+// redactToken keeps only the last four characters of a secret
+func redactToken(token string) string {
+	if len(token) <= 8 {
+		return "****"
+	}
+	return "****" + token[len(token)-4:]
+}
+
+// newReplayRun starts the audit record for a checkpoint about to run
+func newReplayRun(cp ReplayCheckpoint) ReplayRun {
+	return ReplayRun{
+		SessionID:       cp.SessionID,
+		StartedBy:       cp.StartedBy,
+		ScenarioName:    cp.ScenarioName,
+		ScenarioID:      cp.ScenarioID,
+		ScenarioVersion: cp.ScenarioVersion,
+		HECURL:          cp.HECURL,
+		HECToken:        redactToken(cp.HECToken),
+		Anchor:          cp.Anchor,
+		Speed:           cp.Speed,
+		Workers:         cp.Workers,
+		PartitionKey:    cp.PartitionKey,
+		Status:          CheckpointRunning,
+		StartedAt:       cp.StartedAt,
+	}
+}
+
+// saveRun writes a run record to Firestore, replacing any earlier one
+func saveRun(run ReplayRun) error {
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return fmt.Errorf("error initializing Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.Collection(runCollection).Doc(run.SessionID).Set(ctx, run); err != nil {
+		return fmt.Errorf("error saving run: %v", err)
+	}
+	return nil
+}
+
+// loadRun reads a single run record
+func loadRun(sessionID string) (ReplayRun, error) {
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return ReplayRun{}, fmt.Errorf("error initializing Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	doc, err := client.Collection(runCollection).Doc(sessionID).Get(ctx)
+	if err != nil {
+		return ReplayRun{}, fmt.Errorf("error fetching run: %v", err)
+	}
+	var run ReplayRun
+	if err := doc.DataTo(&run); err != nil {
+		return ReplayRun{}, fmt.Errorf("error decoding run: %v", err)
+	}
+	return run, nil
+}
+
+// recordRun writes the run record when a replay starts and again when it ends.
+// A resumed session carries on the record of the run it continues.
+func recordRun(session *ReplaySession, cp ReplayCheckpoint) {
+	run := newReplayRun(cp)
+	if cp.Acked > 0 {
+		if existing, err := loadRun(cp.SessionID); err == nil {
+			run = existing
+			run.Status = CheckpointRunning
+			run.FinishedAt = time.Time{}
+		}
+	}
+	if err := saveRun(run); err != nil {
+		log.Printf("⚠️ Failed to record replay run %s: %v", run.SessionID, err)
+	}
+
+	// Counts restart with a resumed session, so add them to what the run already had
+	base := run
+	followProgress(session, func(progress replay.ReplayProgress) {
+		if !progress.Final {
+			return
+		}
+		if progress.Total > 0 {
+			run.Total = progress.Total
+		}
+		run.Sent = base.Sent + progress.Sent
+		run.Failed = base.Failed + progress.Failed
+		run.Retried = base.Retried + progress.Retried
+		run.Bytes = base.Bytes + progress.Bytes
+		run.Error = progress.Error
+		run.Errors = mergeErrorCounts(base.Errors, progress.Errors)
+		if progress.Error != "" && len(run.Errors) == 0 {
+			run.Errors = map[string]int{progress.Error: 1}
+		}
+		run.Status = progress.Status
+		run.FinishedAt = time.Now()
+		run.DurationMs = run.FinishedAt.Sub(run.StartedAt).Milliseconds()
+
+		if err := saveRun(run); err != nil {
+			log.Printf("⚠️ Failed to record replay run %s: %v", run.SessionID, err)
+		}
+	})
+}
+
+func mergeErrorCounts(a, b map[string]int) map[string]int {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	merged := make(map[string]int, len(a)+len(b))
+	for msg, n := range a {
+		merged[msg] += n
+	}
+	for msg, n := range b {
+		merged[msg] += n
+	}
+	return merged
+}
+
+// ListRunsHandler lists recorded replays, newest first. Optional query
+// parameters: scenario, started_by, status and limit. Runs carry HEC URLs, so
+// users only see their own; admins see everyone's.
+func ListRunsHandler(w http.ResponseWriter, r *http.Request) {
+	verified, ok := verifyRequest(r)
+	if !ok {
+		http.Error(w, "Sign in to list replay runs", http.StatusForbidden)
+		return
+	}
+	startedBy := r.URL.Query().Get("started_by")
+	if admin, _ := verified.Claims["admin"].(bool); !admin {
+		if startedBy != "" && startedBy != verified.UID {
+			http.Error(w, "Only admins can list other users' runs", http.StatusForbidden)
+			return
+		}
+		startedBy = verified.UID
+	}
+
+	limit := runListDefaultLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		http.Error(w, "Failed to list runs", http.StatusInternalServerError)
+		log.Printf("Error initializing Firestore client: %v", err)
+		return
+	}
+	defer client.Close()
+
+	query := client.Collection(runCollection).Query
+	if startedBy != "" {
+		query = query.Where("started_by", "==", startedBy)
+	}
+	for param, field := range map[string]string{"scenario": "scenario_name", "status": "status"} {
+		if value := r.URL.Query().Get(param); value != "" {
+			query = query.Where(field, "==", value)
+		}
+	}
+	// Filtering and ordering together needs a composite index per filter combination
+	query = query.OrderBy("started_at", firestore.Desc).Limit(limit)
+
+	runs := []ReplayRun{}
+	docs := query.Documents(ctx)
+	for {
+		doc, err := docs.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			http.Error(w, "Failed to list runs", http.StatusInternalServerError)
+			log.Printf("Error fetching runs: %v", err)
+			return
+		}
+		var run ReplayRun
+		if err := doc.DataTo(&run); err != nil {
+			log.Printf("⚠️ Skipping unreadable run %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		runs = append(runs, run)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
+
+// runReportColumns is the column order of the CSV report
+var runReportColumns = []string{
+	"session_id", "started_by", "scenario_name", "scenario_id", "scenario_version",
+	"hec_url", "hec_token", "anchor", "speed", "workers", "partition_key",
+	"status", "total", "sent", "failed", "retried", "bytes",
+	"started_at", "finished_at", "duration_ms", "error", "errors",
+}
+
+// csvRow flattens a run in runReportColumns order
+func (run ReplayRun) csvRow() []string {
+	var errs []string
+	for msg, n := range run.Errors {
+		errs = append(errs, fmt.Sprintf("%dx %s", n, msg))
+	}
+	sort.Strings(errs)
+	finished := ""
+	if !run.FinishedAt.IsZero() {
+		finished = run.FinishedAt.UTC().Format(time.RFC3339)
+	}
+	row := []string{
+		run.SessionID, run.StartedBy, run.ScenarioName, run.ScenarioID, run.ScenarioVersion,
+		run.HECURL, run.HECToken, time.UnixMilli(run.Anchor).UTC().Format(time.RFC3339),
+		strconv.FormatFloat(run.Speed, 'f', -1, 64), strconv.Itoa(run.Workers), run.PartitionKey,
+		run.Status, strconv.Itoa(run.Total), strconv.Itoa(run.Sent), strconv.Itoa(run.Failed),
+		strconv.Itoa(run.Retried), strconv.FormatInt(run.Bytes, 10),
+		run.StartedAt.UTC().Format(time.RFC3339), finished, strconv.FormatInt(run.DurationMs, 10),
+		run.Error, strings.Join(errs, "; "),
+	}
+	for i, cell := range row {
+		row[i] = csvSafe(cell)
+	}
+	return row
+}
+
+// csvSafe stops a spreadsheet reading a cell as a formula by prefixing the
+// characters that start one with a quote
+func csvSafe(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// RunReportHandler downloads the report of one run as JSON (default) or CSV.
+// Only the user who started the run, or an admin, may download it.
+func RunReportHandler(w http.ResponseWriter, r *http.Request) {
+	verified, ok := verifyRequest(r)
+	if !ok {
+		http.Error(w, "Sign in to download replay reports", http.StatusForbidden)
+		return
+	}
+	id := mux.Vars(r)["id"]
+	run, err := loadRun(id)
+	if err != nil {
+		http.Error(w, "Run not found", http.StatusNotFound)
+		return
+	}
+	if !ownedBy(verified, run.StartedBy) {
+		http.Error(w, "Only the user who started a run or an admin can download its report", http.StatusForbidden)
+		return
+	}
+	writeRunReport(w, run, r.URL.Query().Get("format"))
+}
+
+// writeRunReport writes a run in the requested format
+func writeRunReport(w http.ResponseWriter, run ReplayRun, format string) {
+	id := run.SessionID
+	switch format {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=replay-run-%s.json", id))
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(run)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=replay-run-%s.csv", id))
+		cw := csv.NewWriter(w)
+		cw.Write(runReportColumns)
+		cw.Write(run.csvRow())
+		cw.Flush()
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported format %q, use json or csv", format), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRedactToken(t *testing.T) {
+	tests := []struct {
+		token, want string
+	}{
+		{"", "****"},
+		{"short", "****"},
+		{"12345678", "****"},
+		{"0123456789abcdef", "****cdef"},
+	}
+	for _, tt := range tests {
+		if got := redactToken(tt.token); got != tt.want {
+			t.Errorf("redactToken(%q) = %q, want %q", tt.token, got, tt.want)
+		}
+	}
+}
+
+func TestCSVSafe(t *testing.T) {
+	tests := []struct {
+		cell, want string
+	}{
+		{"", ""},
+		{"completed", "completed"},
+		{"=HYPERLINK(\"http://evil\")", "'=HYPERLINK(\"http://evil\")"},
+		{"+1", "'+1"},
+		{"-1", "'-1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tcmd", "'\tcmd"},
+		{"a=b", "a=b"},
+	}
+	for _, tt := range tests {
+		if got := csvSafe(tt.cell); got != tt.want {
+			t.Errorf("csvSafe(%q) = %q, want %q", tt.cell, got, tt.want)
+		}
+	}
+}
+
+func TestWriteRunReportCSV(t *testing.T) {
+	started := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	run := ReplayRun{
+		SessionID:    "s1",
+		StartedBy:    "alice",
+		ScenarioName: "=cmd|' /C calc'!A0",
+		HECURL:       "https://hec.example.com:8088",
+		HECToken:     redactToken("0123456789abcdef"),
+		Anchor:       started.UnixMilli(),
+		Speed:        1.5,
+		Status:       "completed_with_errors",
+		Total:        3,
+		Sent:         2,
+		Failed:       1,
+		Errors:       map[string]int{"HEC returned 503": 1, "-timeout": 2},
+		StartedAt:    started,
+		FinishedAt:   started.Add(time.Minute),
+		DurationMs:   60000,
+	}
+	rec := httptest.NewRecorder()
+	writeRunReport(rec, run, "csv")
+
+	if got := rec.Header().Get("Content-Disposition"); got != "attachment; filename=replay-run-s1.csv" {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || !reflect.DeepEqual(rows[0], runReportColumns) {
+		t.Fatalf("report = %q, want a header and one row", rows)
+	}
+	got := map[string]string{}
+	for i, column := range rows[0] {
+		got[column] = rows[1][i]
+	}
+	want := map[string]string{
+		"scenario_name": "'=cmd|' /C calc'!A0",
+		"hec_token":     "****cdef",
+		"anchor":        "2026-03-02T09:00:00Z",
+		"speed":         "1.5",
+		"finished_at":   "2026-03-02T09:01:00Z",
+		"errors":        "1x HEC returned 503; 2x -timeout",
+	}
+	for column, value := range want {
+		if got[column] != value {
+			t.Errorf("%s = %q, want %q", column, got[column], value)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	writeRunReport(rec, run, "xml")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("xml report status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+// Runs carry HEC URLs, so listing and reports need a verified caller
+func TestRunHandlersRequireSignIn(t *testing.T) {
+	for name, handler := range map[string]http.HandlerFunc{"list": ListRunsHandler, "report": RunReportHandler} {
+		req := httptest.NewRequest(http.MethodGet, "/api/replay/runs", nil)
+		req.Header.Set("Authorization", "Bearer forged")
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s: status = %d, want %d", name, rec.Code, http.StatusForbidden)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"backend/sanitize"
+)
+
+// previewSampleSize is how many records a sanitization preview shows by default
+const previewSampleSize = 10
+
+// loadCaptureResult reads the stored events of a completed capture job
+func loadCaptureResult(jobID string) ([]interface{}, error) {
+	jobs, err := captureJobManager()
+	if err != nil {
+		return nil, err
+	}
+	path, err := jobs.ResultPath(jobID)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open capture result: %v", err)
+	}
+	defer file.Close()
+
+	var events []interface{}
+	if err := json.NewDecoder(file).Decode(&events); err != nil {
+		return nil, fmt.Errorf("failed to read capture result: %v", err)
+	}
+	return events, nil
+}
+
+// SanitizePreviewHandler shows what a rule set would do to a sample of events,
+// given either inline events or the ID of a completed capture job. Pseudonyms
+// are made with a throwaway key, so the preview can't be used to compute a
+// scenario's real pseudonyms and never creates a key.
+func SanitizePreviewHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Rules  sanitize.Rules `json:"rules"`
+		Events []interface{}  `json:"events"`
+		JobID  string         `json:"job_id"`
+		Limit  int            `json:"limit"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	key, err := newKeyBytes()
+	if err != nil {
+		http.Error(w, "Failed to prepare preview", http.StatusInternalServerError)
+		return
+	}
+	sanitizer, err := sanitize.New(req.Rules, key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events := req.Events
+	if req.JobID != "" {
+		events, err = loadCaptureResult(req.JobID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	}
+	if req.Limit <= 0 {
+		req.Limit = previewSampleSize
+	}
+
+	diffs := sanitizer.Preview(events, req.Limit)
+	changed := 0
+	for _, d := range diffs {
+		if len(d.Changes) > 0 {
+			changed++
+		}
+	}
+	log.Printf("🧼 Sanitize preview: %d of %d sampled records changed", changed, len(diffs))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"total":   len(events),
+		"changed": changed,
+		"records": diffs,
+	})
+}
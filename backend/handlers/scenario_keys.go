@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/config"
+	"backend/sanitize"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// scenarioKeyCollection is the Firestore collection pseudonymization keys live in
+const scenarioKeyCollection = "scenario_keys"
+
+// scenarioKeySize is the length of a generated pseudonymization key in bytes
+const scenarioKeySize = 32
+
+// ScenarioKey is the secret a scenario's pseudonyms are derived from. It is
+// never returned by the API.
+type ScenarioKey struct {
+	ScenarioName string    `firestore:"scenario_name" json:"scenario_name"`
+	Key          []byte    `firestore:"key" json:"-"`
+	Version      int       `firestore:"version" json:"version"`
+	CreatedAt    time.Time `firestore:"created_at" json:"created_at"`
+	RotatedAt    time.Time `firestore:"rotated_at" json:"rotated_at,omitempty"`
+}
+
+// scenarioKeyID turns a scenario name, which may contain any character, into a document ID
+func scenarioKeyID(scenarioName string) string {
+	sum := sha256.Sum256([]byte(scenarioName))
+	return hex.EncodeToString(sum[:])
+}
+
+func newKeyBytes() ([]byte, error) {
+	key := make([]byte, scenarioKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+	return key, nil
+}
+
+// scenarioKey returns a scenario's pseudonymization key, creating one the
+// first time the scenario is pseudonymized
+func scenarioKey(scenarioName string) (ScenarioKey, error) {
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return ScenarioKey{}, fmt.Errorf("error initializing Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	ref := client.Collection(scenarioKeyCollection).Doc(scenarioKeyID(scenarioName))
+	var key ScenarioKey
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err == nil {
+			return doc.DataTo(&key)
+		}
+		if status.Code(err) != codes.NotFound {
+			return err
+		}
+		bytes, err := newKeyBytes()
+		if err != nil {
+			return err
+		}
+		key = ScenarioKey{ScenarioName: scenarioName, Key: bytes, Version: 1, CreatedAt: time.Now()}
+		return tx.Create(ref, key)
+	})
+	if err != nil {
+		return ScenarioKey{}, fmt.Errorf("error fetching scenario key: %v", err)
+	}
+	return key, nil
+}
+
+// rotateScenarioKey replaces a scenario's key. Events sanitized afterwards get
+// new pseudonyms; ones already stored keep theirs. The read and write share a
+// transaction so concurrent rotations each bump the version once.
+func rotateScenarioKey(scenarioName string) (ScenarioKey, error) {
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return ScenarioKey{}, fmt.Errorf("error initializing Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	ref := client.Collection(scenarioKeyCollection).Doc(scenarioKeyID(scenarioName))
+	var key ScenarioKey
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		key = ScenarioKey{ScenarioName: scenarioName, CreatedAt: time.Now()}
+		doc, err := tx.Get(ref)
+		if err == nil {
+			if err := doc.DataTo(&key); err != nil {
+				return err
+			}
+		} else if status.Code(err) != codes.NotFound {
+			return err
+		}
+		bytes, err := newKeyBytes()
+		if err != nil {
+			return err
+		}
+		key.Key = bytes
+		key.Version++
+		key.RotatedAt = time.Now()
+		return tx.Set(ref, key)
+	})
+	if err != nil {
+		return ScenarioKey{}, fmt.Errorf("error rotating scenario key: %v", err)
+	}
+	return key, nil
+}
+
+// newSanitizer prepares rules for a scenario, fetching its key only when the
+// rules pseudonymize something
+func newSanitizer(rules sanitize.Rules, scenarioName string) (*sanitize.Sanitizer, error) {
+	if !rules.NeedsKey() {
+		return sanitize.New(rules, nil)
+	}
+	if scenarioName == "" {
+		return nil, fmt.Errorf("pseudonymization rules need a scenario name")
+	}
+	key, err := scenarioKey(scenarioName)
+	if err != nil {
+		return nil, err
+	}
+	return sanitize.New(rules, key.Key)
+}
+
+// RotateScenarioKeyHandler gives a scenario a new pseudonymization key. Only
+// admins may rotate keys.
+func RotateScenarioKeyHandler(w http.ResponseWriter, r *http.Request) {
+	admin, ok := requestAdmin(r)
+	if !ok {
+		http.Error(w, "Only an admin can rotate scenario keys", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		ScenarioName string `json:"scenario_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ScenarioName == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	key, err := rotateScenarioKey(req.ScenarioName)
+	if err != nil {
+		http.Error(w, "Failed to rotate scenario key", http.StatusInternalServerError)
+		log.Printf("Failed to rotate key for scenario %s: %v", req.ScenarioName, err)
+		return
+	}
+	log.Printf("🔑 %s rotated the key for scenario %s to version %d", admin, req.ScenarioName, key.Version)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(key)
+}
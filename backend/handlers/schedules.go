@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/config"
+	"backend/scheduler"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// scheduleCollection is the Firestore collection replay schedules live in
+const scheduleCollection = "replay_schedules"
+
+// replayScheduler is started by StartScheduler and woken whenever a schedule changes
+var replayScheduler *scheduler.Scheduler
+
+// firestoreScheduleStore keeps schedules in Firestore
+type firestoreScheduleStore struct{}
+
+func (firestoreScheduleStore) List() ([]scheduler.Schedule, error) {
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	schedules := []scheduler.Schedule{}
+	docs := client.Collection(scheduleCollection).Documents(ctx)
+	for {
+		doc, err := docs.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error fetching schedules: %v", err)
+		}
+		var sched scheduler.Schedule
+		if err := doc.DataTo(&sched); err != nil {
+			log.Printf("⚠️ Skipping unreadable schedule %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		schedules = append(schedules, sched)
+	}
+	return schedules, nil
+}
+
+func (firestoreScheduleStore) Get(id string) (scheduler.Schedule, error) {
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return scheduler.Schedule{}, fmt.Errorf("error initializing Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	doc, err := client.Collection(scheduleCollection).Doc(id).Get(ctx)
+	if err != nil {
+		return scheduler.Schedule{}, fmt.Errorf("error fetching schedule: %v", err)
+	}
+	var sched scheduler.Schedule
+	if err := doc.DataTo(&sched); err != nil {
+		return scheduler.Schedule{}, fmt.Errorf("error decoding schedule: %v", err)
+	}
+	return sched, nil
+}
+
+func (firestoreScheduleStore) Save(sched scheduler.Schedule) error {
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return fmt.Errorf("error initializing Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.Collection(scheduleCollection).Doc(sched.ID).Set(ctx, sched); err != nil {
+		return fmt.Errorf("error saving schedule: %v", err)
+	}
+	return nil
+}
+
+func (firestoreScheduleStore) RecordRun(sched scheduler.Schedule, seen time.Time) error {
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return fmt.Errorf("error initializing Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	ref := client.Collection(scheduleCollection).Doc(sched.ID)
+	return client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return scheduler.ErrChanged
+		}
+		if err != nil {
+			return fmt.Errorf("error fetching schedule: %v", err)
+		}
+		var current scheduler.Schedule
+		if err := doc.DataTo(&current); err != nil {
+			return fmt.Errorf("error decoding schedule: %v", err)
+		}
+		if !current.UpdatedAt.Equal(seen) {
+			return scheduler.ErrChanged
+		}
+		return tx.Update(ref, []firestore.Update{
+			{Path: "next_run", Value: sched.NextRun},
+			{Path: "last_run", Value: sched.LastRun},
+			{Path: "last_session_id", Value: sched.LastSessionID},
+			{Path: "last_error", Value: sched.LastError},
+			{Path: "enabled", Value: sched.Enabled},
+			{Path: "updated_at", Value: sched.UpdatedAt},
+		})
+	})
+}
+
+func (firestoreScheduleStore) Delete(id string) error {
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return fmt.Errorf("error initializing Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.Collection(scheduleCollection).Doc(id).Delete(ctx); err != nil {
+		return fmt.Errorf("error deleting schedule: %v", err)
+	}
+	return nil
+}
+
+// FetchProfileHEC looks up the HEC destination stored on a user profile
+func FetchProfileHEC(profileID string) (string, string, error) {
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("error initializing Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	doc, err := client.Collection("profiles").Doc(profileID).Get(ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("error fetching profile: %v", err)
+	}
+	data := doc.Data()
+	hecURL, _ := data["hec_url"].(string)
+	hecToken, _ := data["hec_token"].(string)
+	if hecURL == "" || hecToken == "" {
+		return "", "", fmt.Errorf("profile %s has no HEC URL or token", profileID)
+	}
+	return hecURL, hecToken, nil
+}
+
+// launchScheduledReplay starts a scheduled run as a normal replay session
+func launchScheduledReplay(sched scheduler.Schedule) (string, error) {
+	hecURL, hecToken, err := FetchProfileHEC(sched.ProfileID)
+	if err != nil {
+		return "", err
+	}
+	scenario, err := FetchScenario(sched.ScenarioName)
+	if err != nil {
+		return "", err
+	}
+
+	session := startReplay(ReplayCheckpoint{
+		ScenarioName:    sched.ScenarioName,
+		ScenarioID:      scenario.ID,
+		ScenarioVersion: scenario.Version,
+		StartedBy:       "schedule:" + sched.ID,
+		FileURL:         scenario.FileURL,
+		HECURL:          hecURL,
+		ProfileID:       sched.ProfileID,
+		HECToken:        hecToken,
+		Anchor:          time.Now().UnixMilli(),
+		Speed:           sched.Speed,
+		Workers:         sched.Workers,
+		PartitionKey:    sched.PartitionKey,
+	})
+	return session.ID, nil
+}
+
+// StartScheduler runs scheduled replays in the background for the life of the server
+func StartScheduler() {
+	replayScheduler = scheduler.New(firestoreScheduleStore{}, launchScheduledReplay)
+	go replayScheduler.Run(make(chan struct{}))
+}
+
+// wakeScheduler tells the scheduler to look at its schedules again
+func wakeScheduler() {
+	if replayScheduler != nil {
+		replayScheduler.Wake()
+	}
+}
+
+// ListSchedulesHandler returns every schedule ordered by next run
+func ListSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	schedules, err := firestoreScheduleStore{}.List()
+	if err != nil {
+		http.Error(w, "Failed to list schedules", http.StatusInternalServerError)
+		log.Printf("Failed to list schedules: %v", err)
+		return
+	}
+	scheduler.SortByNextRun(schedules)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedules)
+}
+
+// GetScheduleHandler returns a single schedule
+func GetScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	sched, err := firestoreScheduleStore{}.Get(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sched)
+}
+
+// CreateScheduleHandler stores a new one-shot or cron schedule
+func CreateScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	var sched scheduler.Schedule
+	if err := json.NewDecoder(r.Body).Decode(&sched); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if err := sched.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sched.Missed(time.Now()) {
+		http.Error(w, "run_at is too far in the past to run", http.StatusBadRequest)
+		return
+	}
+	// The schedule replays with the profile's HEC token, so only its owner may use it
+	if !requestOwns(r, sched.ProfileID) {
+		http.Error(w, "Only the profile's owner can schedule replays with it", http.StatusForbidden)
+		return
+	}
+
+	sched.ID = uuid.NewString()
+	sched.CreatedBy = verifiedUser(r)
+	sched.LastRun = time.Time{}
+	sched.LastSessionID = ""
+	sched.LastError = ""
+	sched.CreatedAt = time.Time{}
+	sched = scheduler.Prepare(sched, time.Now())
+
+	if err := (firestoreScheduleStore{}).Save(sched); err != nil {
+		http.Error(w, "Failed to save schedule", http.StatusInternalServerError)
+		log.Printf("Failed to save schedule: %v", err)
+		return
+	}
+	wakeScheduler()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sched)
+}
+
+// UpdateScheduleHandler replaces the settings of an existing schedule
+func UpdateScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	store := firestoreScheduleStore{}
+	existing, err := store.Get(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+
+	var sched scheduler.Schedule
+	if err := json.NewDecoder(r.Body).Decode(&sched); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if err := sched.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !sched.RunAt.Equal(existing.RunAt) && sched.Missed(time.Now()) {
+		http.Error(w, "run_at is too far in the past to run", http.StatusBadRequest)
+		return
+	}
+	if !requestOwns(r, sched.ProfileID) {
+		http.Error(w, "Only the profile's owner can schedule replays with it", http.StatusForbidden)
+		return
+	}
+
+	// Run history belongs to the server; a new one-shot time makes it runnable again
+	sched.ID = existing.ID
+	sched.CreatedAt = existing.CreatedAt
+	sched.CreatedBy = existing.CreatedBy
+	sched.LastRun = existing.LastRun
+	sched.LastSessionID = existing.LastSessionID
+	sched.LastError = existing.LastError
+	if !sched.RunAt.Equal(existing.RunAt) {
+		sched.LastRun = time.Time{}
+	}
+	sched = scheduler.Prepare(sched, time.Now())
+
+	if err := store.Save(sched); err != nil {
+		http.Error(w, "Failed to save schedule", http.StatusInternalServerError)
+		log.Printf("Failed to save schedule %s: %v", sched.ID, err)
+		return
+	}
+	wakeScheduler()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sched)
+}
+
+// DeleteScheduleHandler removes a schedule; replays it already started keep running
+func DeleteScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	store := firestoreScheduleStore{}
+	id := mux.Vars(r)["id"]
+	if _, err := store.Get(id); err != nil {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+	if err := store.Delete(id); err != nil {
+		http.Error(w, "Failed to delete schedule", http.StatusInternalServerError)
+		log.Printf("Failed to delete schedule %s: %v", id, err)
+		return
+	}
+	wakeScheduler()
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Bad schedules are refused before anything is stored, and a profile's HEC
+// token can't be scheduled by anyone but its owner
+func TestCreateScheduleHandlerRejects(t *testing.T) {
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	soon := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"not JSON", `{`, http.StatusBadRequest},
+		{"no time", `{"scenario_name":"test","profile_id":"alice"}`, http.StatusBadRequest},
+		{"run_at long past", fmt.Sprintf(`{"scenario_name":"test","profile_id":"alice","run_at":%q}`, past), http.StatusBadRequest},
+		{"someone else's profile", fmt.Sprintf(`{"scenario_name":"test","profile_id":"alice","run_at":%q}`, soon), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/api/schedules", strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer forged")
+		rec := httptest.NewRecorder()
+		CreateScheduleHandler(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
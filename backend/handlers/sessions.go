@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"backend/replay"
+
+	"github.com/google/uuid"
+)
+
+// sessionRetention is how long a finished replay stays subscribable
+const sessionRetention = 15 * time.Minute
+
+// ReplaySession is the state ReplayHandler creates for one running replay
+type ReplaySession struct {
+	ID           string              `json:"id"`
+	ScenarioName string              `json:"scenario_name"`
+	StartedBy    string              `json:"started_by"`
+	StartedAt    time.Time           `json:"started_at"`
+	Progress     *replay.Broadcaster `json:"-"`
+	Control      *replay.Controller  `json:"-"`
+}
+
+var (
+	sessionsMu    sync.Mutex
+	sessions      = map[string]*ReplaySession{}
+	latestSession string
+)
+
+// newReplaySession registers a session and starts broadcasting its progress.
+// An empty id creates a new session; resumed replays pass their original one.
+// startedBy is the only user besides admins who may control it.
+func newReplaySession(id, scenarioName, startedBy string, speed float64, progressChan <-chan replay.ReplayProgress) *ReplaySession {
+	if id == "" {
+		id = uuid.NewString()
+	}
+	session := &ReplaySession{
+		ID:           id,
+		ScenarioName: scenarioName,
+		StartedBy:    startedBy,
+		StartedAt:    time.Now(),
+		Progress:     replay.NewBroadcaster(replay.DefaultHistorySize),
+		Control:      replay.NewController(speed),
+	}
+
+	sessionsMu.Lock()
+	sessions[session.ID] = session
+	latestSession = session.ID
+	sessionsMu.Unlock()
+
+	go func() {
+		session.Progress.Run(progressChan)
+		time.AfterFunc(sessionRetention, func() { removeReplaySession(session.ID) })
+	}()
+	return session
+}
+
+// getReplaySession looks a session up by ID; an empty ID means the most recent one
+func getReplaySession(id string) (*ReplaySession, bool) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	if id == "" {
+		id = latestSession
+	}
+	session, ok := sessions[id]
+	return session, ok
+}
+
+func removeReplaySession(id string) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	delete(sessions, id)
+	if latestSession == id {
+		latestSession = ""
+	}
+}
+
+// followProgress calls handle for every progress event of a session until the
+// replay ends. Slow handlers, such as ones writing to Firestore, may get their
+// subscription dropped for falling behind; it is picked up again from the last
+// event seen.
+func followProgress(session *ReplaySession, handle func(replay.ReplayProgress)) {
+	var lastID int64
+	final := false
+	deliver := func(event replay.ProgressEvent) {
+		lastID = event.ID
+		final = final || event.Progress.Final
+		handle(event.Progress)
+	}
+
+	for !final {
+		done := session.Progress.Done()
+		backlog, events, cancel := session.Progress.Subscribe(lastID)
+		for _, event := range backlog {
+			deliver(event)
+		}
+		for event := range events {
+			deliver(event)
+		}
+		cancel()
+		if done {
+			break
+		}
+	}
+}
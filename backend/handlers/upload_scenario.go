@@ -1,19 +1,106 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
+	"backend/config"
+	"backend/sanitize"
+
+	"cloud.google.com/go/firestore"
 	"cloud.google.com/go/storage"
+	"firebase.google.com/go/auth"
 )
 
 // UploadResponse represents the response after uploading a file.
 type UploadResponse struct {
-	FileURL string `json:"file_url"`
+	FileURL      string           `json:"file_url"`
+	Sanitization []AppliedProfile `json:"sanitization"`
+}
+
+// ScenarioMetadata is the scenario document an upload creates or updates
+type ScenarioMetadata struct {
+	Name         string           `firestore:"name"`
+	Description  string           `firestore:"description"`
+	FileName     string           `firestore:"file_name"`
+	Stream       string           `firestore:"stream"`
+	CreatedBy    string           `firestore:"createdBy"`
+	Sanitization []AppliedProfile `firestore:"sanitization"`
+	UpdatedAt    time.Time        `firestore:"updated_at"`
+}
+
+// errScenarioTaken is returned when a scenario name belongs to another user
+var errScenarioTaken = errors.New("scenario belongs to another user")
+
+// scenarioTaken reports whether the scenario with this name exists and was
+// created by someone other than the verified user, who isn't an admin
+func scenarioTaken(name string, verified *auth.Token) (bool, error) {
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return false, fmt.Errorf("error initializing Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	docs, err := client.Collection("scenarios").Where("name", "==", name).Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return false, fmt.Errorf("error fetching scenario: %v", err)
+	}
+	if len(docs) == 0 {
+		return false, nil
+	}
+	createdBy, _ := docs[0].Data()["createdBy"].(string)
+	return !ownedBy(verified, createdBy), nil
+}
+
+// saveScenarioMetadata writes the scenario document for an uploaded file,
+// updating the one with the same name if it exists. Only the scenario's
+// creator or an admin may update it; anyone else gets errScenarioTaken.
+func saveScenarioMetadata(meta ScenarioMetadata, verified *auth.Token) error {
+	ctx := context.Background()
+	client, err := config.FirebaseApp.Firestore(ctx)
+	if err != nil {
+		return fmt.Errorf("error initializing Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	meta.UpdatedAt = time.Now()
+	scenarios := client.Collection("scenarios")
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docs, err := tx.Documents(scenarios.Where("name", "==", meta.Name).Limit(1)).GetAll()
+		if err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			return tx.Create(scenarios.NewDoc(), meta)
+		}
+		if createdBy, _ := docs[0].Data()["createdBy"].(string); !ownedBy(verified, createdBy) {
+			return errScenarioTaken
+		}
+		// Merge so fields this upload doesn't know about are kept
+		return tx.Set(docs[0].Ref, map[string]interface{}{
+			"description":  meta.Description,
+			"file_name":    meta.FileName,
+			"stream":       meta.Stream,
+			"sanitization": meta.Sanitization,
+			"updated_at":   meta.UpdatedAt,
+		}, firestore.MergeAll)
+	})
+	if err == errScenarioTaken {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("error saving scenario: %v", err)
+	}
+	return nil
 }
 
 // UploadScenarioHandler handles file uploads to Firebase Storage.
@@ -34,6 +121,26 @@ func UploadScenarioHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A named upload creates or replaces a scenario, so it needs an owner
+	name := r.FormValue("name")
+	verified, signedIn := verifyRequest(r)
+	if name != "" {
+		if !signedIn {
+			http.Error(w, "Sign in to save a scenario", http.StatusForbidden)
+			return
+		}
+		taken, err := scenarioTaken(name, verified)
+		if err != nil {
+			log.Printf("❌ Failed to look up scenario %s: %v", name, err)
+			http.Error(w, "Failed to look up scenario", http.StatusInternalServerError)
+			return
+		}
+		if taken {
+			http.Error(w, "A scenario with this name belongs to another user", http.StatusConflict)
+			return
+		}
+	}
+
 	// Retrieve the file
 	file, handler, err := r.FormFile("file")
 	if err != nil {
@@ -46,16 +153,101 @@ func UploadScenarioHandler(w http.ResponseWriter, r *http.Request) {
 	fileName := handler.Filename
 	log.Printf("📂 File received: %s (%d bytes)", fileName, handler.Size)
 
+	// Read the events so they can be sanitized and scanned before anything is stored
+	var events []interface{}
+	if err := json.NewDecoder(file).Decode(&events); err != nil {
+		log.Printf("❌ %s is not a JSON array of events: %v", fileName, err)
+		http.Error(w, "Scenario must be a JSON array of events", http.StatusBadRequest)
+		return
+	}
+
+	// Sanitize with the attached profile and any inline rules
+	var rules sanitize.Rules
+	if rulesJSON := r.FormValue("rules"); rulesJSON != "" {
+		if err := json.Unmarshal([]byte(rulesJSON), &rules); err != nil {
+			http.Error(w, "Invalid sanitization rules", http.StatusBadRequest)
+			return
+		}
+	}
+	profileVersion, _ := strconv.Atoi(r.FormValue("profile_version"))
+	rules, applied, err := profileRules(r.FormValue("profile_id"), profileVersion, rules, "upload")
+	if err != nil {
+		http.Error(w, "Sanitization profile not found", http.StatusBadRequest)
+		return
+	}
+	if !rules.Empty() {
+		sanitizer, err := newSanitizer(rules, name)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to sanitize file: %v", err), http.StatusBadRequest)
+			return
+		}
+		events = sanitizer.Events(events)
+		log.Printf("🧼 Sanitized %d events in %s", len(events), fileName)
+	}
+
+	// Provenance: the profile applied here plus any applied by the capture job it came from
+	profiles := []AppliedProfile{}
+	if jobID := r.FormValue("capture_job_id"); jobID != "" {
+		if profile := captureJobProfile(jobID); profile != nil {
+			profiles = append(profiles, *profile)
+		}
+	}
+	if applied != nil {
+		profiles = append(profiles, *applied)
+	}
+
+	// High-severity findings block the upload unless an admin overrides them
+	report := scanEvents(events)
+	if report.Blocking() {
+		if r.FormValue("override") != "true" {
+			log.Printf("🚫 Upload of %s blocked: %d high-severity findings", fileName, report.High)
+			writeFindings(w, http.StatusUnprocessableEntity, "Scenario contains sensitive data", report)
+			return
+		}
+		admin, ok := requestAdmin(r)
+		if !ok {
+			writeFindings(w, http.StatusForbidden, "Only an admin can override sensitive data findings", report)
+			return
+		}
+		log.Printf("⚠️ %s overrode %d high-severity findings in %s", admin, report.High, fileName)
+	}
+
+	js, err := json.Marshal(events)
+	if err != nil {
+		http.Error(w, "Failed to encode scenario", http.StatusInternalServerError)
+		return
+	}
+	upload := bytes.NewReader(js)
+
 	// Upload to Firebase Storage using the improved function
-	uploadedURL, err := UploadFileToFirebase("replaydata-385e9.firebasestorage.app", fileName, file)
+	uploadedURL, err := UploadFileToFirebase("replaydata-385e9.firebasestorage.app", fileName, upload)
 	if err != nil {
 		log.Printf("❌ Upload to Firebase failed: %v", err)
 		http.Error(w, fmt.Sprintf("Failed to upload file: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	// Record the scenario with where its sanitization came from
+	if name != "" {
+		err := saveScenarioMetadata(ScenarioMetadata{
+			Name:         name,
+			Description:  r.FormValue("description"),
+			FileName:     fileName,
+			Stream:       uploadedURL,
+			CreatedBy:    verified.UID,
+			Sanitization: profiles,
+		}, verified)
+		if err == errScenarioTaken {
+			http.Error(w, "A scenario with this name belongs to another user", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("⚠️ Failed to save scenario metadata for %s: %v", name, err)
+		}
+	}
+
 	// Respond with the uploaded file URL
-	response := UploadResponse{FileURL: uploadedURL}
+	response := UploadResponse{FileURL: uploadedURL, Sanitization: profiles}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 	log.Println("✅ File uploaded successfully:", uploadedURL)
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// A named upload creates or replaces a scenario document, so it is turned
+// away before anything is read or stored unless the caller is signed in
+func TestUploadScenarioHandlerRequiresSignIn(t *testing.T) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("name", "someone-elses-scenario")
+	part, _ := form.CreateFormFile("file", "scenario.json")
+	part.Write([]byte(`[{"@timestamp": 0}]`))
+	form.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/api/upload-scenario", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	r.Header.Set("Authorization", "Bearer not-a-token")
+	w := httptest.NewRecorder()
+	UploadScenarioHandler(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,579 @@
+package importer
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// BinXML tokens. The 0x40 bit on element, attribute and value tokens marks
+// that more of the same follow.
+const (
+	tokEOF            = 0x00
+	tokOpenStart      = 0x01
+	tokCloseStart     = 0x02
+	tokCloseEmpty     = 0x03
+	tokEndElement     = 0x04
+	tokValue          = 0x05
+	tokAttribute      = 0x06
+	tokCDATA          = 0x07
+	tokCharRef        = 0x08
+	tokEntityRef      = 0x09
+	tokPITarget       = 0x0a
+	tokPIData         = 0x0b
+	tokTemplate       = 0x0c
+	tokSubstitution   = 0x0d
+	tokOptionalSubst  = 0x0e
+	tokFragmentHeader = 0x0f
+	tokMoreBit        = 0x40
+)
+
+// BinXML value types; 0x80 marks an array of the type
+const (
+	valNull       = 0x00
+	valWString    = 0x01
+	valString     = 0x02
+	valInt8       = 0x03
+	valUint8      = 0x04
+	valInt16      = 0x05
+	valUint16     = 0x06
+	valInt32      = 0x07
+	valUint32     = 0x08
+	valInt64      = 0x09
+	valUint64     = 0x0a
+	valReal32     = 0x0b
+	valReal64     = 0x0c
+	valBool       = 0x0d
+	valBinary     = 0x0e
+	valGUID       = 0x0f
+	valSizeT      = 0x10
+	valFiletime   = 0x11
+	valSystemtime = 0x12
+	valSID        = 0x13
+	valHexInt32   = 0x14
+	valHexInt64   = 0x15
+	valBinXML     = 0x21
+	valArray      = 0x80
+)
+
+// xmlNode is a decoded BinXML element
+type xmlNode struct {
+	Name     string
+	Attrs    map[string]string
+	Children []*xmlNode
+	Text     strings.Builder
+}
+
+// child returns the first child element with the given name
+func (n *xmlNode) child(name string) *xmlNode {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// subValue is one template substitution value: where its data sits in the chunk
+type subValue struct {
+	typ    byte
+	offset int
+	size   int
+}
+
+// binXML decodes BinXML inside one chunk. Name and template offsets are
+// relative to the chunk, so the parser works on the whole chunk buffer.
+// Templates and substitutions decode with their own binXML, sharing the
+// record's budget.
+type binXML struct {
+	chunk  []byte
+	pos    int
+	values []subValue
+	depth  int
+	budget *int
+}
+
+// maxBinXMLDepth stops malformed files from recursing forever
+const maxBinXMLDepth = 64
+
+// maxBinXMLNodes is how many elements, templates and nested fragments one
+// record may expand to. Templates can instantiate themselves, so depth alone
+// would still let a few bytes expand exponentially.
+const maxBinXMLNodes = 10000
+
+// newBinXML starts decoding a record's BinXML at pos
+func newBinXML(chunk []byte, pos int) *binXML {
+	budget := maxBinXMLNodes
+	return &binXML{chunk: chunk, pos: pos, budget: &budget}
+}
+
+// nested decodes BinXML elsewhere in the chunk as part of the same record
+func (p *binXML) nested(pos int, values []subValue) *binXML {
+	return &binXML{chunk: p.chunk, pos: pos, values: values, depth: p.depth, budget: p.budget}
+}
+
+// spend takes one node from the record's budget
+func (p *binXML) spend() error {
+	if *p.budget--; *p.budget < 0 {
+		return fmt.Errorf("BinXML record expands to more than %d nodes", maxBinXMLNodes)
+	}
+	return nil
+}
+
+func (p *binXML) need(n int) error {
+	if p.pos < 0 || p.pos+n > len(p.chunk) {
+		return fmt.Errorf("BinXML runs past the chunk at offset %d", p.pos)
+	}
+	return nil
+}
+
+func (p *binXML) u8() (byte, error) {
+	if err := p.need(1); err != nil {
+		return 0, err
+	}
+	p.pos++
+	return p.chunk[p.pos-1], nil
+}
+
+func (p *binXML) u16() (uint16, error) {
+	if err := p.need(2); err != nil {
+		return 0, err
+	}
+	p.pos += 2
+	return binary.LittleEndian.Uint16(p.chunk[p.pos-2:]), nil
+}
+
+func (p *binXML) u32() (uint32, error) {
+	if err := p.need(4); err != nil {
+		return 0, err
+	}
+	p.pos += 4
+	return binary.LittleEndian.Uint32(p.chunk[p.pos-4:]), nil
+}
+
+// utf16At decodes count UTF-16 code units at offset
+func (p *binXML) utf16At(offset, count int) (string, error) {
+	if offset < 0 || offset+count*2 > len(p.chunk) {
+		return "", fmt.Errorf("string runs past the chunk at offset %d", offset)
+	}
+	return decodeUTF16(p.chunk[offset : offset+count*2]), nil
+}
+
+// lengthPrefixed reads a two-byte character count followed by UTF-16
+func (p *binXML) lengthPrefixed() (string, error) {
+	count, err := p.u16()
+	if err != nil {
+		return "", err
+	}
+	s, err := p.utf16At(p.pos, int(count))
+	p.pos += int(count) * 2
+	return s, err
+}
+
+// name reads a name reference. Names are stored once per chunk; the first
+// use carries the name inline right after the reference.
+func (p *binXML) name(tokenPos int) (string, error) {
+	offset, err := p.u32()
+	if err != nil {
+		return "", err
+	}
+	off := int(offset)
+	if off+8 > len(p.chunk) {
+		return "", fmt.Errorf("name offset %d is outside the chunk", off)
+	}
+	count := int(binary.LittleEndian.Uint16(p.chunk[off+6:]))
+	name, err := p.utf16At(off+8, count)
+	if err != nil {
+		return "", err
+	}
+	if off > tokenPos {
+		p.pos = off + 8 + count*2 + 2
+	}
+	return name, nil
+}
+
+// fragment decodes a stream of tokens up to its end and returns the top elements
+func (p *binXML) fragment() ([]*xmlNode, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxBinXMLDepth {
+		return nil, fmt.Errorf("BinXML nests too deeply")
+	}
+
+	nodes := []*xmlNode{}
+	for {
+		tok, err := p.u8()
+		if err != nil {
+			return nodes, err
+		}
+		switch tok &^ tokMoreBit {
+		case tokEOF:
+			return nodes, nil
+		case tokFragmentHeader:
+			p.pos += 3
+		case tokTemplate:
+			p.pos--
+			children, err := p.template()
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, children...)
+		case tokOpenStart:
+			p.pos--
+			node, err := p.element()
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, node)
+		default:
+			return nil, fmt.Errorf("unexpected BinXML token 0x%02x at offset %d", tok, p.pos-1)
+		}
+	}
+}
+
+// template decodes a template instance: the template body filled in with
+// the substitution values that follow it
+func (p *binXML) template() ([]*xmlNode, error) {
+	if err := p.spend(); err != nil {
+		return nil, err
+	}
+	tokenPos := p.pos
+	// Skip the token, an unknown byte and the template ID
+	p.pos += 2
+	if _, err := p.u32(); err != nil {
+		return nil, err
+	}
+	offset, err := p.u32()
+	if err != nil {
+		return nil, err
+	}
+	def := int(offset)
+	if def+24 > len(p.chunk) {
+		return nil, fmt.Errorf("template offset %d is outside the chunk", def)
+	}
+	dataSize := int(binary.LittleEndian.Uint32(p.chunk[def+20:]))
+	if def > tokenPos {
+		// First use in the chunk: the definition sits here
+		p.pos = def + 24 + dataSize
+	}
+
+	count, err := p.u32()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.need(int(count) * 4); err != nil {
+		return nil, err
+	}
+	values := make([]subValue, count)
+	for i := range values {
+		values[i].size = int(binary.LittleEndian.Uint16(p.chunk[p.pos:]))
+		values[i].typ = p.chunk[p.pos+2]
+		p.pos += 4
+	}
+	for i := range values {
+		values[i].offset = p.pos
+		p.pos += values[i].size
+	}
+	if err := p.need(0); err != nil {
+		return nil, err
+	}
+
+	return p.nested(def+24, values).fragment()
+}
+
+// element decodes an element with its attributes and content
+func (p *binXML) element() (*xmlNode, error) {
+	if err := p.spend(); err != nil {
+		return nil, err
+	}
+	tokenPos := p.pos
+	tok, err := p.u8()
+	if err != nil {
+		return nil, err
+	}
+	p.pos += 6 // dependency ID and data size
+	name, err := p.name(tokenPos)
+	if err != nil {
+		return nil, err
+	}
+	node := &xmlNode{Name: name, Attrs: map[string]string{}}
+	if tok&tokMoreBit != 0 {
+		p.pos += 4 // attribute list size
+	}
+
+	for p.need(1) == nil && p.chunk[p.pos]&^tokMoreBit == tokAttribute {
+		attrPos := p.pos
+		p.pos++
+		attr, err := p.name(attrPos)
+		if err != nil {
+			return nil, err
+		}
+		var value strings.Builder
+		if _, err := p.content(&value, nil); err != nil {
+			return nil, err
+		}
+		node.Attrs[attr] = value.String()
+	}
+
+	tok, err = p.u8()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case tokCloseEmpty:
+		return node, nil
+	case tokCloseStart:
+	default:
+		return nil, fmt.Errorf("unexpected BinXML token 0x%02x after element %s", tok, name)
+	}
+
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxBinXMLDepth {
+		return nil, fmt.Errorf("BinXML nests too deeply")
+	}
+	for {
+		if err := p.need(1); err != nil {
+			return nil, err
+		}
+		switch p.chunk[p.pos] &^ tokMoreBit {
+		case tokEndElement:
+			p.pos++
+			return node, nil
+		case tokEOF:
+			return node, nil
+		case tokOpenStart:
+			child, err := p.element()
+			if err != nil {
+				return nil, err
+			}
+			node.Children = append(node.Children, child)
+		case tokTemplate:
+			children, err := p.template()
+			if err != nil {
+				return nil, err
+			}
+			node.Children = append(node.Children, children...)
+		default:
+			children, err := p.content(&node.Text, node)
+			if err != nil {
+				return nil, err
+			}
+			node.Children = append(node.Children, children...)
+		}
+	}
+}
+
+// content decodes one text-like token into text. Substitutions holding
+// BinXML return elements instead, which only an element can take.
+func (p *binXML) content(text *strings.Builder, parent *xmlNode) ([]*xmlNode, error) {
+	tokenPos := p.pos
+	tok, err := p.u8()
+	if err != nil {
+		return nil, err
+	}
+	switch tok &^ tokMoreBit {
+	case tokValue:
+		p.pos++ // value type, always a string here
+		s, err := p.lengthPrefixed()
+		text.WriteString(s)
+		return nil, err
+	case tokCDATA, tokPIData:
+		s, err := p.lengthPrefixed()
+		if tok&^tokMoreBit == tokCDATA {
+			text.WriteString(s)
+		}
+		return nil, err
+	case tokCharRef:
+		r, err := p.u16()
+		text.WriteRune(rune(r))
+		return nil, err
+	case tokEntityRef:
+		name, err := p.name(tokenPos)
+		text.WriteString(map[string]string{"amp": "&", "lt": "<", "gt": ">", "quot": `"`, "apos": "'"}[name])
+		return nil, err
+	case tokPITarget:
+		_, err := p.name(tokenPos)
+		return nil, err
+	case tokSubstitution, tokOptionalSubst:
+		id, err := p.u16()
+		if err != nil {
+			return nil, err
+		}
+		p.pos++ // declared type; the value's own type wins
+		if int(id) >= len(p.values) {
+			return nil, nil
+		}
+		value := p.values[id]
+		if value.size == 0 {
+			return nil, nil
+		}
+		if value.typ == valBinXML {
+			if err := p.spend(); err != nil {
+				return nil, err
+			}
+			nodes, err := p.nested(value.offset, nil).fragment()
+			if err != nil {
+				return nil, err
+			}
+			if parent == nil {
+				return nil, nil
+			}
+			return nodes, nil
+		}
+		text.WriteString(renderValue(value.typ, p.chunk[value.offset:value.offset+value.size]))
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unexpected BinXML token 0x%02x at offset %d", tok, tokenPos)
+}
+
+// decodeUTF16 turns little-endian UTF-16 into a string, dropping trailing NULs
+func decodeUTF16(b []byte) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+}
+
+// filetime converts 100ns intervals since 1601 to a time
+func filetime(v uint64) time.Time {
+	const epochDelta = 116444736000000000
+	if v < epochDelta {
+		return time.Unix(0, 0).UTC()
+	}
+	return time.Unix(0, int64(v-epochDelta)*100).UTC()
+}
+
+// renderValue formats a substitution value the way Windows renders it in XML
+func renderValue(typ byte, b []byte) string {
+	if typ&valArray != 0 {
+		return strings.Join(renderArray(typ&^valArray, b), ",")
+	}
+	le := binary.LittleEndian
+	switch typ {
+	case valNull:
+		return ""
+	case valWString:
+		return decodeUTF16(b)
+	case valString:
+		return strings.TrimRight(string(b), "\x00")
+	case valInt8:
+		if len(b) >= 1 {
+			return strconv.Itoa(int(int8(b[0])))
+		}
+	case valUint8:
+		if len(b) >= 1 {
+			return strconv.Itoa(int(b[0]))
+		}
+	case valInt16:
+		if len(b) >= 2 {
+			return strconv.Itoa(int(int16(le.Uint16(b))))
+		}
+	case valUint16:
+		if len(b) >= 2 {
+			return strconv.Itoa(int(le.Uint16(b)))
+		}
+	case valInt32:
+		if len(b) >= 4 {
+			return strconv.Itoa(int(int32(le.Uint32(b))))
+		}
+	case valUint32:
+		if len(b) >= 4 {
+			return strconv.FormatUint(uint64(le.Uint32(b)), 10)
+		}
+	case valInt64:
+		if len(b) >= 8 {
+			return strconv.FormatInt(int64(le.Uint64(b)), 10)
+		}
+	case valUint64:
+		if len(b) >= 8 {
+			return strconv.FormatUint(le.Uint64(b), 10)
+		}
+	case valReal32:
+		if len(b) >= 4 {
+			return strconv.FormatFloat(float64(math.Float32frombits(le.Uint32(b))), 'g', -1, 32)
+		}
+	case valReal64:
+		if len(b) >= 8 {
+			return strconv.FormatFloat(math.Float64frombits(le.Uint64(b)), 'g', -1, 64)
+		}
+	case valBool:
+		if len(b) >= 4 {
+			return strconv.FormatBool(le.Uint32(b) != 0)
+		}
+	case valBinary:
+		return strings.ToUpper(hex.EncodeToString(b))
+	case valGUID:
+		if len(b) >= 16 {
+			return fmt.Sprintf("{%08X-%04X-%04X-%X-%X}", le.Uint32(b), le.Uint16(b[4:]), le.Uint16(b[6:]), b[8:10], b[10:16])
+		}
+	case valSizeT, valHexInt32, valHexInt64:
+		switch len(b) {
+		case 4:
+			return fmt.Sprintf("0x%x", le.Uint32(b))
+		case 8:
+			return fmt.Sprintf("0x%x", le.Uint64(b))
+		}
+	case valFiletime:
+		if len(b) >= 8 {
+			return filetime(le.Uint64(b)).Format(time.RFC3339Nano)
+		}
+	case valSystemtime:
+		if len(b) >= 16 {
+			t := time.Date(int(le.Uint16(b)), time.Month(le.Uint16(b[2:])), int(le.Uint16(b[6:])),
+				int(le.Uint16(b[8:])), int(le.Uint16(b[10:])), int(le.Uint16(b[12:])), int(le.Uint16(b[14:]))*int(time.Millisecond), time.UTC)
+			return t.Format(time.RFC3339Nano)
+		}
+	case valSID:
+		return renderSID(b)
+	}
+	return strings.ToUpper(hex.EncodeToString(b))
+}
+
+// renderArray splits an array value into its items
+func renderArray(typ byte, b []byte) []string {
+	items := []string{}
+	switch typ {
+	case valWString:
+		for _, s := range strings.Split(decodeUTF16(b), "\x00") {
+			items = append(items, s)
+		}
+		return items
+	case valString:
+		return strings.Split(strings.TrimRight(string(b), "\x00"), "\x00")
+	}
+	size := map[byte]int{
+		valInt8: 1, valUint8: 1, valInt16: 2, valUint16: 2, valInt32: 4, valUint32: 4,
+		valInt64: 8, valUint64: 8, valReal32: 4, valReal64: 8, valBool: 4, valGUID: 16,
+		valFiletime: 8, valSystemtime: 16, valHexInt32: 4, valHexInt64: 8,
+	}[typ]
+	if size == 0 {
+		return []string{renderValue(valBinary, b)}
+	}
+	for i := 0; i+size <= len(b); i += size {
+		items = append(items, renderValue(typ, b[i:i+size]))
+	}
+	return items
+}
+
+// renderSID formats a binary security identifier as S-1-5-...
+func renderSID(b []byte) string {
+	if len(b) < 8 {
+		return strings.ToUpper(hex.EncodeToString(b))
+	}
+	var authority uint64
+	for _, c := range b[2:8] {
+		authority = authority<<8 | uint64(c)
+	}
+	sid := fmt.Sprintf("S-%d-%d", b[0], authority)
+	for i := 0; i < int(b[1]) && 8+i*4+4 <= len(b); i++ {
+		sid += "-" + strconv.FormatUint(uint64(binary.LittleEndian.Uint32(b[8+i*4:])), 10)
+	}
+	return sid
+}
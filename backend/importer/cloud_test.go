@@ -0,0 +1,74 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mapping is what a parser should make of one input file
+type mapping struct {
+	name     string
+	data     string
+	logTypes []string
+	times    []float64
+	skipped  int
+}
+
+func checkMappings(t *testing.T, parser Parser, tests []mapping) {
+	t.Helper()
+	for _, tt := range tests {
+		events, skipped := parseString(t, parser, tt.name, tt.data)
+		logTypes, times := []string{}, []float64{}
+		for _, event := range events {
+			logType, _ := event["log_type"].(string)
+			ms, _ := event["@timestamp"].(float64)
+			logTypes = append(logTypes, logType)
+			times = append(times, ms)
+		}
+		if !reflect.DeepEqual(logTypes, tt.logTypes) || !reflect.DeepEqual(times, tt.times) || skipped != tt.skipped {
+			t.Errorf("%s: got %v at %v with %d skipped, want %v at %v with %d skipped",
+				tt.name, logTypes, times, skipped, tt.logTypes, tt.times, tt.skipped)
+		}
+	}
+}
+
+func TestParseCloudTrail(t *testing.T) {
+	const login = `{"eventTime":"2024-03-01T12:00:00Z","eventName":"ConsoleLogin","eventSource":"signin.amazonaws.com"}`
+	const assume = `{"eventTime":"2024-03-01T12:00:05Z","eventName":"AssumeRole","eventSource":"sts.amazonaws.com"}`
+	checkMappings(t, ParseCloudTrail, []mapping{
+		{"s3 delivery", `{"Records":[` + login + `,` + assume + `]}`, []string{"cloudtrail", "cloudtrail"}, []float64{1709294400000, 1709294405000}, 0},
+		{"array", `[` + login + `, {"eventName":"NoTime"}, 42]`, []string{"cloudtrail"}, []float64{1709294400000}, 2},
+		{"lines", login + "\n" + assume + "\n", []string{"cloudtrail", "cloudtrail"}, []float64{1709294400000, 1709294405000}, 0},
+	})
+
+	events, _ := parseString(t, ParseCloudTrail, "fields", `{"Records":[`+login+`]}`)
+	if events[0]["eventName"] != "ConsoleLogin" || events[0]["eventSource"] != "signin.amazonaws.com" {
+		t.Errorf("CloudTrail fields not kept: %v", events[0])
+	}
+	if _, _, err := ParseCloudTrail(File{Name: "digest", Reader: strings.NewReader(`{"digestStartTime":"2024-03-01T11:00:00Z","digestEndTime":"2024-03-01T12:00:00Z"}`)}); err == nil {
+		t.Error("digest file accepted")
+	}
+}
+
+func TestParseAzureAD(t *testing.T) {
+	const signin = `{"id":"1","createdDateTime":"2024-03-01T12:00:00Z","userPrincipalName":"alice@example.com","status":{"errorCode":0}}`
+	const audit = `{"id":"2","activityDateTime":"2024-03-01T12:00:10Z","activityDisplayName":"Add member to group"}`
+	const diagSignin = `{"time":"2024-03-01T12:00:20Z","category":"NonInteractiveUserSignInLogs","properties":{"userPrincipalName":"bob@example.com"}}`
+	const diagAudit = `{"time":"2024-03-01T12:00:30Z","category":"AuditLogs","properties":{"activityDisplayName":"Update user"}}`
+	checkMappings(t, ParseAzureAD, []mapping{
+		{"portal download", `[` + signin + `,` + audit + `]`, []string{"azuread.signin", "azuread.audit"}, []float64{1709294400000, 1709294410000}, 0},
+		{"graph page", `{"@odata.nextLink":"https://graph.microsoft.com/next","value":[` + signin + `]}`, []string{"azuread.signin"}, []float64{1709294400000}, 0},
+		{"diagnostic settings", `{"records":[` + diagSignin + `,` + diagAudit + `]}`, []string{"azuread.signin", "azuread.audit"}, []float64{1709294420000, 1709294430000}, 0},
+		{"other records", `[{"time":"2024-03-01T12:00:00Z","category":"ProvisioningLogs","properties":{}}, {"id":"3"}]`, []string{}, []float64{}, 2},
+	})
+}
+
+func TestParseOkta(t *testing.T) {
+	const login = `{"uuid":"a","published":"2024-03-01T12:00:00.000Z","eventType":"user.session.start","actor":{"alternateId":"alice@example.com"}}`
+	const mfa = `{"uuid":"b","published":"2024-03-01T12:00:01.500Z","eventType":"user.authentication.auth_via_mfa"}`
+	checkMappings(t, ParseOkta, []mapping{
+		{"api array", `[` + login + `,` + mfa + `]`, []string{"okta", "okta"}, []float64{1709294400000, 1709294401500}, 0},
+		{"lines", login + "\n" + `{"uuid":"c"}` + "\n" + mfa + "\n", []string{"okta", "okta"}, []float64{1709294400000, 1709294401500}, 1},
+	})
+}
@@ -0,0 +1,167 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	evtxHeaderSize  = 4096
+	evtxChunkSize   = 65536
+	evtxRecordStart = 512
+)
+
+var (
+	evtxFileMagic   = []byte("ElfFile\x00")
+	evtxChunkMagic  = []byte("ElfChnk\x00")
+	evtxRecordMagic = []byte{0x2a, 0x2a, 0x00, 0x00}
+)
+
+func init() {
+	Register("evtx", ParseEVTX)
+}
+
+// ParseEVTX reads a Windows event log file. Each record becomes an event with
+// the System fields and the EventData (or UserData) fields flattened into it,
+// so Sysmon's Image, CommandLine, Hashes and the rest keep their names.
+func ParseEVTX(file File) ([]map[string]interface{}, int, error) {
+	data, err := io.ReadAll(file.Reader)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read file: %v", err)
+	}
+	if len(data) < evtxHeaderSize || !bytes.Equal(data[:8], evtxFileMagic) {
+		return nil, 0, fmt.Errorf("not an EVTX file")
+	}
+
+	events := []map[string]interface{}{}
+	skipped := 0
+	// A file cut off mid-chunk still has whole records before the cut
+	for offset := evtxHeaderSize; offset+evtxRecordStart <= len(data); offset += evtxChunkSize {
+		chunk := data[offset:min(offset+evtxChunkSize, len(data))]
+		if !bytes.Equal(chunk[:8], evtxChunkMagic) {
+			continue // unused chunk
+		}
+		chunkEvents, chunkSkipped := parseChunk(chunk)
+		events = append(events, chunkEvents...)
+		skipped += chunkSkipped
+	}
+	return events, skipped, nil
+}
+
+// parseChunk reads every record in a chunk
+func parseChunk(chunk []byte) ([]map[string]interface{}, int) {
+	events := []map[string]interface{}{}
+	skipped := 0
+	free := int(binary.LittleEndian.Uint32(chunk[48:]))
+	if free > len(chunk) || free < evtxRecordStart {
+		free = len(chunk)
+	}
+	for pos := evtxRecordStart; pos+24 <= free; {
+		if !bytes.Equal(chunk[pos:pos+4], evtxRecordMagic) {
+			break
+		}
+		size := int(binary.LittleEndian.Uint32(chunk[pos+4:]))
+		if size < 28 || pos+size > len(chunk) {
+			skipped++
+			break
+		}
+		recordID := binary.LittleEndian.Uint64(chunk[pos+8:])
+		written := filetime(binary.LittleEndian.Uint64(chunk[pos+16:]))
+
+		nodes, err := newBinXML(chunk[:pos+size-4], pos+24).fragment()
+		if err != nil || len(nodes) == 0 {
+			skipped++
+		} else {
+			events = append(events, flattenEvent(nodes[0], recordID, written))
+		}
+		pos += size
+	}
+	return events, skipped
+}
+
+// flattenEvent turns an <Event> into a flat event. System fields keep their
+// element names and attributes are named Element.Attribute, except the
+// common TimeCreated and Provider. EventData fields that clash with a System
+// field are prefixed with EventData_.
+func flattenEvent(root *xmlNode, recordID uint64, written time.Time) map[string]interface{} {
+	event := map[string]interface{}{"log_type": "evtx"}
+
+	if system := root.child("System"); system != nil {
+		for _, field := range system.Children {
+			text := strings.TrimSpace(field.Text.String())
+			if text != "" {
+				event[field.Name] = text
+			}
+			for attr, value := range field.Attrs {
+				key := field.Name + "." + attr
+				switch {
+				case field.Name == "TimeCreated" && attr == "SystemTime":
+					key = "TimeCreated"
+				case field.Name == "Provider" && attr == "Name":
+					key = "Provider"
+				}
+				event[key] = value
+			}
+		}
+	}
+
+	data := map[string]interface{}{}
+	if eventData := root.child("EventData"); eventData != nil {
+		flattenData(eventData, data)
+	}
+	if userData := root.child("UserData"); userData != nil {
+		for _, child := range userData.Children {
+			flattenData(child, data)
+		}
+	}
+	for key, value := range data {
+		if _, clash := event[key]; clash {
+			key = "EventData_" + key
+		}
+		event[key] = value
+	}
+
+	if _, ok := event["EventRecordID"]; !ok {
+		event["EventRecordID"] = strconv.FormatUint(recordID, 10)
+	}
+	timestamp := written
+	if created, ok := event["TimeCreated"].(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, created); err == nil {
+			timestamp = t
+		}
+	}
+	event["@timestamp"] = float64(timestamp.UnixMilli())
+	return event
+}
+
+// flattenData reads <Data Name="x">value</Data> pairs and plain child
+// elements. Unnamed Data values are collected under Data.
+func flattenData(parent *xmlNode, into map[string]interface{}) {
+	unnamed := []interface{}{}
+	for _, field := range parent.Children {
+		text := field.Text.String()
+		if name, ok := field.Attrs["Name"]; ok && field.Name == "Data" {
+			into[name] = text
+			continue
+		}
+		if field.Name == "Data" {
+			if text != "" {
+				unnamed = append(unnamed, text)
+			}
+			continue
+		}
+		if len(field.Children) > 0 {
+			flattenData(field, into)
+			continue
+		}
+		into[field.Name] = text
+	}
+	if len(unnamed) > 0 {
+		into["Data"] = unnamed
+	}
+}
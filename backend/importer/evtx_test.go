@@ -0,0 +1,90 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// parseFixture runs a parser over a file in testdata
+func parseFixture(t *testing.T, parser Parser, name string) ([]map[string]interface{}, int) {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	events, skipped, err := parser(File{Name: name, Reader: f})
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return events, skipped
+}
+
+// users lists the TargetUserName of each event
+func users(events []map[string]interface{}) []interface{} {
+	out := []interface{}{}
+	for _, event := range events {
+		out = append(out, event["TargetUserName"])
+	}
+	return out
+}
+
+func TestParseEVTX(t *testing.T) {
+	events, skipped := parseFixture(t, ParseEVTX, "valid.evtx")
+	if skipped != 0 || len(events) != 2 {
+		t.Fatalf("got %d events and %d skipped, want 2 and 0", len(events), skipped)
+	}
+	want := map[string]interface{}{
+		"log_type":       "evtx",
+		"Provider":       "Microsoft-Windows-Security-Auditing",
+		"EventID":        "4624",
+		"TimeCreated":    "2024-03-01T12:00:01Z",
+		"EventRecordID":  "1001",
+		"Computer":       "WKS-01.corp.example",
+		"TargetUserName": "bob",
+		"LogonType":      "3",
+		"@timestamp":     float64(time.Date(2024, 3, 1, 12, 0, 1, 0, time.UTC).UnixMilli()),
+	}
+	// The second record reuses the first record's template definition
+	if !reflect.DeepEqual(events[1], want) {
+		t.Errorf("event = %v, want %v", events[1], want)
+	}
+}
+
+func TestParseEVTXDamagedFiles(t *testing.T) {
+	tests := []struct {
+		file    string
+		users   []interface{}
+		skipped int
+	}{
+		// The records before the cut survive; the one it cuts through is skipped
+		{"truncated.evtx", []interface{}{"alice", "bob"}, 1},
+		{"bad_template.evtx", []interface{}{"alice", "bob"}, 1},
+		// Templates that double at every level run out of budget instead of hanging
+		{"blowup.evtx", []interface{}{"alice"}, 1},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		events, skipped := parseFixture(t, ParseEVTX, tt.file)
+		if got := users(events); !reflect.DeepEqual(got, tt.users) || skipped != tt.skipped {
+			t.Errorf("%s: got users %v and %d skipped, want %v and %d", tt.file, got, skipped, tt.users, tt.skipped)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s took %v", tt.file, elapsed)
+		}
+	}
+}
+
+func TestParseEVTXRejectsOtherFiles(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "gen_evtx.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, _, err := ParseEVTX(File{Name: "gen_evtx.go", Reader: f}); err == nil {
+		t.Error("a Go file parsed as EVTX")
+	}
+}
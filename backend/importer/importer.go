@@ -0,0 +1,230 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+
+	"backend/capture"
+)
+
+// Parser reads one exported log file into events whose @timestamp is an
+// epoch time capture.EventTime understands. skipped counts records that
+// could not be read; they don't fail the import.
+type Parser func(file File) (events []map[string]interface{}, skipped int, err error)
+
+var (
+	parsersMu sync.Mutex
+	parsers   = map[string]Parser{}
+)
+
+// Register makes a file format available by name
+func Register(format string, parser Parser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	parsers[format] = parser
+}
+
+// Formats lists the registered file formats
+func Formats() []string {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	names := make([]string, 0, len(parsers))
+	for name := range parsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// File is one file to import
+type File struct {
+	Name   string
+	Reader io.Reader
+}
+
+// Result is an imported scenario: events with relative offsets, in time order
+type Result struct {
+	Hits     []interface{} `json:"hits"`
+	Format   string        `json:"format"`
+	Files    int           `json:"files"`
+	Skipped  int           `json:"skipped"`
+	Warnings []string      `json:"warnings"`
+}
+
+// Import parses every file in the given format and merges them into one
+// scenario ordered by event time
+func Import(format string, files []File) (Result, error) {
+	parsersMu.Lock()
+	parser, ok := parsers[format]
+	parsersMu.Unlock()
+	if !ok {
+		return Result{}, fmt.Errorf("unknown import format %q", format)
+	}
+
+	result := Result{Hits: []interface{}{}, Format: format, Files: len(files), Warnings: []string{}}
+	events := []map[string]interface{}{}
+	for _, file := range files {
+		reader, err := decompress(file.Reader)
+		if err != nil {
+			return Result{}, fmt.Errorf("%s: %v", file.Name, err)
+		}
+		file.Reader = reader
+		parsed, skipped, err := parser(file)
+		if err != nil {
+			return Result{}, fmt.Errorf("%s: %v", file.Name, err)
+		}
+		if skipped > 0 {
+			result.Skipped += skipped
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: skipped %d records that could not be read", file.Name, skipped))
+		}
+		events = append(events, parsed...)
+	}
+
+	untimed := 0
+	for _, event := range events {
+		if _, ok := capture.EventTime(event["@timestamp"]); !ok {
+			untimed++
+		}
+	}
+	if untimed > 0 {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("%d events have no timestamp and were placed at the start", untimed))
+	}
+	for _, event := range capture.RelativeOffsets(events) {
+		result.Hits = append(result.Hits, event)
+	}
+	log.Printf("📦 Imported %d %s events from %d files", len(result.Hits), format, len(files))
+	return result, nil
+}
+
+// maxDecompressed caps what one gzipped file may expand to: ten times the
+// 100MB an import request may upload, well past any real log's ratio
+var maxDecompressed int64 = 1 << 30
+
+// decompress transparently unwraps gzipped files, such as rotated logs or
+// objects fetched from S3. Reading fails once a file expands past
+// maxDecompressed, so a gzip bomb can't exhaust memory.
+func decompress(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(2)
+	if err != nil || magic[0] != 0x1f || magic[1] != 0x8b {
+		return buffered, nil
+	}
+	gz, err := gzip.NewReader(buffered)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip file: %v", err)
+	}
+	return &cappedReader{r: io.LimitReader(gz, maxDecompressed+1), max: maxDecompressed}, nil
+}
+
+// cappedReader fails a read that goes past max bytes rather than ending
+// quietly, so a truncated file isn't taken for a complete one
+type cappedReader struct {
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+func (c *cappedReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+	if c.read > c.max {
+		return n - int(c.read-c.max), fmt.Errorf("gzip file expands to more than %d bytes", c.max)
+	}
+	return n, err
+}
+
+// maxLineSize caps one line of a line-oriented log
+const maxLineSize = 4 << 20
+
+// readJSONLines decodes a file holding one JSON object per line, calling fn
+// for each. Lines that aren't JSON objects are counted as skipped.
+func readJSONLines(r io.Reader, fn func(record map[string]interface{})) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	skipped := 0
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			skipped++
+			continue
+		}
+		fn(record)
+	}
+	if err := scanner.Err(); err != nil {
+		return skipped, fmt.Errorf("failed to read file: %v", err)
+	}
+	return skipped, nil
+}
+
+// eventTime sets @timestamp from a record's own time field, leaving events
+// without one for Import to report
+func eventTime(event map[string]interface{}, value interface{}) {
+	if ms, ok := capture.EventTime(value); ok {
+		event["@timestamp"] = float64(ms)
+	}
+}
+
+// readJSONRecords decodes a JSON export in whichever shape it comes: an
+// array of records, one record per line, or an object wrapping the array
+// under one of the given keys (Records, value and so on). Items that aren't
+// objects are counted as skipped.
+func readJSONRecords(r io.Reader, wrappers ...string) ([]map[string]interface{}, int, error) {
+	records := []map[string]interface{}{}
+	skipped := 0
+	add := func(items []interface{}) {
+		for _, item := range items {
+			if record, ok := item.(map[string]interface{}); ok {
+				records = append(records, record)
+			} else {
+				skipped++
+			}
+		}
+	}
+
+	decoder := json.NewDecoder(r)
+	for {
+		var value interface{}
+		err := decoder.Decode(&value)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if len(records) == 0 {
+				return nil, 0, fmt.Errorf("not a JSON export: %v", err)
+			}
+			// The rest of the file can't be resynchronised after bad JSON
+			skipped++
+			break
+		}
+		switch v := value.(type) {
+		case []interface{}:
+			add(v)
+		case map[string]interface{}:
+			wrapped := false
+			for _, key := range wrappers {
+				if items, ok := v[key].([]interface{}); ok {
+					add(items)
+					wrapped = true
+					break
+				}
+			}
+			if !wrapped {
+				records = append(records, v)
+			}
+		default:
+			skipped++
+		}
+	}
+	return records, skipped, nil
+}
@@ -0,0 +1,54 @@
+package importer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+)
+
+func gzipped(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	defer func(max int64) { maxDecompressed = max }(maxDecompressed)
+	maxDecompressed = 1024
+
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+		err   string
+	}{
+		{"plain", []byte(`{"a":1}`), `{"a":1}`, ""},
+		{"empty", []byte{}, "", ""},
+		{"gzipped", gzipped(t, `{"a":1}`), `{"a":1}`, ""},
+		{"exactly at the cap", gzipped(t, strings.Repeat("x", 1024)), strings.Repeat("x", 1024), ""},
+		{"past the cap", gzipped(t, strings.Repeat("x", 1025)), "", "expands to more than 1024 bytes"},
+		{"corrupt gzip", []byte{0x1f, 0x8b, 0}, "", "invalid gzip file"},
+	}
+	for _, tt := range tests {
+		reader, err := decompress(bytes.NewReader(tt.input))
+		var got []byte
+		if err == nil {
+			got, err = io.ReadAll(reader)
+		}
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: err = %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || string(got) != tt.want {
+			t.Errorf("%s: got %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// pcapngMagic is the section header block type that starts a pcapng file
+var pcapngMagic = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+
+func init() {
+	Register("pcap", ParsePcap)
+}
+
+// packetReader is what pcapgo's pcap and pcapng readers have in common
+type packetReader interface {
+	ReadPacketData() ([]byte, gopacket.CaptureInfo, error)
+}
+
+// ParsePcap reads a pcap or pcapng capture and derives network events from
+// it: one pcap.conn event per TCP, UDP or ICMP flow, a pcap.dns event per DNS
+// query and answer, and a pcap.http event per HTTP request. Events are timed
+// by when their packets were captured. Frames that aren't IP, such as ARP,
+// are ignored rather than counted as skipped.
+func ParsePcap(file File) ([]map[string]interface{}, int, error) {
+	reader := bufio.NewReader(file.Reader)
+	magic, err := reader.Peek(4)
+	if err != nil {
+		return nil, 0, fmt.Errorf("not a pcap file")
+	}
+
+	var packets packetReader
+	var linkType func(gopacket.CaptureInfo) layers.LinkType
+	if bytes.Equal(magic, pcapngMagic) {
+		// Each pcapng interface has its own link type, so a capture taken on
+		// several interfaces is decoded packet by packet
+		ng, err := pcapgo.NewNgReader(reader, pcapgo.NgReaderOptions{WantMixedLinkType: true})
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read pcapng: %v", err)
+		}
+		packets = ng
+		linkType = func(info gopacket.CaptureInfo) layers.LinkType {
+			iface, _ := ng.Interface(info.InterfaceIndex)
+			return iface.LinkType
+		}
+	} else {
+		r, err := pcapgo.NewReader(reader)
+		if err != nil {
+			return nil, 0, fmt.Errorf("not a pcap file: %v", err)
+		}
+		packets = r
+		linkType = func(gopacket.CaptureInfo) layers.LinkType { return r.LinkType() }
+	}
+
+	events := []map[string]interface{}{}
+	flows := &pcapFlows{active: map[string]*pcapFlow{}}
+	skipped := 0
+	for {
+		data, info, err := packets.ReadPacketData()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break // a truncated last packet is common in cut-down captures
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read packet: %v", err)
+		}
+		packet := gopacket.NewPacket(data, linkType(info), gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+		if !decodePacket(packet, info.Timestamp, flows, &events) {
+			skipped++
+		}
+	}
+
+	conns := flows.done
+	for _, flow := range flows.active {
+		conns = append(conns, flow)
+	}
+	sort.Slice(conns, func(a, b int) bool { return conns[a].first.Before(conns[b].first) })
+	for _, flow := range conns {
+		events = append(events, flow.event())
+	}
+	return events, skipped, nil
+}
+
+// pcapFlowTimeout is how long a flow can sit idle before the next packet on
+// its addresses and ports starts a new connection. TCP gets longer, as
+// Zeek gives it, since quiet keep-alive connections are common.
+func pcapFlowTimeout(proto string) time.Duration {
+	if proto == "tcp" {
+		return 5 * time.Minute
+	}
+	return time.Minute
+}
+
+// pcapFlows holds the flows still open and those that went idle
+type pcapFlows struct {
+	active map[string]*pcapFlow
+	done   []*pcapFlow
+}
+
+// pcapFlow tallies one connection, seen from the side that sent first
+type pcapFlow struct {
+	proto            string
+	srcIP, dstIP     string
+	srcPort, dstPort int
+	first, last      time.Time
+	origPackets      int
+	origBytes        int
+	respPackets      int
+	respBytes        int
+	flags            map[string]bool
+	synAck           bool
+}
+
+// decodePacket adds what a packet says to its flow and emits any DNS or HTTP
+// event it carries. Frames that decode cleanly but carry no IP, such as ARP,
+// are ignored; it reports false only for packets it couldn't decode.
+func decodePacket(packet gopacket.Packet, ts time.Time, flows *pcapFlows, events *[]map[string]interface{}) bool {
+	var src, dst net.IP
+	switch ip := packet.NetworkLayer().(type) {
+	case *layers.IPv4:
+		src, dst = ip.SrcIP, ip.DstIP
+	case *layers.IPv6:
+		src, dst = ip.SrcIP, ip.DstIP
+	default:
+		return packet.ErrorLayer() == nil
+	}
+	if src == nil {
+		return false // the IP header itself was cut short
+	}
+	srcIP, dstIP := src.String(), dst.String()
+
+	proto := "ip"
+	srcPort, dstPort := 0, 0
+	var tcp *layers.TCP
+	var payload []byte
+	switch transport := packet.TransportLayer().(type) {
+	case *layers.TCP:
+		proto, tcp = "tcp", transport
+		srcPort, dstPort = int(transport.SrcPort), int(transport.DstPort)
+		payload = transport.Payload
+	case *layers.UDP:
+		proto = "udp"
+		srcPort, dstPort = int(transport.SrcPort), int(transport.DstPort)
+		payload = transport.Payload
+	default:
+		if packet.Layer(layers.LayerTypeICMPv4) != nil || packet.Layer(layers.LayerTypeICMPv6) != nil {
+			proto = "icmp"
+		}
+	}
+
+	size := len(packet.Data())
+	key := fmt.Sprintf("%s|%s|%d|%s|%d", proto, srcIP, srcPort, dstIP, dstPort)
+	reverse := fmt.Sprintf("%s|%s|%d|%s|%d", proto, dstIP, dstPort, srcIP, srcPort)
+	found := key
+	flow, ok := flows.active[key]
+	if !ok {
+		found = reverse
+		flow, ok = flows.active[reverse]
+	}
+	if ok && ts.Sub(flow.last) > pcapFlowTimeout(proto) {
+		// The same addresses and ports after a long quiet spell are a new connection
+		delete(flows.active, found)
+		flows.done = append(flows.done, flow)
+		ok = false
+	}
+	if !ok {
+		flow = &pcapFlow{proto: proto, srcIP: srcIP, dstIP: dstIP, srcPort: srcPort, dstPort: dstPort, first: ts, flags: map[string]bool{}}
+		// A SYN-ACK seen first means the capture missed the SYN
+		if tcp != nil && tcp.SYN && tcp.ACK {
+			flow.srcIP, flow.dstIP, flow.srcPort, flow.dstPort = dstIP, srcIP, dstPort, srcPort
+			key = reverse
+		}
+		flows.active[key] = flow
+	}
+	orig := flow.srcIP == srcIP && flow.srcPort == srcPort
+	if orig {
+		flow.origPackets++
+		flow.origBytes += size
+	} else {
+		flow.respPackets++
+		flow.respBytes += size
+	}
+	flow.last = ts
+	if tcp != nil {
+		flow.addFlags(tcp)
+	}
+
+	base := map[string]interface{}{
+		"src_ip":     srcIP,
+		"src_port":   srcPort,
+		"dst_ip":     dstIP,
+		"dst_port":   dstPort,
+		"proto":      proto,
+		"@timestamp": float64(ts.UnixMilli()),
+	}
+	if dns, ok := packet.Layer(layers.LayerTypeDNS).(*layers.DNS); ok {
+		*events = append(*events, dnsEvent(dns, base))
+	} else if tcp != nil && len(payload) > 0 {
+		if event := httpEvent(payload, base); event != nil {
+			*events = append(*events, event)
+		}
+	}
+	return true
+}
+
+// addFlags records the TCP flags seen on a flow
+func (f *pcapFlow) addFlags(tcp *layers.TCP) {
+	for name, set := range map[string]bool{"SYN": tcp.SYN, "ACK": tcp.ACK, "FIN": tcp.FIN, "RST": tcp.RST, "PSH": tcp.PSH, "URG": tcp.URG} {
+		if set {
+			f.flags[name] = true
+		}
+	}
+	if tcp.SYN && tcp.ACK {
+		f.synAck = true
+	}
+}
+
+// state sums up how a TCP connection went, in plain words
+func (f *pcapFlow) state() string {
+	switch {
+	case f.flags["SYN"] && !f.synAck && f.flags["RST"]:
+		return "rejected"
+	case f.flags["SYN"] && !f.synAck:
+		return "attempted"
+	case f.flags["RST"]:
+		return "reset"
+	case f.flags["FIN"]:
+		return "closed"
+	default:
+		return "established"
+	}
+}
+
+// event turns a flow into a pcap.conn event
+func (f *pcapFlow) event() map[string]interface{} {
+	event := map[string]interface{}{
+		"log_type":     "pcap.conn",
+		"src_ip":       f.srcIP,
+		"src_port":     f.srcPort,
+		"dst_ip":       f.dstIP,
+		"dst_port":     f.dstPort,
+		"proto":        f.proto,
+		"duration":     f.last.Sub(f.first).Seconds(),
+		"orig_packets": f.origPackets,
+		"orig_bytes":   f.origBytes,
+		"resp_packets": f.respPackets,
+		"resp_bytes":   f.respBytes,
+		"@timestamp":   float64(f.first.UnixMilli()),
+	}
+	if f.proto == "tcp" {
+		flags := []string{}
+		for _, name := range []string{"SYN", "ACK", "PSH", "URG", "FIN", "RST"} {
+			if f.flags[name] {
+				flags = append(flags, name)
+			}
+		}
+		event["tcp_flags"] = flags
+		event["conn_state"] = f.state()
+	}
+	return event
+}
+
+// dnsEvent turns a DNS message into a pcap.dns event
+func dnsEvent(dns *layers.DNS, base map[string]interface{}) map[string]interface{} {
+	event := base
+	event["log_type"] = "pcap.dns"
+	event["dns_id"] = int(dns.ID)
+	event["dns_type"] = "query"
+	if dns.QR {
+		event["dns_type"] = "answer"
+		event["rcode"] = dns.ResponseCode.String()
+	}
+	if len(dns.Questions) > 0 {
+		event["query"] = string(dns.Questions[0].Name)
+		event["qtype"] = dns.Questions[0].Type.String()
+	}
+	if dns.QR {
+		answers := []interface{}{}
+		for _, answer := range dns.Answers {
+			switch {
+			case answer.IP != nil:
+				answers = append(answers, answer.IP.String())
+			case len(answer.CNAME) > 0:
+				answers = append(answers, string(answer.CNAME))
+			case len(answer.PTR) > 0:
+				answers = append(answers, string(answer.PTR))
+			case len(answer.NS) > 0:
+				answers = append(answers, string(answer.NS))
+			case answer.MX.Name != nil:
+				answers = append(answers, string(answer.MX.Name))
+			case len(answer.TXTs) > 0:
+				for _, txt := range answer.TXTs {
+					answers = append(answers, string(txt))
+				}
+			}
+		}
+		event["answers"] = answers
+	}
+	return event
+}
+
+// httpEvent reads an HTTP request from the start of a TCP segment. Only the
+// request line and the headers in that segment are used; bodies and requests
+// split across segments are not reassembled.
+func httpEvent(payload []byte, base map[string]interface{}) map[string]interface{} {
+	space := bytes.IndexByte(payload, ' ')
+	if space < 3 || space > 7 || !isHTTPMethod(string(payload[:space])) {
+		return nil
+	}
+	line := payload
+	if end := bytes.Index(payload, []byte("\r\n")); end >= 0 {
+		line = payload[:end]
+	}
+	parts := strings.Fields(string(line))
+	if len(parts) != 3 || !strings.HasPrefix(parts[2], "HTTP/") {
+		return nil
+	}
+
+	event := base
+	event["log_type"] = "pcap.http"
+	event["method"] = parts[0]
+	event["uri"] = parts[1]
+	event["version"] = strings.TrimPrefix(parts[2], "HTTP/")
+
+	headers := http.Header{}
+	for _, header := range bytes.Split(payload[len(line):], []byte("\r\n")) {
+		if len(header) == 0 {
+			continue
+		}
+		if name, value, ok := strings.Cut(string(header), ":"); ok {
+			headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+	}
+	for field, header := range map[string]string{"host": "Host", "user_agent": "User-Agent", "referrer": "Referer", "content_type": "Content-Type"} {
+		if value := headers.Get(header); value != "" {
+			event[field] = value
+		}
+	}
+	if length := headers.Get("Content-Length"); length != "" {
+		var n int
+		if _, err := fmt.Sscanf(length, "%d", &n); err == nil {
+			event["request_body_len"] = n
+		}
+	}
+	return event
+}
+
+// isHTTPMethod reports whether a token is a request method
+func isHTTPMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodHead,
+		http.MethodOptions, http.MethodPatch, http.MethodConnect, http.MethodTrace:
+		return true
+	}
+	return false
+}
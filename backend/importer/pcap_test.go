@@ -0,0 +1,85 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// byType groups events by log_type
+func byType(events []map[string]interface{}) map[string][]map[string]interface{} {
+	groups := map[string][]map[string]interface{}{}
+	for _, event := range events {
+		logType, _ := event["log_type"].(string)
+		groups[logType] = append(groups[logType], event)
+	}
+	return groups
+}
+
+func TestParsePcap(t *testing.T) {
+	events, skipped := parseFixture(t, ParsePcap, "capture.pcap")
+	// The ARP request is ignored; only the cut-off IPv4 frame is skipped
+	if skipped != 1 {
+		t.Errorf("skipped = %d, want 1", skipped)
+	}
+	groups := byType(events)
+	if len(groups["pcap.dns"]) != 4 || len(groups["pcap.http"]) != 1 || len(groups["pcap.conn"]) != 3 {
+		t.Fatalf("got %d dns, %d http and %d conn events, want 4, 1 and 3", len(groups["pcap.dns"]), len(groups["pcap.http"]), len(groups["pcap.conn"]))
+	}
+
+	answer := groups["pcap.dns"][1]
+	if answer["dns_type"] != "answer" || answer["query"] != "example.com" || answer["rcode"] != "No Error" ||
+		!reflect.DeepEqual(answer["answers"], []interface{}{"93.184.216.34"}) {
+		t.Errorf("DNS answer = %v", answer)
+	}
+
+	http := groups["pcap.http"][0]
+	for field, want := range map[string]interface{}{"method": "GET", "uri": "/index.html", "host": "example.com", "user_agent": "curl/8.4.0", "dst_port": 80} {
+		if http[field] != want {
+			t.Errorf("HTTP %s = %v, want %v", field, http[field], want)
+		}
+	}
+
+	tests := []struct {
+		proto        string
+		dstPort      int
+		state        interface{}
+		origPackets  int
+		respPackets  int
+		timestampSec float64
+	}{
+		{"udp", 53, nil, 1, 1, 1709294400.01},
+		{"tcp", 80, "closed", 4, 2, 1709294400.1},
+		// The same UDP flow two minutes later, past the idle timeout
+		{"udp", 53, nil, 1, 1, 1709294520.0},
+	}
+	for i, tt := range tests {
+		conn := groups["pcap.conn"][i]
+		if conn["proto"] != tt.proto || conn["dst_port"] != tt.dstPort || conn["conn_state"] != tt.state ||
+			conn["orig_packets"] != tt.origPackets || conn["resp_packets"] != tt.respPackets ||
+			conn["@timestamp"] != tt.timestampSec*1000 || conn["src_ip"] != "10.0.0.5" {
+			t.Errorf("conn %d = %v", i, conn)
+		}
+	}
+}
+
+func TestParsePcapngMixedLinkTypes(t *testing.T) {
+	events, skipped := parseFixture(t, ParsePcap, "mixed.pcapng")
+	if skipped != 0 {
+		t.Errorf("skipped = %d, want 0", skipped)
+	}
+	groups := byType(events)
+	if len(groups["pcap.dns"]) != 4 || len(groups["pcap.conn"]) != 2 {
+		t.Fatalf("got %d dns and %d conn events, want 4 and 2 from both interfaces", len(groups["pcap.dns"]), len(groups["pcap.conn"]))
+	}
+	ports := []interface{}{groups["pcap.conn"][0]["src_port"], groups["pcap.conn"][1]["src_port"]}
+	if !reflect.DeepEqual(ports, []interface{}{53000, 53001}) {
+		t.Errorf("conn source ports = %v, want the Ethernet then the raw IP flow", ports)
+	}
+}
+
+func TestParsePcapRejectsOtherFiles(t *testing.T) {
+	if _, _, err := ParsePcap(File{Name: "x.pcap", Reader: strings.NewReader("not a capture")}); err == nil {
+		t.Error("ParsePcap accepted a text file")
+	}
+}
@@ -0,0 +1,57 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+func init() {
+	Register("suricata", ParseSuricata)
+	Register("network", ParseNetwork)
+}
+
+// ParseSuricata reads Suricata EVE JSON, one event per line. Events keep
+// every EVE field; log_type is suricata.<event_type>, e.g. suricata.alert.
+// Sensor stats records are dropped as they describe Suricata, not the network.
+func ParseSuricata(file File) ([]map[string]interface{}, int, error) {
+	events := []map[string]interface{}{}
+	skipped, err := readJSONLines(file.Reader, func(record map[string]interface{}) {
+		eventType, _ := record["event_type"].(string)
+		if eventType == "stats" {
+			return
+		}
+		if eventType == "" {
+			eventType = "unknown"
+		}
+		record["log_type"] = "suricata." + eventType
+		eventTime(record, record["timestamp"])
+		events = append(events, record)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return events, skipped, nil
+}
+
+// ParseNetwork reads either a Zeek log or Suricata EVE JSON, picking by the
+// first record, so conn.log, dns.log and eve.json can be merged into one
+// scenario in a single import
+func ParseNetwork(file File) ([]map[string]interface{}, int, error) {
+	// The scanner's buffer only grows as far as the first line needs; what
+	// it read is kept and replayed ahead of the rest for the chosen parser
+	var head bytes.Buffer
+	scanner := bufio.NewScanner(io.TeeReader(file.Reader, &head))
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	scanner.Scan()
+	rest := File{Name: file.Name, Reader: io.MultiReader(&head, file.Reader)}
+
+	var first map[string]interface{}
+	if json.Unmarshal(scanner.Bytes(), &first) == nil {
+		if _, ok := first["event_type"]; ok {
+			return ParseSuricata(rest)
+		}
+	}
+	return ParseZeek(rest)
+}
@@ -0,0 +1,61 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+)
+
+const eveJSON = `{"timestamp":"2024-03-01T12:00:00.123456+0000","event_type":"alert","src_ip":"10.0.0.5","dest_ip":"93.184.216.34","alert":{"signature_id":2100498,"signature":"GPL ATTACK_RESPONSE id check returned root"}}
+{"timestamp":"2024-03-01T12:00:01.000000+0000","event_type":"stats","stats":{"uptime":60}}
+{"timestamp":"2024-03-01T12:00:02.000000+0000","event_type":"dns","dns":{"rrname":"example.com"}}
+{"timestamp":"2024-03-01T12:00:03.000000+0000","src_ip":"10.0.0.9"}
+`
+
+func TestParseSuricata(t *testing.T) {
+	events, skipped := parseString(t, ParseSuricata, "eve.json", eveJSON)
+	if skipped != 0 || len(events) != 3 {
+		t.Fatalf("got %d events and %d skipped, want 3 and 0", len(events), skipped)
+	}
+	tests := []struct {
+		logType string
+		ms      float64
+	}{
+		{"suricata.alert", 1709294400123},
+		{"suricata.dns", 1709294402000},
+		{"suricata.unknown", 1709294403000},
+	}
+	for i, tt := range tests {
+		if events[i]["log_type"] != tt.logType || events[i]["@timestamp"] != tt.ms {
+			t.Errorf("event %d: log_type %v at %v, want %s at %v", i, events[i]["log_type"], events[i]["@timestamp"], tt.logType, tt.ms)
+		}
+	}
+	if alert, _ := events[0]["alert"].(map[string]interface{}); alert["signature_id"] != float64(2100498) {
+		t.Errorf("EVE fields not kept: %v", events[0])
+	}
+}
+
+func TestParseNetwork(t *testing.T) {
+	// A first line longer than the scanner's initial buffer must still be
+	// read whole and replayed to the parser
+	long := `{"timestamp":"2024-03-01T12:00:00Z","event_type":"http","http":{"url":"/` + strings.Repeat("a", 200*1024) + `"}}` + "\n"
+	tests := []struct {
+		name, data string
+		logTypes   []string
+	}{
+		{"eve.json", eveJSON, []string{"suricata.alert", "suricata.dns", "suricata.unknown"}},
+		{"eve.json", long + eveJSON, []string{"suricata.http", "suricata.alert", "suricata.dns", "suricata.unknown"}},
+		{"conn.log", zeekConnTSV, []string{"zeek.conn", "zeek.conn"}},
+		{"dns.log", `{"_path":"dns","ts":1709294400.5,"query":"example.com"}` + "\n", []string{"zeek.dns"}},
+		{"empty.log", "", nil},
+	}
+	for _, tt := range tests {
+		events, _ := parseString(t, ParseNetwork, tt.name, tt.data)
+		var got []string
+		for _, event := range events {
+			got = append(got, event["log_type"].(string))
+		}
+		if strings.Join(got, ",") != strings.Join(tt.logTypes, ",") {
+			t.Errorf("%s (%d bytes): log types %v, want %v", tt.name, len(tt.data), got, tt.logTypes)
+		}
+	}
+}
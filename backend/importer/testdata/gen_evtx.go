@@ -0,0 +1,297 @@
+//go:build ignore
+
+// gen_evtx writes the EVTX fixtures the importer tests read. Run it from
+// this directory with: go run gen_evtx.go
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"os"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	headerSize  = 4096
+	chunkSize   = 65536
+	recordStart = 512
+)
+
+// writer builds BinXML at a known chunk offset, since name and template
+// offsets are relative to the chunk
+type writer struct {
+	b    []byte
+	base int
+}
+
+func (w *writer) pos() int      { return w.base + len(w.b) }
+func (w *writer) u8(v byte)     { w.b = append(w.b, v) }
+func (w *writer) u16(v uint16)  { w.b = binary.LittleEndian.AppendUint16(w.b, v) }
+func (w *writer) u32(v uint32)  { w.b = binary.LittleEndian.AppendUint32(w.b, v) }
+func (w *writer) raw(b []byte)  { w.b = append(w.b, b...) }
+func (w *writer) str(s string)  { w.raw(utf16le(s)) }
+func (w *writer) fragmentHead() { w.raw([]byte{0x0f, 0x01, 0x01, 0x00}) }
+
+func utf16le(s string) []byte {
+	b := []byte{}
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, u)
+	}
+	return b
+}
+
+// name writes a name reference with the name inline after it
+func (w *writer) name(s string) {
+	w.u32(uint32(w.pos() + 4))
+	w.u32(0) // next name in the hash bucket
+	w.u16(0) // hash, unchecked
+	w.u16(uint16(len([]rune(s))))
+	w.str(s)
+	w.u16(0)
+}
+
+// open starts an element; attrs says whether an attribute list follows
+func (w *writer) open(name string, attrs bool) {
+	if attrs {
+		w.u8(0x41)
+	} else {
+		w.u8(0x01)
+	}
+	w.u16(0xffff) // dependency ID
+	w.u32(0)      // data size, unchecked
+	w.name(name)
+	if attrs {
+		w.u32(0) // attribute list size, unchecked
+	}
+}
+
+func (w *writer) attr(name string)        { w.u8(0x06); w.name(name) }
+func (w *writer) closeStart()             { w.u8(0x02) }
+func (w *writer) closeEmpty()             { w.u8(0x03) }
+func (w *writer) end()                    { w.u8(0x04) }
+func (w *writer) sub(id uint16, typ byte) { w.u8(0x0e); w.u16(id); w.u8(typ) }
+
+func (w *writer) text(s string) {
+	w.u8(0x05)
+	w.u8(0x01)
+	w.u16(uint16(len([]rune(s))))
+	w.str(s)
+}
+
+// value is one substitution value
+type value struct {
+	typ  byte
+	data []byte
+}
+
+func wstring(s string) value { return value{0x01, utf16le(s)} }
+func uint16v(v uint16) value { return value{0x06, binary.LittleEndian.AppendUint16(nil, v)} }
+func uint32v(v uint32) value { return value{0x08, binary.LittleEndian.AppendUint32(nil, v)} }
+func uint64v(v uint64) value { return value{0x0a, binary.LittleEndian.AppendUint64(nil, v)} }
+func filetimev(t time.Time) value {
+	return value{0x11, binary.LittleEndian.AppendUint64(nil, uint64(t.UnixNano()/100)+116444736000000000)}
+}
+
+// eventBody writes the body of a logon event template
+func eventBody(w *writer, def int) {
+	w.fragmentHead()
+	w.open("Event", false)
+	w.closeStart()
+	w.open("System", false)
+	w.closeStart()
+	w.open("Provider", true)
+	w.attr("Name")
+	w.sub(0, 0x01)
+	w.closeEmpty()
+	w.open("EventID", false)
+	w.closeStart()
+	w.sub(1, 0x06)
+	w.end()
+	w.open("TimeCreated", true)
+	w.attr("SystemTime")
+	w.sub(2, 0x11)
+	w.closeEmpty()
+	w.open("EventRecordID", false)
+	w.closeStart()
+	w.sub(3, 0x0a)
+	w.end()
+	w.open("Computer", false)
+	w.closeStart()
+	w.sub(4, 0x01)
+	w.end()
+	w.end()
+	w.open("EventData", false)
+	w.closeStart()
+	w.open("Data", true)
+	w.attr("Name")
+	w.text("TargetUserName")
+	w.closeStart()
+	w.sub(5, 0x01)
+	w.end()
+	w.open("Data", true)
+	w.attr("Name")
+	w.text("LogonType")
+	w.closeStart()
+	w.sub(6, 0x08)
+	w.end()
+	w.end()
+	w.end()
+	w.u8(0x00)
+}
+
+// instance writes a template instance. def is the chunk offset of an
+// existing definition, or 0 to define the template inline with body, which
+// is given the definition's offset.
+func (w *writer) instance(def int, body func(w *writer, def int), values []value) int {
+	w.u8(0x0c)
+	w.u8(0x01)
+	w.u32(1) // template ID
+	if def == 0 {
+		def = w.pos() + 4
+		w.u32(uint32(def))
+		w.u32(0)                // next template
+		w.raw(make([]byte, 16)) // GUID
+		sizeAt := len(w.b)
+		w.u32(0)
+		start := len(w.b)
+		body(w, def)
+		binary.LittleEndian.PutUint32(w.b[sizeAt:], uint32(len(w.b)-start))
+	} else {
+		w.u32(uint32(def))
+	}
+	w.u32(uint32(len(values)))
+	for _, v := range values {
+		w.u16(uint16(len(v.data)))
+		w.u8(v.typ)
+		w.u8(0)
+	}
+	for _, v := range values {
+		w.raw(v.data)
+	}
+	return def
+}
+
+// chunk collects records
+type chunk struct {
+	b      []byte
+	nextID uint64
+}
+
+func newChunk() *chunk {
+	c := &chunk{b: make([]byte, recordStart), nextID: 1}
+	copy(c.b, "ElfChnk\x00")
+	return c
+}
+
+// record adds a record whose BinXML the callback writes
+func (c *chunk) record(written time.Time, binxml func(w *writer)) {
+	start := len(c.b)
+	w := &writer{base: start + 24}
+	binxml(w)
+	size := 24 + len(w.b) + 4
+	rec := []byte{0x2a, 0x2a, 0x00, 0x00}
+	rec = binary.LittleEndian.AppendUint32(rec, uint32(size))
+	rec = binary.LittleEndian.AppendUint64(rec, c.nextID)
+	rec = binary.LittleEndian.AppendUint64(rec, uint64(written.UnixNano()/100)+116444736000000000)
+	rec = append(rec, w.b...)
+	rec = binary.LittleEndian.AppendUint32(rec, uint32(size))
+	c.b = append(c.b, rec...)
+	c.nextID++
+}
+
+func (c *chunk) bytes() []byte {
+	out := make([]byte, chunkSize)
+	copy(out, c.b)
+	binary.LittleEndian.PutUint32(out[48:], uint32(len(c.b)))
+	return out
+}
+
+func file(chunks ...[]byte) []byte {
+	out := make([]byte, headerSize)
+	copy(out, "ElfFile\x00")
+	for _, c := range chunks {
+		out = append(out, c...)
+	}
+	return out
+}
+
+var base = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// logon adds a logon event, defining the template if def is 0, and returns
+// the template's offset
+func (c *chunk) logon(def int, n int, user string) int {
+	c.record(base.Add(time.Duration(n)*time.Second), func(w *writer) {
+		w.fragmentHead()
+		def = w.instance(def, eventBody, []value{
+			wstring("Microsoft-Windows-Security-Auditing"),
+			uint16v(4624),
+			filetimev(base.Add(time.Duration(n) * time.Second)),
+			uint64v(uint64(1000 + n)),
+			wstring("WKS-01.corp.example"),
+			wstring(user),
+			uint32v(3),
+		})
+		w.u8(0x00)
+	})
+	return def
+}
+
+func write(name string, data []byte) {
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func main() {
+	// Two logons; the second reuses the first's template definition
+	valid := newChunk()
+	def := valid.logon(0, 0, "alice")
+	valid.logon(def, 1, "bob")
+	write("valid.evtx", file(valid.bytes()))
+
+	// A whole chunk, then a chunk cut off partway through its second record
+	first := newChunk()
+	first.logon(0, 0, "alice")
+	second := newChunk()
+	def = second.logon(0, 1, "bob")
+	cut := len(second.b)
+	second.logon(def, 2, "carol")
+	write("truncated.evtx", file(first.bytes(), second.bytes()[:cut+40]))
+
+	// A good record, then one whose template offset points past the chunk
+	bad := newChunk()
+	def = bad.logon(0, 0, "alice")
+	bad.logon(0xfffff0, 1, "mallory")
+	bad.logon(def, 2, "bob")
+	write("bad_template.evtx", file(bad.bytes()))
+
+	// A chain of templates that each instantiate the one before twice.
+	// Every level stays well inside the depth limit, but the last one
+	// expands to 2^28 elements.
+	blowup := newChunk()
+	blowup.record(base, func(w *writer) {
+		w.fragmentHead()
+		prev := w.instance(0, func(w *writer, _ int) {
+			w.fragmentHead()
+			w.open("Bomb", false)
+			w.closeEmpty()
+			w.u8(0x00)
+		}, nil)
+		for i := 0; i < 28; i++ {
+			inner := prev
+			prev = w.instance(0, func(w *writer, _ int) {
+				w.fragmentHead()
+				w.open("Bomb", false)
+				w.closeStart()
+				w.instance(inner, nil, nil)
+				w.instance(inner, nil, nil)
+				w.end()
+				w.u8(0x00)
+			}, nil)
+		}
+		w.u8(0x00)
+	})
+	blowup.logon(0, 1, "alice")
+	write("blowup.evtx", file(blowup.bytes()))
+}
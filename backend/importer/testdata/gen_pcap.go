@@ -0,0 +1,187 @@
+//go:build ignore
+
+// gen_pcap writes the pcap fixtures the importer tests read. Run it from
+// this directory with: go run gen_pcap.go
+package main
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+var (
+	base      = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clientMAC = net.HardwareAddr{0x02, 0, 0, 0, 0, 0x05}
+	routerMAC = net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01}
+	client    = net.IP{10, 0, 0, 5}
+	web       = net.IP{93, 184, 216, 34}
+	resolver  = net.IP{8, 8, 8, 8}
+)
+
+// frame is one captured packet
+type frame struct {
+	at   time.Duration
+	data []byte
+}
+
+func serialize(ls ...gopacket.SerializableLayer) []byte {
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ls...); err != nil {
+		log.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func ethernet(src, dst net.HardwareAddr, typ layers.EthernetType) *layers.Ethernet {
+	return &layers.Ethernet{SrcMAC: src, DstMAC: dst, EthernetType: typ}
+}
+
+func ipv4(src, dst net.IP, proto layers.IPProtocol) *layers.IPv4 {
+	return &layers.IPv4{Version: 4, TTL: 64, Protocol: proto, SrcIP: src, DstIP: dst}
+}
+
+// tcp builds a TCP segment; from the client unless reply is set
+func tcp(reply bool, flags string, payload string) []byte {
+	src, dst, srcMAC, dstMAC := client, web, clientMAC, routerMAC
+	seg := &layers.TCP{SrcPort: 52100, DstPort: 80, Window: 65535}
+	if reply {
+		src, dst, srcMAC, dstMAC = web, client, routerMAC, clientMAC
+		seg.SrcPort, seg.DstPort = 80, 52100
+	}
+	for _, f := range flags {
+		switch f {
+		case 'S':
+			seg.SYN = true
+		case 'A':
+			seg.ACK = true
+		case 'P':
+			seg.PSH = true
+		case 'F':
+			seg.FIN = true
+		}
+	}
+	ip := ipv4(src, dst, layers.IPProtocolTCP)
+	seg.SetNetworkLayerForChecksum(ip)
+	return serialize(ethernet(srcMAC, dstMAC, layers.EthernetTypeIPv4), ip, seg, gopacket.Payload(payload))
+}
+
+// dns builds a DNS query for example.com, or its answer
+func dns(link gopacket.SerializableLayer, srcPort layers.UDPPort, answer bool) []byte {
+	msg := &layers.DNS{
+		ID:        0x1234,
+		RD:        true,
+		Questions: []layers.DNSQuestion{{Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN}},
+	}
+	src, dst := client, resolver
+	udp := &layers.UDP{SrcPort: srcPort, DstPort: 53}
+	if answer {
+		src, dst = resolver, client
+		udp.SrcPort, udp.DstPort = 53, srcPort
+		msg.QR, msg.RA = true, true
+		msg.Answers = []layers.DNSResourceRecord{{Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN, TTL: 300, IP: web}}
+	}
+	ip := ipv4(src, dst, layers.IPProtocolUDP)
+	udp.SetNetworkLayerForChecksum(ip)
+	if link == nil {
+		return serialize(ip, udp, msg)
+	}
+	return serialize(link, ip, udp, msg)
+}
+
+func arp() []byte {
+	return serialize(ethernet(clientMAC, layers.EthernetBroadcast, layers.EthernetTypeARP), &layers.ARP{
+		AddrType:          layers.LinkTypeEthernet,
+		Protocol:          layers.EthernetTypeIPv4,
+		HwAddressSize:     6,
+		ProtAddressSize:   4,
+		Operation:         layers.ARPRequest,
+		SourceHwAddress:   clientMAC,
+		SourceProtAddress: client,
+		DstHwAddress:      make([]byte, 6),
+		DstProtAddress:    net.IP{10, 0, 0, 1},
+	})
+}
+
+// broken is an Ethernet frame whose IPv4 header is cut short
+func broken() []byte {
+	// Built by hand, as serializing pads Ethernet frames to the minimum size
+	frame := append(append(append([]byte{}, routerMAC...), clientMAC...), 0x08, 0x00)
+	return append(frame, 0x45, 0x00, 0x00)
+}
+
+func main() {
+	eth := ethernet(clientMAC, routerMAC, layers.EthernetTypeIPv4)
+	ethReply := ethernet(routerMAC, clientMAC, layers.EthernetTypeIPv4)
+	frames := []frame{
+		{0, arp()},
+		{10 * time.Millisecond, dns(eth, 53000, false)},
+		{30 * time.Millisecond, dns(ethReply, 53000, true)},
+		{100 * time.Millisecond, tcp(false, "S", "")},
+		{120 * time.Millisecond, tcp(true, "SA", "")},
+		{130 * time.Millisecond, tcp(false, "A", "")},
+		{140 * time.Millisecond, tcp(false, "PA", "GET /index.html HTTP/1.1\r\nHost: example.com\r\nUser-Agent: curl/8.4.0\r\n\r\n")},
+		{200 * time.Millisecond, tcp(true, "FA", "")},
+		{210 * time.Millisecond, tcp(false, "FA", "")},
+		{300 * time.Millisecond, broken()},
+		// The same DNS addresses and ports two minutes on are a new flow
+		{2 * time.Minute, dns(eth, 53000, false)},
+		{2*time.Minute + 20*time.Millisecond, dns(ethReply, 53000, true)},
+	}
+
+	var pcap bytes.Buffer
+	w := pcapgo.NewWriter(&pcap)
+	if err := w.WriteFileHeader(65535, layers.LinkTypeEthernet); err != nil {
+		log.Fatal(err)
+	}
+	for _, f := range frames {
+		ci := gopacket.CaptureInfo{Timestamp: base.Add(f.at), CaptureLength: len(f.data), Length: len(f.data)}
+		if err := w.WritePacket(ci, f.data); err != nil {
+			log.Fatal(err)
+		}
+	}
+	write("capture.pcap", pcap.Bytes())
+
+	// A pcapng with an Ethernet interface and a raw IP one, as a capture on
+	// a LAN port and a VPN tunnel would have
+	var ng bytes.Buffer
+	nw, err := pcapgo.NewNgWriterInterface(&ng, pcapgo.NgInterface{Name: "eth0", LinkType: layers.LinkTypeEthernet, SnapLength: 65535}, pcapgo.DefaultNgWriterOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tun, err := nw.AddInterface(pcapgo.NgInterface{Name: "tun0", LinkType: layers.LinkTypeRaw, SnapLength: 65535})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for i, p := range []struct {
+		iface int
+		data  []byte
+	}{
+		{0, dns(eth, 53000, false)},
+		{0, dns(ethReply, 53000, true)},
+		{tun, dns(nil, 53001, false)},
+		{tun, dns(nil, 53001, true)},
+	} {
+		ci := gopacket.CaptureInfo{Timestamp: base.Add(time.Duration(i) * time.Second), CaptureLength: len(p.data), Length: len(p.data), InterfaceIndex: p.iface}
+		if err := nw.WritePacket(ci, p.data); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := nw.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	write("mixed.pcapng", ng.Bytes())
+}
+
+func write(name string, data []byte) {
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
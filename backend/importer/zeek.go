@@ -0,0 +1,216 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register("zeek", ParseZeek)
+}
+
+// ParseZeek reads a Zeek log in either the default TSV format or JSON lines.
+// Field names are kept as Zeek writes them (id.orig_h and so on) and each
+// event's log_type is zeek.<path>, e.g. zeek.conn, so it can be routed.
+func ParseZeek(file File) ([]map[string]interface{}, int, error) {
+	reader := bufio.NewReaderSize(file.Reader, 64*1024)
+	first, err := reader.Peek(1)
+	if err == io.EOF {
+		return []map[string]interface{}{}, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read file: %v", err)
+	}
+
+	if first[0] == '{' {
+		events := []map[string]interface{}{}
+		skipped, err := readJSONLines(reader, func(record map[string]interface{}) {
+			logPath, _ := record["_path"].(string)
+			if logPath == "" {
+				logPath = guessZeekPath(record, file.Name)
+			}
+			record["log_type"] = "zeek." + logPath
+			eventTime(record, record["ts"])
+			events = append(events, record)
+		})
+		return events, skipped, err
+	}
+	return parseZeekTSV(reader, file.Name)
+}
+
+// zeekHeader is what a TSV log's # lines say about its records
+type zeekHeader struct {
+	separator    string
+	setSeparator string
+	emptyField   string
+	unsetField   string
+	path         string
+	fields       []string
+	types        []string
+}
+
+// parseZeekTSV reads a TSV log, converting each value by its declared type
+func parseZeekTSV(r io.Reader, name string) ([]map[string]interface{}, int, error) {
+	header := zeekHeader{separator: "\t", setSeparator: ",", emptyField: "(empty)", unsetField: "-"}
+	events := []map[string]interface{}{}
+	skipped := 0
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			header.read(line)
+			continue
+		}
+		if len(header.fields) == 0 {
+			return nil, 0, fmt.Errorf("not a Zeek log: data before the #fields header")
+		}
+
+		values := strings.Split(line, header.separator)
+		if len(values) != len(header.fields) {
+			skipped++
+			continue
+		}
+		event := map[string]interface{}{}
+		for i, field := range header.fields {
+			if value, ok := header.convert(values[i], header.types[i]); ok {
+				event[field] = value
+			}
+		}
+		if header.path == "" {
+			header.path = guessZeekPath(event, name)
+		}
+		event["log_type"] = "zeek." + header.path
+		eventTime(event, event["ts"])
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read file: %v", err)
+	}
+	return events, skipped, nil
+}
+
+// read takes in one # header line
+func (h *zeekHeader) read(line string) {
+	if strings.HasPrefix(line, "#separator ") {
+		h.separator = unescapeZeek(strings.TrimPrefix(line, "#separator "))
+		return
+	}
+	parts := strings.Split(line, h.separator)
+	switch parts[0] {
+	case "#set_separator":
+		if len(parts) > 1 {
+			h.setSeparator = unescapeZeek(parts[1])
+		}
+	case "#empty_field":
+		if len(parts) > 1 {
+			h.emptyField = unescapeZeek(parts[1])
+		}
+	case "#unset_field":
+		if len(parts) > 1 {
+			h.unsetField = unescapeZeek(parts[1])
+		}
+	case "#path":
+		if len(parts) > 1 {
+			h.path = parts[1]
+		}
+	case "#fields":
+		h.fields = parts[1:]
+		if len(h.types) != len(h.fields) {
+			h.types = make([]string, len(h.fields))
+		}
+	case "#types":
+		h.types = parts[1:]
+		for len(h.types) < len(h.fields) {
+			h.types = append(h.types, "string")
+		}
+	}
+}
+
+// convert turns a TSV value into the JSON value Zeek's JSON writer would
+// produce. ok is false for unset fields, which are left out.
+func (h *zeekHeader) convert(value, typ string) (interface{}, bool) {
+	if value == h.unsetField {
+		return nil, false
+	}
+	if strings.HasPrefix(typ, "set[") || strings.HasPrefix(typ, "vector[") {
+		items := []interface{}{}
+		if value == h.emptyField {
+			return items, true
+		}
+		inner := typ[strings.Index(typ, "[")+1 : len(typ)-1]
+		for _, item := range strings.Split(value, h.setSeparator) {
+			if converted, ok := h.convert(item, inner); ok {
+				items = append(items, converted)
+			}
+		}
+		return items, true
+	}
+
+	switch typ {
+	case "time", "interval", "double":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f, true
+		}
+	case "count", "int", "port":
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n, true
+		}
+	case "bool":
+		return value == "T", true
+	}
+	if value == h.emptyField {
+		return "", true
+	}
+	return unescapeZeek(value), true
+}
+
+// unescapeZeek decodes the \xHH escapes Zeek writes for separators and
+// non-printable bytes
+func unescapeZeek(value string) string {
+	if !strings.Contains(value, `\x`) {
+		return value
+	}
+	var out bytes.Buffer
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+3 < len(value) && value[i+1] == 'x' {
+			if b, err := strconv.ParseUint(value[i+2:i+4], 16, 8); err == nil {
+				out.WriteByte(byte(b))
+				i += 3
+				continue
+			}
+		}
+		out.WriteByte(value[i])
+	}
+	return out.String()
+}
+
+// guessZeekPath works out which log a record came from when the log doesn't
+// say: the common logs by their fields, others by a file name such as
+// files.log or notice.00:00:00-01:00:00.log.gz
+func guessZeekPath(record map[string]interface{}, name string) string {
+	has := func(field string) bool { _, ok := record[field]; return ok }
+	switch {
+	case has("conn_state"):
+		return "conn"
+	case has("qtype_name") || has("query") && has("rcode"):
+		return "dns"
+	case has("method") && has("uri"):
+		return "http"
+	case has("server_name") || has("cipher"):
+		return "ssl"
+	}
+	if path, _, ok := strings.Cut(filepath.Base(name), "."); ok && path != "" {
+		return path
+	}
+	return "unknown"
+}
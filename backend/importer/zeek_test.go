@@ -0,0 +1,112 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseString runs a parser over an in-memory file
+func parseString(t *testing.T, parser Parser, name, data string) ([]map[string]interface{}, int) {
+	t.Helper()
+	events, skipped, err := parser(File{Name: name, Reader: strings.NewReader(data)})
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return events, skipped
+}
+
+const zeekConnTSV = `#separator \x09
+#set_separator	,
+#empty_field	(empty)
+#unset_field	-
+#path	conn
+#fields	ts	uid	id.orig_h	id.orig_p	id.resp_h	id.resp_p	proto	duration	local_orig	conn_state	tunnel_parents
+#types	time	string	addr	port	addr	port	enum	interval	bool	string	set[string]
+1709294400.123456	CAbc1	10.0.0.5	52100	93.184.216.34	443	tcp	1.5	T	SF	(empty)
+1709294401.000000	CAbc2	10.0.0.6	53000	8.8.8.8	53	udp	-	F	S0	Cx1,Cx2
+this line has the wrong number of fields
+`
+
+func TestParseZeekTSV(t *testing.T) {
+	events, skipped := parseString(t, ParseZeek, "conn.log", zeekConnTSV)
+	if len(events) != 2 || skipped != 1 {
+		t.Fatalf("got %d events and %d skipped, want 2 and 1", len(events), skipped)
+	}
+	want := map[string]interface{}{
+		"log_type":       "zeek.conn",
+		"@timestamp":     float64(1709294400123),
+		"ts":             1709294400.123456,
+		"uid":            "CAbc1",
+		"id.orig_h":      "10.0.0.5",
+		"id.orig_p":      int64(52100),
+		"id.resp_h":      "93.184.216.34",
+		"id.resp_p":      int64(443),
+		"proto":          "tcp",
+		"duration":       1.5,
+		"local_orig":     true,
+		"conn_state":     "SF",
+		"tunnel_parents": []interface{}{},
+	}
+	if !reflect.DeepEqual(events[0], want) {
+		t.Errorf("event = %v, want %v", events[0], want)
+	}
+	if _, ok := events[1]["duration"]; ok {
+		t.Error("unset field was kept")
+	}
+	if got := events[1]["tunnel_parents"]; !reflect.DeepEqual(got, []interface{}{"Cx1", "Cx2"}) {
+		t.Errorf("set = %v", got)
+	}
+}
+
+func TestParseZeekJSON(t *testing.T) {
+	data := strings.Join([]string{
+		`{"_path":"dns","ts":1709294400.5,"query":"example.com","rcode":0}`,
+		`{"ts":"2024-03-01T12:00:01Z","method":"GET","uri":"/","host":"example.com"}`,
+		`{"ts":1709294402,"fuid":"F1","mime_type":"text/plain"}`,
+		`not json`,
+	}, "\n")
+	events, skipped := parseString(t, ParseZeek, "files.00:00:00-01:00:00.log", data)
+	if skipped != 1 {
+		t.Errorf("skipped = %d, want 1", skipped)
+	}
+	var logTypes []interface{}
+	var times []interface{}
+	for _, event := range events {
+		logTypes = append(logTypes, event["log_type"])
+		times = append(times, event["@timestamp"])
+	}
+	if want := []interface{}{"zeek.dns", "zeek.http", "zeek.files"}; !reflect.DeepEqual(logTypes, want) {
+		t.Errorf("log types = %v, want %v", logTypes, want)
+	}
+	if want := []interface{}{float64(1709294400500), float64(1709294401000), float64(1709294402000)}; !reflect.DeepEqual(times, want) {
+		t.Errorf("times = %v, want %v", times, want)
+	}
+}
+
+func TestParseZeekErrors(t *testing.T) {
+	if _, _, err := ParseZeek(File{Name: "x.log", Reader: strings.NewReader("1\t2\t3\n")}); err == nil {
+		t.Error("TSV without a #fields header accepted")
+	}
+	events, skipped := parseString(t, ParseZeek, "empty.log", "")
+	if len(events) != 0 || skipped != 0 {
+		t.Errorf("empty file gave %d events and %d skipped", len(events), skipped)
+	}
+}
+
+func TestUnescapeZeek(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`plain`, "plain"},
+		{`\x09`, "\t"},
+		{`a\x2cb`, "a,b"},
+		{`bad\xZZ`, `bad\xZZ`},
+		{`cut\x4`, `cut\x4`},
+	}
+	for _, tt := range tests {
+		if got := unescapeZeek(tt.in); got != tt.want {
+			t.Errorf("unescapeZeek(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
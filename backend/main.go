@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"backend/config"
 	"backend/handlers" // This should be "backend/handlers"
@@ -18,14 +21,55 @@ func main() {
 	fmt.Println("🚀 Initializing Firebase...")
 	config.InitFirebase()
 
+	// Replays that were running when the server last stopped can be resumed
+	interrupted, err := handlers.MarkInterruptedReplays()
+	if err != nil {
+		log.Printf("⚠️ Could not check for interrupted replays: %v", err)
+	}
+	for _, cp := range interrupted {
+		fmt.Printf("⏸️ Interrupted replay %s (%s): %d/%d records sent, resume via POST /api/replay/resume\n", cp.SessionID, cp.ScenarioName, cp.Acked, cp.Total)
+	}
+
+	handlers.StartScheduler()
+
 	router := mux.NewRouter()
 
 	// Register API routes
 	router.HandleFunc("/api/replay", handlers.ReplayHandler).Methods("POST")           // Changed for convenience, should likely match the data
 	router.HandleFunc("/api/replay/progress", handlers.ProgressHandler).Methods("GET") // Changed for convenience, should likely match the data
+	router.HandleFunc("/api/replay/preview", handlers.PreviewHandler).Methods("POST")
+	router.HandleFunc("/api/replay/ws", handlers.ReplaySocketHandler).Methods("GET")
+	router.HandleFunc("/api/replay/interrupted", handlers.InterruptedReplaysHandler).Methods("GET")
+	router.HandleFunc("/api/replay/resume", handlers.ResumeReplayHandler).Methods("POST")
+	router.HandleFunc("/api/replay/runs", handlers.ListRunsHandler).Methods("GET")
+	router.HandleFunc("/api/replay/runs/{id}/report", handlers.RunReportHandler).Methods("GET")
+	router.HandleFunc("/api/replay/schedules", handlers.ListSchedulesHandler).Methods("GET")
+	router.HandleFunc("/api/replay/schedules", handlers.CreateScheduleHandler).Methods("POST")
+	router.HandleFunc("/api/replay/schedules/{id}", handlers.GetScheduleHandler).Methods("GET")
+	router.HandleFunc("/api/replay/schedules/{id}", handlers.UpdateScheduleHandler).Methods("PUT")
+	router.HandleFunc("/api/replay/schedules/{id}", handlers.DeleteScheduleHandler).Methods("DELETE")
 
 	// NEW endpoint
 	router.HandleFunc("/api/get-data", handlers.GetDataHandler).Methods("POST") // Changed for convenience, should likely match the data
+	router.HandleFunc("/api/capture/sources", handlers.CaptureSourcesHandler).Methods("GET")
+	router.HandleFunc("/api/capture/jobs", handlers.StartCaptureJobHandler).Methods("POST")
+	router.HandleFunc("/api/capture/jobs", handlers.ListCaptureJobsHandler).Methods("GET")
+	router.HandleFunc("/api/capture/jobs/{id}", handlers.GetCaptureJobHandler).Methods("GET")
+	router.HandleFunc("/api/capture/jobs/{id}", handlers.CancelCaptureJobHandler).Methods("DELETE")
+	router.HandleFunc("/api/capture/jobs/{id}/result", handlers.CaptureJobResultHandler).Methods("GET")
+	router.HandleFunc("/api/import/formats", handlers.ImportFormatsHandler).Methods("GET")
+	router.HandleFunc("/api/import/{format}", handlers.ImportScenarioHandler).Methods("POST")
+	router.HandleFunc("/api/recorder", handlers.StartRecorderHandler).Methods("POST")
+	router.HandleFunc("/api/recorder", handlers.ListRecordersHandler).Methods("GET")
+	router.HandleFunc("/api/recorder/{id}/stop", handlers.StopRecorderHandler).Methods("POST")
+	router.HandleFunc("/api/sanitize/preview", handlers.SanitizePreviewHandler).Methods("POST")
+	router.HandleFunc("/api/scenarios/keys/rotate", handlers.RotateScenarioKeyHandler).Methods("POST")
+	router.HandleFunc("/api/sanitize/scan", handlers.ScanHandler).Methods("POST")
+	router.HandleFunc("/api/sanitize/profiles", handlers.ListProfilesHandler).Methods("GET")
+	router.HandleFunc("/api/sanitize/profiles", handlers.CreateProfileHandler).Methods("POST")
+	router.HandleFunc("/api/sanitize/profiles/{id}", handlers.GetProfileHandler).Methods("GET")
+	router.HandleFunc("/api/sanitize/profiles/{id}", handlers.UpdateProfileHandler).Methods("PUT")
+	router.HandleFunc("/api/sanitize/profiles/{id}/versions", handlers.ListProfileVersionsHandler).Methods("GET")
 	router.HandleFunc("/api/upload-scenario", handlers.UploadScenarioHandler).Methods("POST")
 
 	// CORS Middleware
@@ -35,6 +79,16 @@ func main() {
 		ghandlers.AllowedHeaders([]string{"Content-Type", "Authorization"}),
 	)
 
+	// Write the latest position of running replays before going away
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+		fmt.Println("🛑 Shutting down, checkpointing running replays...")
+		handlers.FlushCheckpoints()
+		os.Exit(0)
+	}()
+
 	port := ":8080"
 	fmt.Println("🚀 Server running on http://localhost" + port)
 	log.Fatal(http.ListenAndServe(port, corsHandler(router)))
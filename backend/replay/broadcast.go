@@ -0,0 +1,140 @@
+package replay
+
+import (
+	"sync"
+)
+
+// DefaultHistorySize is how many progress events a Broadcaster keeps for
+// subscribers that reconnect with a Last-Event-ID
+const DefaultHistorySize = 2048
+
+// subscriberBuffer is how far a subscriber may fall behind before it is dropped.
+// Dropped subscribers reconnect and catch up from the history.
+const subscriberBuffer = 64
+
+// ProgressEvent is a progress update numbered for SSE event IDs
+type ProgressEvent struct {
+	ID       int64
+	Progress ReplayProgress
+}
+
+// Broadcaster fans the progress of one replay out to any number of subscribers
+type Broadcaster struct {
+	mu          sync.Mutex
+	history     []ProgressEvent
+	historySize int
+	nextID      int64
+	subscribers map[chan ProgressEvent]struct{}
+	closed      bool
+}
+
+// NewBroadcaster creates a Broadcaster remembering up to historySize events
+func NewBroadcaster(historySize int) *Broadcaster {
+	if historySize < 1 {
+		historySize = DefaultHistorySize
+	}
+	return &Broadcaster{
+		historySize: historySize,
+		nextID:      1,
+		subscribers: make(map[chan ProgressEvent]struct{}),
+	}
+}
+
+// Run publishes everything received on progressChan and closes the
+// Broadcaster once progressChan is closed
+func (b *Broadcaster) Run(progressChan <-chan ReplayProgress) {
+	for progress := range progressChan {
+		b.Publish(progress)
+	}
+	b.Close()
+}
+
+// Publish numbers an event, stores it and hands it to every subscriber
+func (b *Broadcaster) Publish(progress ReplayProgress) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+
+	event := ProgressEvent{ID: b.nextID, Progress: progress}
+	b.nextID++
+
+	// Oldest events go first, so late subscribers always see how the replay ended
+	if len(b.history) >= b.historySize {
+		b.history = append(b.history[:0], b.history[len(b.history)-b.historySize+1:]...)
+	}
+	b.history = append(b.history, event)
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns the stored events after lastID and a channel for new ones.
+// The channel is closed when the replay ends or the subscriber falls behind;
+// cancel must be called once the subscriber goes away.
+func (b *Broadcaster) Subscribe(lastID int64) ([]ProgressEvent, <-chan ProgressEvent, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var backlog []ProgressEvent
+	for _, event := range b.history {
+		if event.ID > lastID {
+			backlog = append(backlog, event)
+		}
+	}
+
+	ch := make(chan ProgressEvent, subscriberBuffer)
+	if b.closed {
+		close(ch)
+		return backlog, ch, func() {}
+	}
+	b.subscribers[ch] = struct{}{}
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return backlog, ch, cancel
+}
+
+// Latest returns the most recent event, if any
+func (b *Broadcaster) Latest() (ProgressEvent, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.history) == 0 {
+		return ProgressEvent{}, false
+	}
+	return b.history[len(b.history)-1], true
+}
+
+// Done reports whether the replay has finished publishing
+func (b *Broadcaster) Done() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+// Close ends every subscription. Later Publish calls are ignored.
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
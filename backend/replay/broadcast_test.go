@@ -0,0 +1,115 @@
+package replay
+
+import (
+	"reflect"
+	"testing"
+)
+
+func eventIDs(events []ProgressEvent) []int64 {
+	ids := []int64{}
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	return ids
+}
+
+func TestBroadcasterHistory(t *testing.T) {
+	b := NewBroadcaster(3)
+	for i := 1; i <= 5; i++ {
+		b.Publish(ReplayProgress{Rec: i})
+	}
+	tests := []struct {
+		lastID int64
+		want   []int64
+	}{
+		{0, []int64{3, 4, 5}}, // older events fell out of the history
+		{3, []int64{4, 5}},
+		{5, []int64{}},
+		{9, []int64{}},
+	}
+	for _, tt := range tests {
+		backlog, _, cancel := b.Subscribe(tt.lastID)
+		cancel()
+		if got := eventIDs(backlog); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Subscribe(%d) backlog = %v, want %v", tt.lastID, got, tt.want)
+		}
+	}
+	if latest, ok := b.Latest(); !ok || latest.ID != 5 || latest.Progress.Rec != 5 {
+		t.Errorf("Latest() = %+v, %v; want event 5", latest, ok)
+	}
+}
+
+func TestBroadcasterFansOut(t *testing.T) {
+	b := NewBroadcaster(0)
+	_, first, cancelFirst := b.Subscribe(0)
+	_, second, cancelSecond := b.Subscribe(0)
+	defer cancelSecond()
+
+	b.Publish(ReplayProgress{Rec: 1})
+	if event := <-first; event.ID != 1 {
+		t.Errorf("first subscriber got event %d, want 1", event.ID)
+	}
+	if event := <-second; event.ID != 1 {
+		t.Errorf("second subscriber got event %d, want 1", event.ID)
+	}
+
+	cancelFirst()
+	cancelFirst() // cancelling twice is harmless
+	if _, ok := <-first; ok {
+		t.Error("cancelled subscription still open")
+	}
+	b.Publish(ReplayProgress{Rec: 2})
+	if event := <-second; event.ID != 2 {
+		t.Errorf("second subscriber got event %d after the first left, want 2", event.ID)
+	}
+}
+
+// A subscriber that stops reading is dropped rather than blocking the replay,
+// and can pick up where it was from the history
+func TestBroadcasterEvictsSlowSubscriber(t *testing.T) {
+	b := NewBroadcaster(0)
+	_, slow, cancel := b.Subscribe(0)
+	defer cancel()
+	for i := 0; i < subscriberBuffer+10; i++ {
+		b.Publish(ReplayProgress{Rec: i})
+	}
+
+	var last int64
+	for event := range slow {
+		last = event.ID
+	}
+	if last != subscriberBuffer {
+		t.Errorf("slow subscriber got events up to %d before being dropped, want %d", last, subscriberBuffer)
+	}
+	backlog, _, cancelAgain := b.Subscribe(last)
+	cancelAgain()
+	if len(backlog) != 10 || backlog[0].ID != last+1 {
+		t.Errorf("reconnect backlog = %v, want the 10 events after %d", eventIDs(backlog), last)
+	}
+}
+
+func TestBroadcasterRunAndClose(t *testing.T) {
+	b := NewBroadcaster(0)
+	_, events, cancel := b.Subscribe(0)
+	defer cancel()
+
+	progress := make(chan ReplayProgress, 2)
+	progress <- ReplayProgress{Rec: 1}
+	progress <- ReplayProgress{Rec: 2, Final: true}
+	close(progress)
+	b.Run(progress)
+
+	if got := []ProgressEvent{<-events, <-events}; got[1].ID != 2 || !got[1].Progress.Final {
+		t.Errorf("events = %+v, want the final event last", got)
+	}
+	if _, ok := <-events; ok || !b.Done() {
+		t.Error("subscription still open after the replay ended")
+	}
+
+	// Late subscribers still see how the replay ended
+	b.Publish(ReplayProgress{Rec: 3})
+	backlog, late, _ := b.Subscribe(0)
+	if _, ok := <-late; ok || !reflect.DeepEqual(eventIDs(backlog), []int64{1, 2}) {
+		t.Errorf("late subscriber backlog = %v, want [1 2] and a closed channel", eventIDs(backlog))
+	}
+}
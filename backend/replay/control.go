@@ -0,0 +1,254 @@
+package replay
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ControlState is a snapshot of the live controls of a replay
+type ControlState struct {
+	Paused bool    `json:"paused"`
+	Speed  float64 `json:"speed"`
+	// Position is the index of the next record to be sent
+	Position int `json:"position"`
+}
+
+// Controller lets a running replay be paused, resumed, sped up or moved to
+// another record. It is safe for concurrent use.
+type Controller struct {
+	mu       sync.Mutex
+	paused   bool
+	speed    float64
+	seek     int
+	position int
+	total    int
+	changed  chan struct{}
+}
+
+// NewController creates a Controller starting at the given speed
+func NewController(speed float64) *Controller {
+	if speed < 0 {
+		speed = 0
+	}
+	return &Controller{speed: speed, seek: -1, total: -1, changed: make(chan struct{})}
+}
+
+// Changed returns a channel that is closed the next time a control changes
+func (c *Controller) Changed() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.changed
+}
+
+// notify wakes everyone waiting on Changed. Callers hold c.mu.
+func (c *Controller) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// State returns the current controls
+func (c *Controller) State() ControlState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ControlState{Paused: c.paused, Speed: c.speed, Position: c.position}
+}
+
+// Pause holds back records that have not been sent yet
+func (c *Controller) Pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.paused {
+		c.paused = true
+		c.notify()
+	}
+}
+
+// Resume continues a paused replay from where it stopped
+func (c *Controller) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		c.paused = false
+		c.notify()
+	}
+}
+
+// SetSpeed changes the playback multiplier. Zero sends as fast as possible.
+func (c *Controller) SetSpeed(speed float64) error {
+	if speed < 0 {
+		return fmt.Errorf("speed must not be negative, got %v", speed)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.speed = speed
+	c.notify()
+	return nil
+}
+
+// Seek moves the replay so index is the next record sent. Seeking backwards
+// sends the records in between again.
+func (c *Controller) Seek(index int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if index < 0 || (c.total >= 0 && index >= c.total) {
+		return fmt.Errorf("seek index %d out of range", index)
+	}
+	c.seek = index
+	c.notify()
+	return nil
+}
+
+// start tells the Controller how many records the replay has
+func (c *Controller) start(total, position int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.total = total
+	c.position = position
+}
+
+// takeSeek returns and clears a pending seek
+func (c *Controller) takeSeek() (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seek < 0 {
+		return 0, false
+	}
+	index := c.seek
+	c.seek = -1
+	return index, true
+}
+
+// advance records the index of the next record to be sent
+func (c *Controller) advance(position int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.position = position
+}
+
+// pacer decides when each record is due. It keeps a base point mapping wall
+// clock to scenario time and moves it whenever a control changes, so pausing
+// or changing speed never makes the replay jump.
+type pacer struct {
+	schedule  Schedule
+	control   *Controller
+	baseWall  time.Time
+	baseEvent int64
+	speed     float64
+	paused    bool
+	changed   <-chan struct{}
+
+	mu          sync.Mutex
+	expectedEnd int64
+}
+
+func newPacer(schedule Schedule, control *Controller, position int) *pacer {
+	p := &pacer{
+		schedule: schedule,
+		control:  control,
+		baseWall: time.UnixMilli(schedule.Start),
+	}
+	if position < len(schedule.Records) {
+		p.baseEvent = schedule.Records[position].EventTime
+	}
+	p.refresh()
+	return p
+}
+
+// refresh picks up the latest controls. The change channel is taken before
+// the state is read so a change in between is never missed.
+func (p *pacer) refresh() {
+	p.changed = p.control.Changed()
+	state := p.control.State()
+	p.speed = state.Speed
+	p.paused = state.Paused
+	p.updateExpectedEnd()
+}
+
+// virtualNow is the scenario time that corresponds to the wall clock time now
+func (p *pacer) virtualNow(now time.Time) int64 {
+	if p.paused || p.speed <= 0 {
+		return p.baseEvent
+	}
+	return p.baseEvent + int64(float64(now.Sub(p.baseWall).Milliseconds())*p.speed)
+}
+
+// rebase moves the base point to now under the latest controls
+func (p *pacer) rebase(now time.Time) {
+	p.baseEvent = p.virtualNow(now)
+	p.baseWall = now
+	p.refresh()
+}
+
+// seekTo restarts pacing at the record at index
+func (p *pacer) seekTo(index int, now time.Time) {
+	p.baseEvent = p.schedule.Records[index].EventTime
+	p.baseWall = now
+	p.refresh()
+}
+
+// sent moves an unpaced replay's scenario clock along with what was sent,
+// so switching to a paced speed continues from there instead of the start
+func (p *pacer) sent(index int, now time.Time) {
+	if p.speed <= 0 {
+		p.baseEvent = p.schedule.Records[index].EventTime
+		p.baseWall = now
+	}
+}
+
+// due returns when the record at index should be sent
+func (p *pacer) due(index int) time.Time {
+	if p.speed <= 0 {
+		return p.baseWall
+	}
+	gap := p.schedule.Records[index].EventTime - p.baseEvent
+	if gap <= 0 {
+		return p.baseWall
+	}
+	return p.baseWall.Add(time.Duration(float64(gap)/p.speed) * time.Millisecond)
+}
+
+func (p *pacer) updateExpectedEnd() {
+	end := p.baseWall.UnixMilli()
+	if n := len(p.schedule.Records); n > 0 && p.speed > 0 {
+		if gap := p.schedule.Records[n-1].EventTime - p.baseEvent; gap > 0 {
+			end += int64(float64(gap) / p.speed)
+		}
+	}
+	p.mu.Lock()
+	p.expectedEnd = end
+	p.mu.Unlock()
+}
+
+// ExpectedEnd is the wall clock millisecond the last record is due at
+func (p *pacer) ExpectedEnd() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.expectedEnd
+}
+
+// wait blocks until the record at index is due. It returns false if a
+// control changed first, in which case the caller should re-check the controls.
+func (p *pacer) wait(index int) bool {
+	select {
+	case <-p.changed:
+		return false
+	default:
+	}
+	if p.paused {
+		<-p.changed
+		return false
+	}
+	delay := time.Until(p.due(index))
+	if delay <= 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-p.changed:
+		return false
+	}
+}
@@ -0,0 +1,201 @@
+package replay
+
+import (
+	"testing"
+	"time"
+)
+
+// changedSince reports whether a Changed channel has been closed
+func changedSince(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestControllerControls(t *testing.T) {
+	c := NewController(-2)
+	if state := c.State(); state.Speed != 0 || state.Paused {
+		t.Errorf("NewController(-2) state = %+v, want unpaced and running", state)
+	}
+
+	changed := c.Changed()
+	c.Resume() // not paused, so nothing changes
+	if changedSince(changed) {
+		t.Error("Resume() of a running replay signalled a change")
+	}
+	c.Pause()
+	if !changedSince(changed) || !c.State().Paused {
+		t.Error("Pause() didn't pause and signal")
+	}
+	changed = c.Changed()
+	c.Pause()
+	if changedSince(changed) {
+		t.Error("Pause() of a paused replay signalled a change")
+	}
+	c.Resume()
+	if !changedSince(changed) || c.State().Paused {
+		t.Error("Resume() didn't resume and signal")
+	}
+
+	if err := c.SetSpeed(-1); err == nil {
+		t.Error("SetSpeed(-1) accepted a negative speed")
+	}
+	if err := c.SetSpeed(4); err != nil || c.State().Speed != 4 {
+		t.Errorf("SetSpeed(4) = %v, speed %v", err, c.State().Speed)
+	}
+}
+
+func TestControllerSeek(t *testing.T) {
+	c := NewController(1)
+	// Before the replay knows its length any non-negative index is taken
+	if err := c.Seek(50); err != nil {
+		t.Errorf("Seek(50) before start: %v", err)
+	}
+	c.start(10, 3)
+	if state := c.State(); state.Position != 3 {
+		t.Errorf("position after start = %d, want 3", state.Position)
+	}
+
+	tests := []struct {
+		index int
+		ok    bool
+	}{
+		{-1, false},
+		{10, false},
+		{0, true},
+		{9, true},
+	}
+	for _, tt := range tests {
+		if err := c.Seek(tt.index); (err == nil) != tt.ok {
+			t.Errorf("Seek(%d) = %v, want ok %v", tt.index, err, tt.ok)
+		}
+	}
+
+	// Only the last seek is kept, and taking it clears it
+	if index, ok := c.takeSeek(); !ok || index != 9 {
+		t.Errorf("takeSeek() = %d, %v; want 9", index, ok)
+	}
+	if _, ok := c.takeSeek(); ok {
+		t.Error("takeSeek() returned the same seek twice")
+	}
+	c.advance(7)
+	if state := c.State(); state.Position != 7 {
+		t.Errorf("position after advance = %d, want 7", state.Position)
+	}
+}
+
+// pacerSchedule has records one second apart in scenario time
+func pacerSchedule(start time.Time, n int) Schedule {
+	schedule := Schedule{Start: start.UnixMilli(), Records: make([]ScheduledRecord, n)}
+	for i := range schedule.Records {
+		schedule.Records[i] = ScheduledRecord{Index: i, EventTime: 100000 + int64(i)*1000}
+	}
+	return schedule
+}
+
+func TestPacerDue(t *testing.T) {
+	start := time.UnixMilli(1_000_000)
+	tests := []struct {
+		name     string
+		speed    float64
+		position int
+		index    int
+		want     time.Duration
+		end      time.Duration
+	}{
+		{"real time", 1, 0, 3, 3 * time.Second, 9 * time.Second},
+		{"double speed", 2, 0, 3, 1500 * time.Millisecond, 4500 * time.Millisecond},
+		{"resumed", 1, 4, 6, 2 * time.Second, 5 * time.Second},
+		{"already due", 1, 4, 2, 0, 5 * time.Second},
+		{"unpaced", 0, 0, 9, 0, 0},
+	}
+	for _, tt := range tests {
+		p := newPacer(pacerSchedule(start, 10), NewController(tt.speed), tt.position)
+		if got := p.due(tt.index).Sub(start); got != tt.want {
+			t.Errorf("%s: record %d due at +%v, want +%v", tt.name, tt.index, got, tt.want)
+		}
+		if got := time.Duration(p.ExpectedEnd()-start.UnixMilli()) * time.Millisecond; got != tt.end {
+			t.Errorf("%s: expected end +%v, want +%v", tt.name, got, tt.end)
+		}
+	}
+}
+
+// Changing speed or pausing moves the base point, so records already due
+// stay due and the rest shift without a jump
+func TestPacerRebase(t *testing.T) {
+	start := time.UnixMilli(1_000_000)
+	control := NewController(1)
+	p := newPacer(pacerSchedule(start, 10), control, 0)
+
+	control.SetSpeed(2)
+	p.rebase(start.Add(2 * time.Second)) // two scenario seconds played at 1x
+	if got := p.due(4).Sub(start); got != 3*time.Second {
+		t.Errorf("after 2s at 1x then 2x, record 4 due at +%v, want +3s", got)
+	}
+
+	control.Pause()
+	p.rebase(start.Add(3 * time.Second)) // two more scenario seconds at 2x
+	if got := p.virtualNow(start.Add(time.Hour)); got != 104000 {
+		t.Errorf("paused scenario clock = %d, want it held at 104000", got)
+	}
+	control.Resume()
+	p.rebase(start.Add(time.Hour))
+	if got := p.due(5).Sub(start.Add(time.Hour)); got != 500*time.Millisecond {
+		t.Errorf("after resuming, record 5 due in %v, want 500ms", got)
+	}
+
+	p.seekTo(1, start.Add(2*time.Hour))
+	if got := p.due(3).Sub(start.Add(2 * time.Hour)); got != time.Second {
+		t.Errorf("after seeking to 1, record 3 due in %v, want 1s", got)
+	}
+}
+
+// An unpaced replay's scenario clock follows what was sent, so switching to
+// a paced speed carries on from there
+func TestPacerSentWhileUnpaced(t *testing.T) {
+	start := time.UnixMilli(1_000_000)
+	control := NewController(0)
+	p := newPacer(pacerSchedule(start, 10), control, 0)
+	p.sent(6, start.Add(time.Second))
+
+	control.SetSpeed(1)
+	p.rebase(start.Add(time.Second))
+	if got := p.due(8).Sub(start.Add(time.Second)); got != 2*time.Second {
+		t.Errorf("record 8 due in %v after switching to 1x at record 6, want 2s", got)
+	}
+}
+
+func TestPacerWait(t *testing.T) {
+	schedule := pacerSchedule(time.Now(), 10)
+	control := NewController(1)
+	p := newPacer(schedule, control, 0)
+	if !p.wait(0) {
+		t.Error("wait() for a due record didn't return true")
+	}
+
+	// A control change interrupts a wait for a record that isn't due yet
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		control.Pause()
+	}()
+	begin := time.Now()
+	if p.wait(9) {
+		t.Error("wait() returned true although the replay was paused")
+	}
+	if time.Since(begin) > 5*time.Second {
+		t.Error("wait() didn't wake on the pause")
+	}
+
+	// Paused, a wait blocks until the next change
+	p.refresh()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		control.Resume()
+	}()
+	if p.wait(0) {
+		t.Error("wait() while paused returned true")
+	}
+}
@@ -0,0 +1,147 @@
+package replay
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// DeliveryOptions controls how many records are sent to the HEC at once
+type DeliveryOptions struct {
+	// Workers is the number of concurrent senders. Values below 1 mean serial delivery.
+	Workers int `json:"workers"`
+	// PartitionKey names the record field whose value keeps events in order,
+	// e.g. "host". Records sharing a value are always sent by the same worker.
+	PartitionKey string `json:"partition_key"`
+}
+
+// MaxWorkers caps the sender pool so one replay cannot exhaust connections
+const MaxWorkers = 64
+
+// DefaultDeliveryOptions matches the original one-at-a-time behaviour
+var DefaultDeliveryOptions = DeliveryOptions{Workers: 1}
+
+// delivery is a single record queued for a worker
+type delivery struct {
+	index     int
+	timestamp int64
+	record    map[string]interface{}
+}
+
+// deliveryResult is reported back once a worker has finished with a record
+type deliveryResult struct {
+	index     int
+	timestamp int64
+	bytes     int
+	retries   int
+	err       error
+	// skipped marks a record passed over by a forward seek; it was never sent
+	skipped bool
+}
+
+// workerCount clamps the configured worker count to something usable
+func (o DeliveryOptions) workerCount() int {
+	if o.Workers < 1 {
+		return 1
+	}
+	if o.Workers > MaxWorkers {
+		return MaxWorkers
+	}
+	return o.Workers
+}
+
+// partitionFor picks the worker for a record. Records with the same partition
+// value land on the same worker so their relative order is preserved; records
+// without one are spread round-robin using their sequence number.
+func partitionFor(record map[string]interface{}, key string, workers, seq int) int {
+	if workers == 1 {
+		return 0
+	}
+	if key != "" {
+		if value, ok := lookupField(record, key); ok {
+			h := fnv.New32a()
+			fmt.Fprint(h, value)
+			return int(h.Sum32() % uint32(workers))
+		}
+	}
+	return seq % workers
+}
+
+// lookupField resolves a dotted field name such as "@sentinelone.deviceHostFqdn"
+func lookupField(record map[string]interface{}, key string) (interface{}, bool) {
+	if value, ok := record[key]; ok {
+		return value, true
+	}
+	current := interface{}(record)
+	start := 0
+	for i := 0; i <= len(key); i++ {
+		if i < len(key) && key[i] != '.' {
+			continue
+		}
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[key[start:i]]
+		if !ok {
+			return nil, false
+		}
+		start = i + 1
+	}
+	return current, true
+}
+
+// deliverer fans records out to a pool of HEC senders
+type deliverer struct {
+	hecURL   string
+	hecToken string
+	opts     DeliveryOptions
+	queues   []chan delivery
+	results  chan deliveryResult
+	wg       sync.WaitGroup
+}
+
+// newDeliverer starts the worker pool. Callers must call close once all
+// records have been submitted, then drain results until it is closed.
+func newDeliverer(hecURL, hecToken string, opts DeliveryOptions) *deliverer {
+	workers := opts.workerCount()
+	d := &deliverer{
+		hecURL:   hecURL,
+		hecToken: hecToken,
+		opts:     opts,
+		queues:   make([]chan delivery, workers),
+		results:  make(chan deliveryResult, workers),
+	}
+	for i := range d.queues {
+		d.queues[i] = make(chan delivery, 16)
+		d.wg.Add(1)
+		go d.work(d.queues[i])
+	}
+	go func() {
+		d.wg.Wait()
+		close(d.results)
+	}()
+	return d
+}
+
+// work sends every record on its queue in the order it was received
+func (d *deliverer) work(queue chan delivery) {
+	defer d.wg.Done()
+	for item := range queue {
+		n, retries, err := sendWithRetry(item.record, d.hecURL, d.hecToken)
+		d.results <- deliveryResult{index: item.index, timestamp: item.timestamp, bytes: n, retries: retries, err: err}
+	}
+}
+
+// submit queues a record on the worker owning its partition
+func (d *deliverer) submit(item delivery) {
+	worker := partitionFor(item.record, d.opts.PartitionKey, len(d.queues), item.index)
+	d.queues[worker] <- item
+}
+
+// close stops accepting records; workers exit once their queues are empty
+func (d *deliverer) close() {
+	for _, queue := range d.queues {
+		close(queue)
+	}
+}
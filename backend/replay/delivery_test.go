@@ -0,0 +1,107 @@
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestHEC starts a local HEC stand-in that answers after latency,
+// roughly what a SIEM across the internet looks like
+func newTestHEC(latency time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(latency)
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"text":"Success","code":0}`)
+	}))
+}
+
+func benchRecords(n, hosts int) []map[string]interface{} {
+	records := make([]map[string]interface{}, n)
+	for i := range records {
+		records[i] = map[string]interface{}{
+			"host":       fmt.Sprintf("host-%d", i%hosts),
+			"seq":        i,
+			"@timestamp": float64(0),
+		}
+	}
+	return records
+}
+
+func runDelivery(records []map[string]interface{}, hecURL string, opts DeliveryOptions) []deliveryResult {
+	d := newDeliverer(hecURL, "token", opts)
+	go func() {
+		for i, record := range records {
+			d.submit(delivery{index: i, record: record})
+		}
+		d.close()
+	}()
+	results := make([]deliveryResult, 0, len(records))
+	for result := range d.results {
+		results = append(results, result)
+	}
+	return results
+}
+
+func TestDeliveryKeepsPartitionOrder(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[string][]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event struct {
+			Host string `json:"host"`
+			Seq  int    `json:"seq"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("bad payload: %v", err)
+		}
+		mu.Lock()
+		seen[event.Host] = append(seen[event.Host], event.Seq)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	records := benchRecords(400, 7)
+	results := runDelivery(records, server.URL, DeliveryOptions{Workers: 8, PartitionKey: "host"})
+	if len(results) != len(records) {
+		t.Fatalf("got %d results, want %d", len(results), len(records))
+	}
+	for host, seqs := range seen {
+		for i := 1; i < len(seqs); i++ {
+			if seqs[i] < seqs[i-1] {
+				t.Fatalf("%s delivered out of order: %v", host, seqs)
+			}
+		}
+	}
+}
+
+func TestPartitionForNestedKey(t *testing.T) {
+	a := map[string]interface{}{"@sentinelone": map[string]interface{}{"deviceHostFqdn": "a"}}
+	b := map[string]interface{}{"@sentinelone": map[string]interface{}{"deviceHostFqdn": "a"}}
+	for seq := 0; seq < 10; seq++ {
+		if partitionFor(a, "@sentinelone.deviceHostFqdn", 8, seq) != partitionFor(b, "@sentinelone.deviceHostFqdn", 8, 0) {
+			t.Fatal("same partition value mapped to different workers")
+		}
+	}
+}
+
+func benchmarkDelivery(b *testing.B, workers int) {
+	server := newTestHEC(2 * time.Millisecond)
+	defer server.Close()
+
+	const perIteration = 200
+	opts := DeliveryOptions{Workers: workers, PartitionKey: "host"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runDelivery(benchRecords(perIteration, 32), server.URL, opts)
+	}
+	b.ReportMetric(float64(b.N*perIteration)/b.Elapsed().Seconds(), "events/s")
+}
+
+func BenchmarkDeliverySerial(b *testing.B)    { benchmarkDelivery(b, 1) }
+func BenchmarkDeliveryWorkers4(b *testing.B)  { benchmarkDelivery(b, 4) }
+func BenchmarkDeliveryWorkers16(b *testing.B) { benchmarkDelivery(b, 16) }
+func BenchmarkDeliveryWorkers64(b *testing.B) { benchmarkDelivery(b, 64) }
@@ -0,0 +1,193 @@
+package replay
+
+import (
+	"time"
+)
+
+// Phase is the stage a replay is in
+type Phase string
+
+const (
+	PhaseDownloading Phase = "downloading"
+	PhaseSending     Phase = "sending"
+	PhaseDraining    Phase = "draining"
+	PhaseDone        Phase = "done"
+	PhaseFailed      Phase = "failed"
+)
+
+// Final statuses carried by the terminal progress event
+const (
+	StatusCompleted           = "completed"
+	StatusCompletedWithErrors = "completed_with_errors"
+	StatusFailed              = "failed"
+)
+
+// maxErrorKinds caps how many distinct error messages a replay keeps
+const maxErrorKinds = 20
+
+// epsWindow is how far back the current events-per-second rate looks
+const epsWindow = 5 * time.Second
+
+// ReplayProgress represents progress update structure
+type ReplayProgress struct {
+	Rec       int     `json:"rec"` // records finished, sent or failed
+	Total     int     `json:"total"`
+	Timestamp int64   `json:"timestamp"`
+	Sent      int     `json:"sent"`
+	Failed    int     `json:"failed"`
+	Retried   int     `json:"retried"`
+	Bytes     int64   `json:"bytes"`
+	EPS       float64 `json:"eps"`
+	ETA       int64   `json:"eta_ms"`
+	Phase     Phase   `json:"phase"`
+	Paused    bool    `json:"paused"`
+	Speed     float64 `json:"speed"`
+	Position  int     `json:"position"` // index of the next record to be sent
+	// Acked is how many records from the start are finished with no gaps; a
+	// resumed replay continues from here
+	Acked int `json:"acked"`
+	// Final is set only on the last event of a replay, together with Status and Error
+	Final  bool   `json:"final,omitempty"`
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Errors counts each distinct send error; only set on the Final event
+	Errors map[string]int `json:"errors,omitempty"`
+}
+
+// FailedProgress is the terminal event for a replay that could not run at all
+func FailedProgress(err error) ReplayProgress {
+	return ReplayProgress{
+		Timestamp: time.Now().UnixMilli(),
+		Phase:     PhaseFailed,
+		Final:     true,
+		Status:    StatusFailed,
+		Error:     err.Error(),
+	}
+}
+
+// progressTracker accumulates delivery results into ReplayProgress events
+type progressTracker struct {
+	current     ReplayProgress
+	schedule    Schedule
+	expectedEnd func() int64
+	lastErr     error
+	recent      []time.Time
+	finished    []bool
+	errors      map[string]int
+}
+
+// newProgressTracker starts tracking a replay whose records before startAt
+// were already handled by an earlier run
+func newProgressTracker(schedule Schedule, startAt int, expectedEnd func() int64) *progressTracker {
+	t := &progressTracker{
+		current:     ReplayProgress{Rec: startAt, Total: len(schedule.Records), Phase: PhaseSending, Acked: startAt},
+		schedule:    schedule,
+		expectedEnd: expectedEnd,
+		finished:    make([]bool, len(schedule.Records)),
+		errors:      map[string]int{},
+	}
+	for i := 0; i < startAt && i < len(t.finished); i++ {
+		t.finished[i] = true
+	}
+	return t
+}
+
+// ack marks a record as finished and moves the acknowledged watermark
+func (t *progressTracker) ack(index int) {
+	if index < 0 || index >= len(t.finished) {
+		return
+	}
+	t.finished[index] = true
+	for t.current.Acked < len(t.finished) && t.finished[t.current.Acked] {
+		t.current.Acked++
+	}
+}
+
+// record folds one delivery result in and returns the updated progress
+func (t *progressTracker) record(result deliveryResult, now time.Time) ReplayProgress {
+	t.ack(result.index)
+	if result.skipped {
+		return t.current
+	}
+
+	t.current.Rec++
+	t.current.Retried += result.retries
+	if result.err != nil {
+		t.current.Failed++
+		t.lastErr = result.err
+		if msg := result.err.Error(); t.errors[msg] > 0 || len(t.errors) < maxErrorKinds {
+			t.errors[msg]++
+		}
+	} else {
+		t.current.Sent++
+		t.current.Bytes += int64(result.bytes)
+		t.current.Timestamp = result.timestamp
+	}
+
+	t.recent = append(t.recent, now)
+	cutoff := now.Add(-epsWindow)
+	drop := 0
+	for drop < len(t.recent) && t.recent[drop].Before(cutoff) {
+		drop++
+	}
+	t.recent = t.recent[drop:]
+
+	elapsed := epsWindow
+	if since := now.Sub(time.UnixMilli(t.schedule.Start)); since < elapsed {
+		elapsed = since
+	}
+	if elapsed > 0 {
+		t.current.EPS = float64(len(t.recent)) / elapsed.Seconds()
+	}
+	t.current.ETA = t.eta(now)
+	return t.current
+}
+
+// eta estimates the remaining time. Paced replays can't finish before the
+// schedule does; unpaced ones are limited by the current rate.
+func (t *progressTracker) eta(now time.Time) int64 {
+	remaining := t.current.Total - t.current.Rec
+	if remaining <= 0 {
+		return 0
+	}
+	var eta int64
+	if t.current.EPS > 0 {
+		eta = int64(float64(remaining) / t.current.EPS * 1000)
+	}
+	if scheduled := t.expectedEnd() - now.UnixMilli(); scheduled > eta {
+		eta = scheduled
+	}
+	return eta
+}
+
+// control reflects the live controls in the next progress event
+func (t *progressTracker) control(state ControlState) ReplayProgress {
+	t.current.Paused = state.Paused
+	t.current.Speed = state.Speed
+	t.current.Position = state.Position
+	return t.current
+}
+
+// phase moves the replay to a new stage and returns the progress to report
+func (t *progressTracker) phase(phase Phase) ReplayProgress {
+	t.current.Phase = phase
+	return t.current
+}
+
+// finish builds the terminal event once every record has been handled
+func (t *progressTracker) finish() ReplayProgress {
+	t.current.Final = true
+	t.current.ETA = 0
+	t.current.Phase = PhaseDone
+	t.current.Status = StatusCompleted
+	if t.current.Failed > 0 {
+		t.current.Status = StatusCompletedWithErrors
+		t.current.Error = t.lastErr.Error()
+		t.current.Errors = t.errors
+	}
+	if t.current.Failed > 0 && t.current.Sent == 0 {
+		t.current.Phase = PhaseFailed
+		t.current.Status = StatusFailed
+	}
+	return t.current
+}
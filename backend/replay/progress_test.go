@@ -0,0 +1,118 @@
+package replay
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testSchedule(n int, start time.Time) Schedule {
+	return Schedule{Start: start.UnixMilli(), Records: make([]ScheduledRecord, n)}
+}
+
+func TestProgressAckedWatermark(t *testing.T) {
+	start := time.UnixMilli(1_000_000)
+	tracker := newProgressTracker(testSchedule(6, start), 1, func() int64 { return 0 })
+	tests := []struct {
+		result deliveryResult
+		acked  int
+		rec    int
+	}{
+		{deliveryResult{index: 2}, 1, 2}, // out of order; record 1 is still outstanding
+		{deliveryResult{index: 1}, 3, 3}, // fills the gap
+		{deliveryResult{index: 4, skipped: true}, 3, 3},
+		{deliveryResult{index: 3, err: errors.New("HEC returned 503")}, 5, 4}, // failures are finished too
+		{deliveryResult{index: 9}, 5, 5},                                      // out of range, ignored for the watermark
+		{deliveryResult{index: 5}, 6, 6},
+	}
+	for i, tt := range tests {
+		got := tracker.record(tt.result, start.Add(time.Second))
+		if got.Acked != tt.acked || got.Rec != tt.rec {
+			t.Errorf("step %d: acked = %d, rec = %d; want %d, %d", i, got.Acked, got.Rec, tt.acked, tt.rec)
+		}
+	}
+}
+
+func TestProgressCounts(t *testing.T) {
+	start := time.UnixMilli(1_000_000)
+	tracker := newProgressTracker(testSchedule(3, start), 0, func() int64 { return 0 })
+	tracker.record(deliveryResult{index: 0, bytes: 100, retries: 2, timestamp: 5}, start)
+	got := tracker.record(deliveryResult{index: 1, retries: 3, err: errors.New("timeout")}, start)
+	if got.Sent != 1 || got.Failed != 1 || got.Retried != 5 || got.Bytes != 100 || got.Timestamp != 5 {
+		t.Errorf("progress = %+v, want 1 sent of 100 bytes, 1 failed, 5 retries", got)
+	}
+}
+
+func TestProgressEPSAndETA(t *testing.T) {
+	start := time.UnixMilli(1_000_000)
+	expectedEnd := int64(0)
+	tracker := newProgressTracker(testSchedule(100, start), 0, func() int64 { return expectedEnd })
+
+	// 10 records in the first second; the rate is over the time since start
+	var got ReplayProgress
+	for i := 0; i < 10; i++ {
+		got = tracker.record(deliveryResult{index: i}, start.Add(time.Second))
+	}
+	if got.EPS != 10 || got.ETA != 9000 {
+		t.Errorf("after 1s: eps = %v, eta = %d; want 10, 9000", got.EPS, got.ETA)
+	}
+
+	// Ten seconds in only the last five count
+	for i := 10; i < 20; i++ {
+		got = tracker.record(deliveryResult{index: i}, start.Add(10*time.Second))
+	}
+	if got.EPS != 2 || got.ETA != 40000 {
+		t.Errorf("after 10s: eps = %v, eta = %d; want 2, 40000", got.EPS, got.ETA)
+	}
+
+	// A paced replay can't finish before its schedule does
+	expectedEnd = start.Add(10*time.Second).UnixMilli() + 120000
+	got = tracker.record(deliveryResult{index: 20}, start.Add(10*time.Second))
+	if got.ETA != 120000 {
+		t.Errorf("paced eta = %d, want the 120000 left on the schedule", got.ETA)
+	}
+}
+
+func TestProgressFinish(t *testing.T) {
+	start := time.UnixMilli(1_000_000)
+	tests := []struct {
+		name   string
+		errs   []error
+		phase  Phase
+		status string
+		errors map[string]int
+	}{
+		{"all sent", []error{nil, nil}, PhaseDone, StatusCompleted, nil},
+		{"some failed", []error{nil, errors.New("HEC returned 400")}, PhaseDone, StatusCompletedWithErrors, map[string]int{"HEC returned 400": 1}},
+		{"all failed", []error{errors.New("refused"), errors.New("refused")}, PhaseFailed, StatusFailed, map[string]int{"refused": 2}},
+	}
+	for _, tt := range tests {
+		tracker := newProgressTracker(testSchedule(len(tt.errs), start), 0, func() int64 { return 0 })
+		for i, err := range tt.errs {
+			tracker.record(deliveryResult{index: i, err: err}, start)
+		}
+		got := tracker.finish()
+		if !got.Final || got.ETA != 0 || got.Phase != tt.phase || got.Status != tt.status || !reflect.DeepEqual(got.Errors, tt.errors) {
+			t.Errorf("%s: final = %v, eta = %d, phase = %s, status = %s, errors = %v", tt.name, got.Final, got.ETA, got.Phase, got.Status, got.Errors)
+		}
+		if tt.errors != nil && got.Error == "" {
+			t.Errorf("%s: final event has no error", tt.name)
+		}
+	}
+}
+
+func TestProgressCapsErrorKinds(t *testing.T) {
+	start := time.UnixMilli(1_000_000)
+	n := maxErrorKinds + 5
+	tracker := newProgressTracker(testSchedule(n+1, start), 0, func() int64 { return 0 })
+	for i := 0; i < n; i++ {
+		tracker.record(deliveryResult{index: i, err: fmt.Errorf("error %d", i)}, start)
+	}
+	tracker.record(deliveryResult{index: n, err: errors.New("error 0")}, start)
+	got := tracker.finish()
+	if len(got.Errors) != maxErrorKinds || got.Errors["error 0"] != 2 || got.Failed != n+1 {
+		t.Errorf("kept %d error kinds, error 0 counted %d times, %d failed", len(got.Errors), got.Errors["error 0"], got.Failed)
+	}
+}
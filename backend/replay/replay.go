@@ -4,18 +4,13 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"time"
 )
 
-// ReplayProgress represents progress update structure
-type ReplayProgress struct {
-	Rec       int   `json:"rec"`
-	Total     int   `json:"total"`
-	Timestamp int64 `json:"timestamp"`
-}
-
 // Read JSON records from file
 func readRecords(filePath string) ([]map[string]interface{}, error) {
 	file, err := ioutil.ReadFile(filePath)
@@ -31,73 +26,170 @@ func readRecords(filePath string) ([]map[string]interface{}, error) {
 	return records, nil
 }
 
-// Send event to HEC
-func sendToHEC(event map[string]interface{}, hecURL, hecToken string) error {
+// hecClient is shared by all senders so connections to the HEC are reused
+var hecClient = &http.Client{Timeout: 30 * time.Second}
+
+// maxSendAttempts is how many times a record is tried before it counts as failed
+const maxSendAttempts = 3
+
+// retryBackoff is the base delay between attempts; it grows with each retry
+const retryBackoff = 250 * time.Millisecond
+
+// hecError is a non-2xx answer from the HEC
+type hecError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *hecError) Error() string {
+	return fmt.Sprintf("HEC returned HTTP %d: %s", e.StatusCode, e.Body)
+}
+
+// retryable reports whether sending the same record again could succeed
+func retryable(err error) bool {
+	if he, ok := err.(*hecError); ok {
+		return he.StatusCode == http.StatusTooManyRequests || he.StatusCode >= 500
+	}
+	return true
+}
+
+// Send event to HEC, returning the payload size
+func sendToHEC(event map[string]interface{}, hecURL, hecToken string) (int, error) {
 	jsonPayload, _ := json.Marshal(event)
 	req, err := http.NewRequest("POST", hecURL, bytes.NewBuffer(jsonPayload))
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	req.Header.Set("Authorization", "Splunk "+hecToken)
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := hecClient.Do(req)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer resp.Body.Close()
 
-	return nil
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return 0, &hecError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	io.Copy(io.Discard, resp.Body)
+
+	return len(jsonPayload), nil
+}
+
+// sendWithRetry retries transient HEC failures with a growing backoff
+func sendWithRetry(event map[string]interface{}, hecURL, hecToken string) (int, int, error) {
+	var err error
+	for attempt := 0; attempt < maxSendAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * retryBackoff)
+		}
+		var n int
+		n, err = sendToHEC(event, hecURL, hecToken)
+		if err == nil || !retryable(err) {
+			return n, attempt, err
+		}
+	}
+	return 0, maxSendAttempts - 1, err
 }
 
 // Process and send records with updated timestamps
 func ReplayRecords(filePath, hecURL, hecToken string, progressChan chan ReplayProgress) {
+	ReplayRecordsWithOptions(filePath, hecURL, hecToken, DefaultOptions, nil, progressChan)
+}
+
+// ReplayRecordsWithOptions is ReplayRecords with a configurable pool of senders,
+// anchor time and playback speed. A non-nil control lets the caller pause,
+// resume, change speed or seek while it runs. Progress is reported in
+// completion order and always ends with a Final event, even when records fail.
+func ReplayRecordsWithOptions(filePath, hecURL, hecToken string, opts Options, control *Controller, progressChan chan ReplayProgress) {
+	defer close(progressChan)
+
 	records, err := readRecords(filePath)
 	if err != nil {
-		fmt.Println("Error reading scenario file:", err)
-		close(progressChan)
+		log.Printf("❌ Failed to read scenario file %s: %v", filePath, err)
+		progressChan <- FailedProgress(fmt.Errorf("failed to read scenario file: %w", err))
 		return
 	}
 
-	startTime := time.Now().UnixMilli()
-
-	for index, record := range records {
-		eventOffset, ok := record["@timestamp"].(float64)
-		if !ok {
-			eventOffset = 0
-		}
-
-		// eventTime := startTime + int64(eventOffset)
-		eventTime := startTime - int64(eventOffset / 1000)
-
-		if eventTime < startTime {
-			fmt.Println("Warning: Adjusting eventTime, detected incorrect offset")
-			fmt.Println("Base Time:", startTime)
-			fmt.Println("Offset:", eventOffset)
-			fmt.Println("Calculated Event Time:", eventTime, time.UnixMilli(eventTime))
-			eventTime = startTime
-		}
+	schedule := BuildSchedule(records, opts.TimingOptions, time.Now().UnixMilli())
+	for _, warning := range schedule.Warnings {
+		log.Printf("⚠️ %s", warning)
+	}
 
-		record["@timestamp"] = eventTime
+	startAt := opts.StartAt
+	if startAt < 0 || startAt > len(records) {
+		startAt = 0
+	}
 
-		err := sendToHEC(record, hecURL, hecToken)
-		if err != nil {
-			fmt.Println("Error sending record:", err)
-			continue
+	if control == nil {
+		control = NewController(opts.Speed)
+	}
+	control.start(len(records), startAt)
+	pace := newPacer(schedule, control, startAt)
+
+	tracker := newProgressTracker(schedule, startAt, pace.ExpectedEnd)
+	tracker.control(control.State())
+	progressChan <- tracker.phase(PhaseSending)
+
+	d := newDeliverer(hecURL, hecToken, opts.DeliveryOptions)
+	dispatched := make(chan struct{})
+	go func() {
+		index := startAt
+		for index < len(records) {
+			if seek, ok := control.takeSeek(); ok {
+				// Records jumped over count as handled so a resume won't send them
+				for skipped := index; skipped < seek; skipped++ {
+					d.results <- deliveryResult{index: skipped, skipped: true}
+				}
+				index = seek
+				control.advance(index)
+				pace.seekTo(index, time.Now())
+				continue
+			}
+			if !pace.wait(index) {
+				pace.rebase(time.Now())
+				continue
+			}
+
+			entry := schedule.Records[index]
+			d.submit(delivery{index: index, timestamp: entry.EventTime, record: applySchedule(records[index], entry)})
+			pace.sent(index, time.Now())
+			index++
+			control.advance(index)
 		}
-
-		fmt.Println("Timestamp Debug:", eventTime, time.UnixMilli(eventTime))
-
-		progress := ReplayProgress{
-			Rec:       index + 1,
-			Total:     len(records),
-			Timestamp: eventTime,
+		d.close()
+		close(dispatched)
+	}()
+
+	changed := control.Changed()
+	results := d.results
+	for results != nil {
+		select {
+		case <-dispatched:
+			dispatched = nil
+			progressChan <- tracker.phase(PhaseDraining)
+		case <-changed:
+			changed = control.Changed()
+			progressChan <- tracker.control(control.State())
+		case result, ok := <-results:
+			if !ok {
+				results = nil
+				continue
+			}
+			if result.skipped {
+				tracker.record(result, time.Now())
+				continue
+			}
+			if result.err != nil {
+				log.Printf("❌ Failed to send record %d: %v", result.index, result.err)
+			}
+			tracker.control(control.State())
+			progressChan <- tracker.record(result, time.Now())
 		}
-
-		progressChan <- progress
 	}
 
-	close(progressChan)
-}
\ No newline at end of file
+	progressChan <- tracker.finish()
+}
@@ -0,0 +1,172 @@
+package replay
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimingOptions controls where a replay is anchored and how fast it plays back
+type TimingOptions struct {
+	// Anchor is the unix millisecond time the scenario starts at. Zero means now.
+	Anchor int64 `json:"anchor"`
+	// Speed is a playback multiplier applied to the gaps between events.
+	// Zero sends every record as fast as the HEC accepts them.
+	Speed float64 `json:"speed"`
+}
+
+// Options bundles everything that shapes a replay
+type Options struct {
+	DeliveryOptions
+	TimingOptions
+	// StartAt is the index of the first record to send. Resumed replays set it
+	// to the checkpointed position; the anchor must be the original one.
+	StartAt int `json:"start_at"`
+}
+
+// DefaultOptions sends serially, anchored at now, without pacing
+var DefaultOptions = Options{DeliveryOptions: DefaultDeliveryOptions}
+
+// ScheduledRecord is when and as what a single record will be sent
+type ScheduledRecord struct {
+	Index     int     `json:"index"`
+	Offset    float64 `json:"offset"`
+	EventTime int64   `json:"event_time"`
+	SendAt    int64   `json:"send_at"`
+	Clamped   bool    `json:"clamped,omitempty"`
+}
+
+// Schedule is the computed send plan for a whole scenario
+type Schedule struct {
+	Start    int64             `json:"start"`
+	Anchor   int64             `json:"anchor"`
+	Speed    float64           `json:"speed"`
+	Duration int64             `json:"duration_ms"`
+	Records  []ScheduledRecord `json:"records"`
+	Warnings []string          `json:"warnings"`
+}
+
+// eventTimeFor turns a scenario offset into the @timestamp written to the event.
+// Offsets that would land before the anchor are clamped to it.
+func eventTimeFor(anchor int64, eventOffset float64) (int64, bool) {
+	// eventTime := anchor + int64(eventOffset)
+	eventTime := anchor - int64(eventOffset/1000)
+	if eventTime < anchor {
+		return anchor, true
+	}
+	return eventTime, false
+}
+
+// BuildSchedule computes event times and wall-clock send times for records
+// without modifying them. now is the wall-clock start of the replay.
+func BuildSchedule(records []map[string]interface{}, opts TimingOptions, now int64) Schedule {
+	anchor := opts.Anchor
+	if anchor == 0 {
+		anchor = now
+	}
+	speed := opts.Speed
+	if speed < 0 {
+		speed = 0
+	}
+
+	schedule := Schedule{
+		Start:    now,
+		Anchor:   anchor,
+		Speed:    speed,
+		Records:  make([]ScheduledRecord, len(records)),
+		Warnings: []string{},
+	}
+
+	missing, clamped, backwards := 0, 0, 0
+	var firstEvent, lastEvent int64
+	for index, record := range records {
+		eventOffset, ok := record["@timestamp"].(float64)
+		if !ok {
+			eventOffset = 0
+			missing++
+		}
+
+		eventTime, wasClamped := eventTimeFor(anchor, eventOffset)
+		if wasClamped {
+			clamped++
+		}
+		if index == 0 {
+			firstEvent = eventTime
+		} else if eventTime < lastEvent {
+			backwards++
+		}
+		lastEvent = eventTime
+
+		sendAt := now
+		if speed > 0 && eventTime > firstEvent {
+			sendAt = now + int64(float64(eventTime-firstEvent)/speed)
+		}
+
+		schedule.Records[index] = ScheduledRecord{
+			Index:     index,
+			Offset:    eventOffset,
+			EventTime: eventTime,
+			SendAt:    sendAt,
+			Clamped:   wasClamped,
+		}
+		if sendAt-now > schedule.Duration {
+			schedule.Duration = sendAt - now
+		}
+	}
+
+	if missing > 0 {
+		schedule.Warnings = append(schedule.Warnings, fmt.Sprintf("%d records have no numeric @timestamp offset and will be sent at the anchor time", missing))
+	}
+	if clamped > 0 {
+		schedule.Warnings = append(schedule.Warnings, fmt.Sprintf("%d records had offsets before the anchor and were clamped to it", clamped))
+	}
+	if backwards > 0 {
+		schedule.Warnings = append(schedule.Warnings, fmt.Sprintf("%d records are earlier than the record before them; scenario is not sorted by time", backwards))
+	}
+	if anchor > now+int64(24*time.Hour/time.Millisecond) {
+		schedule.Warnings = append(schedule.Warnings, "anchor is more than a day in the future; the SIEM may reject or hide these events")
+	}
+	return schedule
+}
+
+// Preview is what a replay would send, without sending anything
+type Preview struct {
+	Total    int                      `json:"total"`
+	Records  []map[string]interface{} `json:"records"`
+	Schedule Schedule                 `json:"schedule"`
+}
+
+// PreviewRecords loads a scenario file and returns the first limit transformed
+// records along with the send schedule for the whole file.
+func PreviewRecords(filePath string, opts TimingOptions, limit int) (Preview, error) {
+	records, err := readRecords(filePath)
+	if err != nil {
+		return Preview{}, fmt.Errorf("failed to read scenario file: %w", err)
+	}
+
+	schedule := BuildSchedule(records, opts, time.Now().UnixMilli())
+	if limit < 0 || limit > len(records) {
+		limit = len(records)
+	}
+
+	preview := Preview{
+		Total:    len(records),
+		Records:  make([]map[string]interface{}, limit),
+		Schedule: schedule,
+	}
+	for i := 0; i < limit; i++ {
+		preview.Records[i] = applySchedule(records[i], schedule.Records[i])
+	}
+	preview.Schedule.Records = schedule.Records[:limit]
+	return preview, nil
+}
+
+// applySchedule returns a copy of the record as it will be sent. The original
+// is left alone so a record can be sent again after a seek.
+func applySchedule(record map[string]interface{}, entry ScheduledRecord) map[string]interface{} {
+	out := make(map[string]interface{}, len(record))
+	for key, value := range record {
+		out[key] = value
+	}
+	out["@timestamp"] = entry.EventTime
+	return out
+}
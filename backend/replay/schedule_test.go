@@ -0,0 +1,174 @@
+package replay
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Scenario offsets are microseconds before the first event, stored negated:
+// -5000 is 5ms after the first event and a positive offset is before it
+func TestEventTimeFor(t *testing.T) {
+	tests := []struct {
+		offset  float64
+		want    int64
+		clamped bool
+	}{
+		{0, 1000, false},
+		{-5000, 1005, false},
+		{-2500000, 3500, false},
+		{-999, 1000, false}, // under a millisecond rounds down to the anchor
+		{5000, 1000, true},
+	}
+	for _, tt := range tests {
+		got, clamped := eventTimeFor(1000, tt.offset)
+		if got != tt.want || clamped != tt.clamped {
+			t.Errorf("eventTimeFor(1000, %v) = %d, %v; want %d, %v", tt.offset, got, clamped, tt.want, tt.clamped)
+		}
+	}
+}
+
+func TestBuildSchedule(t *testing.T) {
+	const now = 1_000_000
+	offsets := func(values ...interface{}) []map[string]interface{} {
+		records := make([]map[string]interface{}, len(values))
+		for i, value := range values {
+			records[i] = map[string]interface{}{"@timestamp": value}
+		}
+		return records
+	}
+	tests := []struct {
+		name       string
+		records    []map[string]interface{}
+		opts       TimingOptions
+		anchor     int64
+		eventTimes []int64
+		sendAts    []int64
+		duration   int64
+		warnings   []string
+	}{
+		{
+			name:       "unpaced at now",
+			records:    offsets(0.0, -1000000.0, -3000000.0),
+			anchor:     now,
+			eventTimes: []int64{now, now + 1000, now + 3000},
+			sendAts:    []int64{now, now, now},
+		},
+		{
+			name:       "real time from an anchor",
+			records:    offsets(0.0, -1000000.0, -3000000.0),
+			opts:       TimingOptions{Anchor: 500, Speed: 1},
+			anchor:     500,
+			eventTimes: []int64{500, 1500, 3500},
+			sendAts:    []int64{now, now + 1000, now + 3000},
+			duration:   3000,
+		},
+		{
+			name:       "double speed",
+			records:    offsets(0.0, -1000000.0, -3000000.0),
+			opts:       TimingOptions{Speed: 2},
+			anchor:     now,
+			eventTimes: []int64{now, now + 1000, now + 3000},
+			sendAts:    []int64{now, now + 500, now + 1500},
+			duration:   1500,
+		},
+		{
+			name:       "negative speed is unpaced",
+			records:    offsets(0.0, -1000000.0),
+			opts:       TimingOptions{Speed: -1},
+			anchor:     now,
+			eventTimes: []int64{now, now + 1000},
+			sendAts:    []int64{now, now},
+		},
+		{
+			name:       "clamped, missing and unsorted",
+			records:    offsets(-2000000.0, 4000000.0, "soon", -1000000.0),
+			opts:       TimingOptions{Speed: 1},
+			anchor:     now,
+			eventTimes: []int64{now + 2000, now, now, now + 1000},
+			sendAts:    []int64{now, now, now, now},
+			warnings: []string{
+				"1 records have no numeric @timestamp offset and will be sent at the anchor time",
+				"1 records had offsets before the anchor and were clamped to it",
+				"1 records are earlier than the record before them; scenario is not sorted by time",
+			},
+		},
+		{
+			name:       "far future anchor",
+			records:    offsets(0.0),
+			opts:       TimingOptions{Anchor: now + 2*86400000},
+			anchor:     now + 2*86400000,
+			eventTimes: []int64{now + 2*86400000},
+			sendAts:    []int64{now},
+			warnings:   []string{"anchor is more than a day in the future; the SIEM may reject or hide these events"},
+		},
+	}
+	for _, tt := range tests {
+		schedule := BuildSchedule(tt.records, tt.opts, now)
+		eventTimes, sendAts := []int64{}, []int64{}
+		for i, record := range schedule.Records {
+			if record.Index != i {
+				t.Errorf("%s: record %d has index %d", tt.name, i, record.Index)
+			}
+			eventTimes = append(eventTimes, record.EventTime)
+			sendAts = append(sendAts, record.SendAt)
+		}
+		if tt.warnings == nil {
+			tt.warnings = []string{}
+		}
+		if schedule.Start != now || schedule.Anchor != tt.anchor || !reflect.DeepEqual(eventTimes, tt.eventTimes) ||
+			!reflect.DeepEqual(sendAts, tt.sendAts) || schedule.Duration != tt.duration || !reflect.DeepEqual(schedule.Warnings, tt.warnings) {
+			t.Errorf("%s: got anchor %d, event times %v, sends %v, duration %d, warnings %q; want %d, %v, %v, %d, %q",
+				tt.name, schedule.Anchor, eventTimes, sendAts, schedule.Duration, schedule.Warnings,
+				tt.anchor, tt.eventTimes, tt.sendAts, tt.duration, tt.warnings)
+		}
+	}
+
+	// Building a schedule leaves the records alone
+	records := offsets(-1000000.0)
+	BuildSchedule(records, TimingOptions{Anchor: 1}, now)
+	if records[0]["@timestamp"] != -1000000.0 {
+		t.Errorf("BuildSchedule changed a record: %v", records[0])
+	}
+}
+
+func TestPreviewRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.json")
+	scenario := `[{"@timestamp":0,"user":"alice"},{"@timestamp":-1000000,"user":"bob"},{"@timestamp":-2000000,"user":"carol"}]`
+	if err := os.WriteFile(path, []byte(scenario), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		limit, want int
+	}{
+		{2, 2},
+		{10, 3},
+		{-1, 3},
+		{0, 0},
+	}
+	for _, tt := range tests {
+		preview, err := PreviewRecords(path, TimingOptions{Anchor: 10000, Speed: 1}, tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if preview.Total != 3 || len(preview.Records) != tt.want || len(preview.Schedule.Records) != tt.want {
+			t.Errorf("limit %d: got %d of %d records and %d scheduled, want %d", tt.limit, len(preview.Records), preview.Total, len(preview.Schedule.Records), tt.want)
+		}
+		// The duration still covers the whole scenario
+		if preview.Schedule.Duration != 2000 {
+			t.Errorf("limit %d: duration = %d, want 2000", tt.limit, preview.Schedule.Duration)
+		}
+	}
+
+	preview, _ := PreviewRecords(path, TimingOptions{Anchor: 10000}, 2)
+	if preview.Records[1]["@timestamp"] != int64(11000) || preview.Records[1]["user"] != "bob" {
+		t.Errorf("previewed record = %v, want bob at 11000", preview.Records[1])
+	}
+
+	if _, err := PreviewRecords(filepath.Join(t.TempDir(), "missing.json"), TimingOptions{}, 1); err == nil || !strings.Contains(err.Error(), "failed to read scenario file") {
+		t.Errorf("missing file: err = %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package sanitize
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+)
+
+// Field actions
+const (
+	ActionDrop     = "drop"
+	ActionSet      = "set"
+	ActionHash     = "hash"
+	ActionTruncate = "truncate"
+	ActionReplace  = "replace"
+)
+
+// hashLength is how many hex characters of the HMAC a hashed value keeps
+const hashLength = 16
+
+// FieldAction applies one action to every value a path expression matches
+type FieldAction struct {
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	// Value is the new value for set
+	Value interface{} `json:"value,omitempty"`
+	// Length is how many characters truncate keeps
+	Length int `json:"length,omitempty"`
+	// Pattern and Replace are the regular expression and its replacement
+	// for replace; Replace may use $1 style groups
+	Pattern string `json:"pattern,omitempty"`
+	Replace string `json:"replace,omitempty"`
+}
+
+// compile checks an action and turns it into a step
+func (a FieldAction) compile(key []byte) (step, error) {
+	p, err := ParsePath(a.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch a.Action {
+	case ActionDrop:
+		return p.Drop, nil
+	case ActionSet:
+		value := a.Value
+		return func(event interface{}) interface{} { return p.Set(event, deepCopy(value)) }, nil
+	case ActionHash:
+		if len(key) == 0 {
+			return nil, fmt.Errorf("hash on %s needs a scenario key", a.Path)
+		}
+		return stringStep(p, func(v string) string {
+			mac := hmac.New(sha256.New, key)
+			mac.Write([]byte("hash\x00" + v))
+			return hex.EncodeToString(mac.Sum(nil))[:hashLength]
+		}), nil
+	case ActionTruncate:
+		if a.Length <= 0 {
+			return nil, fmt.Errorf("truncate on %s needs a positive length", a.Path)
+		}
+		length := a.Length
+		return stringStep(p, func(v string) string {
+			if runes := []rune(v); len(runes) > length {
+				return string(runes[:length])
+			}
+			return v
+		}), nil
+	case ActionReplace:
+		re, err := regexp.Compile(a.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern on %s: %v", a.Path, err)
+		}
+		replace := a.Replace
+		return stringStep(p, func(v string) string { return re.ReplaceAllString(v, replace) }), nil
+	}
+	return nil, fmt.Errorf("unknown action %q", a.Action)
+}
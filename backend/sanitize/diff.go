@@ -0,0 +1,105 @@
+package sanitize
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Change kinds reported by Diff
+const (
+	ChangeModified = "modified"
+	ChangeRemoved  = "removed"
+	ChangeAdded    = "added"
+)
+
+// Change is one field that differs between an event before and after sanitizing
+type Change struct {
+	Path   string      `json:"path"`
+	Kind   string      `json:"kind"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// RecordDiff is a single previewed event
+type RecordDiff struct {
+	Index   int         `json:"index"`
+	Before  interface{} `json:"before"`
+	After   interface{} `json:"after"`
+	Changes []Change    `json:"changes"`
+}
+
+// Preview sanitizes up to limit events and reports what changed in each
+func (s *Sanitizer) Preview(events []interface{}, limit int) []RecordDiff {
+	if limit <= 0 || limit > len(events) {
+		limit = len(events)
+	}
+	diffs := make([]RecordDiff, 0, limit)
+	for i := 0; i < limit; i++ {
+		after := s.Event(events[i])
+		diffs = append(diffs, RecordDiff{
+			Index:   i,
+			Before:  events[i],
+			After:   after,
+			Changes: Diff(events[i], after),
+		})
+	}
+	return diffs
+}
+
+// Diff lists the leaf fields that differ between two decoded JSON values,
+// with paths like "@sentinelone.filePath" and "@behaviors[2].name"
+func Diff(before, after interface{}) []Change {
+	changes := []Change{}
+	diff("", before, after, &changes)
+	return changes
+}
+
+func diff(path string, before, after interface{}, changes *[]Change) {
+	switch b := before.(type) {
+	case map[string]interface{}:
+		a, ok := after.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(b)+len(a))
+		for key := range b {
+			keys = append(keys, key)
+		}
+		for key := range a {
+			if _, ok := b[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := key
+			if path != "" {
+				child = path + "." + key
+			}
+			bv, inBefore := b[key]
+			av, inAfter := a[key]
+			switch {
+			case !inAfter:
+				*changes = append(*changes, Change{Path: child, Kind: ChangeRemoved, Before: bv})
+			case !inBefore:
+				*changes = append(*changes, Change{Path: child, Kind: ChangeAdded, After: av})
+			default:
+				diff(child, bv, av, changes)
+			}
+		}
+		return
+	case []interface{}:
+		a, ok := after.([]interface{})
+		if !ok || len(a) != len(b) {
+			break
+		}
+		for i := range b {
+			diff(fmt.Sprintf("%s[%d]", path, i), b[i], a[i], changes)
+		}
+		return
+	}
+	if !reflect.DeepEqual(before, after) {
+		*changes = append(*changes, Change{Path: path, Kind: ChangeModified, Before: before, After: after})
+	}
+}
@@ -0,0 +1,172 @@
+package sanitize
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// IPAnonymizeRule chooses which addresses are anonymized: the values of the
+// listed fields, or with All every IP-looking string anywhere in the event
+type IPAnonymizeRule struct {
+	Fields []string `json:"fields"`
+	All    bool     `json:"all"`
+}
+
+// Empty reports whether the rule anonymizes nothing
+func (r IPAnonymizeRule) Empty() bool {
+	return len(r.Fields) == 0 && !r.All
+}
+
+// ipCandidate finds strings that may be IPv4 or IPv6 addresses. Matches are
+// checked with netip, so times and MAC addresses are left alone.
+var ipCandidate = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}\b|[0-9A-Fa-f]*:[0-9A-Fa-f:.]*[0-9A-Fa-f]`)
+
+// keptPrefixes are ranges whose prefix is never anonymized, so private,
+// loopback and link-local addresses stay recognisable as such. IPv6 global
+// unicast keeps its /3 so public addresses don't turn into local ones; a
+// public IPv4 address can still land in a private range, as with Crypto-PAn.
+var keptPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("2000::/3"),
+}
+
+// IPAnonymizer is a Crypto-PAn style, prefix-preserving anonymizer: two
+// addresses sharing their first n bits still share exactly n bits afterwards,
+// so subnets survive while the real networks are hidden
+type IPAnonymizer struct {
+	block cipher.Block
+	pad   [16]byte
+}
+
+// NewIPAnonymizer derives an anonymizer from a scenario's key
+func NewIPAnonymizer(key []byte) (*IPAnonymizer, error) {
+	if len(key) < 16 {
+		return nil, fmt.Errorf("anonymization key must be at least 16 bytes")
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("crypto-pan"))
+	secret := mac.Sum(nil)
+
+	block, err := aes.NewCipher(secret[:16])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	a := &IPAnonymizer{block: block}
+	block.Encrypt(a.pad[:], secret[16:32])
+	return a, nil
+}
+
+// Addr anonymizes one address, keeping the prefix of private and other
+// special ranges
+func (a *IPAnonymizer) Addr(addr netip.Addr) netip.Addr {
+	zone := addr.Zone()
+	addr = addr.WithZone("")
+	keep := 0
+	for _, prefix := range keptPrefixes {
+		if prefix.Contains(addr) {
+			keep = prefix.Bits()
+			break
+		}
+	}
+
+	if addr.Is4() || addr.Is4In6() {
+		v4 := addr.Unmap().As4()
+		var bits [16]byte
+		copy(bits[:], v4[:])
+		out := a.anonymize(bits, 32, keep)
+		result := netip.AddrFrom4([4]byte(out[:4]))
+		if addr.Is4In6() {
+			return netip.AddrFrom16(result.As16()).WithZone(zone)
+		}
+		return result
+	}
+	return netip.AddrFrom16(a.anonymize(addr.As16(), 128, keep)).WithZone(zone)
+}
+
+// anonymize flips each bit after keep according to the cipher applied to the
+// bits before it, which is what makes the mapping prefix-preserving
+func (a *IPAnonymizer) anonymize(orig [16]byte, length, keep int) [16]byte {
+	out := orig
+	var input, output [16]byte
+	for i := keep; i < length; i++ {
+		// First i bits of the original address, the rest from the pad
+		for b := 0; b < 16; b++ {
+			switch {
+			case (b+1)*8 <= i:
+				input[b] = orig[b]
+			case b*8 >= i:
+				input[b] = a.pad[b]
+			default:
+				mask := byte(0xff) << (8 - i%8)
+				input[b] = orig[b]&mask | a.pad[b]&^mask
+			}
+		}
+		a.block.Encrypt(output[:], input[:])
+		if output[0]&0x80 != 0 {
+			out[i/8] ^= 0x80 >> (i % 8)
+		}
+	}
+	return out
+}
+
+// String anonymizes an address in text form. Anything that isn't an address
+// is returned unchanged.
+func (a *IPAnonymizer) String(value string) string {
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return value
+	}
+	return a.Addr(addr).String()
+}
+
+// Text anonymizes every address found inside a longer string. Dotted quads
+// that are part of a longer dotted version, such as 10.0.19041.1.2 or
+// v1.2.3.4, are left alone.
+func (a *IPAnonymizer) Text(value string) string {
+	matches := ipCandidate.FindAllStringIndex(value, -1)
+	if len(matches) == 0 {
+		return value
+	}
+	var out strings.Builder
+	last := 0
+	for _, m := range matches {
+		out.WriteString(value[last:m[0]])
+		if match := value[m[0]:m[1]]; versionLike(value, m[0], m[1]) {
+			out.WriteString(match)
+		} else {
+			out.WriteString(a.String(match))
+		}
+		last = m[1]
+	}
+	out.WriteString(value[last:])
+	return out.String()
+}
+
+// versionLike reports whether the IPv4-looking match value[start:end] runs on
+// into more dotted parts or follows a v, as version numbers do
+func versionLike(value string, start, end int) bool {
+	if strings.Contains(value[start:end], ":") {
+		return false
+	}
+	if start > 0 && strings.ContainsRune("vV.", rune(value[start-1])) {
+		return true
+	}
+	return end+1 < len(value) && value[end] == '.' && isAlphanumeric(value[end+1])
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,163 @@
+package sanitize
+
+import (
+	"math/bits"
+	"math/rand"
+	"net/netip"
+	"testing"
+)
+
+func newTestAnonymizer(t *testing.T, key []byte) *IPAnonymizer {
+	a, err := NewIPAnonymizer(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// commonPrefix counts the leading bits two addresses of the same family share
+func commonPrefix(a, b netip.Addr) int {
+	x, y := a.As16(), b.As16()
+	n := 0
+	for i := range x {
+		if x[i] != y[i] {
+			return n + bits.LeadingZeros8(x[i]^y[i])
+		}
+		n += 8
+	}
+	return n
+}
+
+// randomPublic returns a random address outside every kept range
+func randomPublic(r *rand.Rand, v6 bool) netip.Addr {
+	for {
+		var addr netip.Addr
+		if v6 {
+			var b [16]byte
+			r.Read(b[:])
+			b[0] = b[0]&0x1f | 0x40 // 4000::/3, outside 2000::/3
+			addr = netip.AddrFrom16(b)
+		} else {
+			var b [4]byte
+			r.Read(b[:])
+			addr = netip.AddrFrom4(b)
+		}
+		kept := false
+		for _, prefix := range keptPrefixes {
+			kept = kept || prefix.Contains(addr)
+		}
+		if !kept {
+			return addr
+		}
+	}
+}
+
+func TestIPAnonymizerPreservesPrefixes(t *testing.T) {
+	a := newTestAnonymizer(t, testKey)
+	r := rand.New(rand.NewSource(1))
+	for _, v6 := range []bool{false, true} {
+		for i := 0; i < 500; i++ {
+			x := randomPublic(r, v6)
+			// Flip one bit so every prefix length gets exercised
+			y := x.As16()
+			bit := r.Intn(x.BitLen())
+			if !v6 {
+				bit += 96
+			}
+			y[bit/8] ^= 0x80 >> (bit % 8)
+			yAddr := netip.AddrFrom16(y)
+			if !v6 {
+				yAddr = yAddr.Unmap()
+			}
+			kept := false
+			for _, prefix := range keptPrefixes {
+				kept = kept || prefix.Contains(yAddr)
+			}
+			if kept {
+				continue
+			}
+
+			ax, ay := a.Addr(x), a.Addr(yAddr)
+			if want, got := commonPrefix(x, yAddr), commonPrefix(ax, ay); got != want {
+				t.Fatalf("%s and %s share %d bits but anonymize to %s and %s sharing %d", x, yAddr, want, ax, ay, got)
+			}
+		}
+	}
+}
+
+func TestIPAnonymizerKeepsSpecialRanges(t *testing.T) {
+	a := newTestAnonymizer(t, testKey)
+	tests := []struct {
+		addr   string
+		prefix string
+	}{
+		{"10.1.2.3", "10.0.0.0/8"},
+		{"172.20.5.6", "172.16.0.0/12"},
+		{"192.168.1.10", "192.168.0.0/16"},
+		{"127.0.0.1", "127.0.0.0/8"},
+		{"169.254.10.20", "169.254.0.0/16"},
+		{"fd12:3456::1", "fc00::/7"},
+		{"fe80::1%eth0", "fe80::/10"},
+		{"2001:db8::1", "2000::/3"},
+	}
+	for _, tt := range tests {
+		got, err := netip.ParseAddr(a.String(tt.addr))
+		if err != nil {
+			t.Fatalf("String(%s) is not an address: %v", tt.addr, err)
+		}
+		if !netip.MustParsePrefix(tt.prefix).Contains(got.WithZone("")) {
+			t.Errorf("String(%s) = %s, want it inside %s", tt.addr, got, tt.prefix)
+		}
+	}
+	if got := a.String("fe80::1%eth0"); netip.MustParseAddr(got).Zone() != "eth0" {
+		t.Errorf("zone lost: %s", got)
+	}
+	if got := a.String("::ffff:8.8.8.8"); !netip.MustParseAddr(got).Is4In6() {
+		t.Errorf("IPv4-mapped address changed form: %s", got)
+	}
+}
+
+func TestIPAnonymizerIsDeterministicPerKey(t *testing.T) {
+	a, again, other := newTestAnonymizer(t, testKey), newTestAnonymizer(t, testKey), newTestAnonymizer(t, otherTestKey)
+	differs := 0
+	for _, addr := range []string{"8.8.8.8", "93.184.216.34", "1.1.1.1", "2606:4700::1111", "10.0.0.1"} {
+		if a.String(addr) != again.String(addr) {
+			t.Errorf("same key gave %s and %s for %s", a.String(addr), again.String(addr), addr)
+		}
+		if a.String(addr) == addr {
+			t.Errorf("%s was not anonymized", addr)
+		}
+		if a.String(addr) != other.String(addr) {
+			differs++
+		}
+	}
+	if differs == 0 {
+		t.Error("different keys gave the same addresses")
+	}
+	if _, err := NewIPAnonymizer([]byte("short")); err == nil {
+		t.Error("short key accepted")
+	}
+}
+
+func TestIPAnonymizerText(t *testing.T) {
+	a := newTestAnonymizer(t, testKey)
+	tests := []struct {
+		in, want string
+	}{
+		{"login from 8.8.8.8 failed", "login from " + a.String("8.8.8.8") + " failed"},
+		{"connection to 8.8.8.8.", "connection to " + a.String("8.8.8.8") + "."},
+		{"src=8.8.8.8:443", "src=" + a.String("8.8.8.8") + ":443"},
+		{"peer 2606:4700::1111 closed", "peer " + a.String("2606:4700::1111") + " closed"},
+		{"build 10.0.19041.1.2 installed", "build 10.0.19041.1.2 installed"},
+		{"agent version 7.24.1.160.3", "agent version 7.24.1.160.3"},
+		{"running v1.2.3.4", "running v1.2.3.4"},
+		{"at 10:30:00 on 2024-01-01", "at 10:30:00 on 2024-01-01"},
+		{"mac 00:1a:2b:3c:4d:5e", "mac 00:1a:2b:3c:4d:5e"},
+		{"999.1.1.1 is not an address", "999.1.1.1 is not an address"},
+	}
+	for _, tt := range tests {
+		if got := a.Text(tt.in); got != tt.want {
+			t.Errorf("Text(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package sanitize
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Path is a field path expression such as "@sentinelone.filePath",
+// "@behaviors[*].name", "@behaviors[0]" or "@sentinelone.*Hash*".
+//
+// Segments are separated by dots. A segment is a key, which may use the glob
+// characters *, ? and [...]; "*" alone matches every key or array element;
+// "[n]" and "[*]" at the end of a segment pick one or all elements of an
+// array. Keys that themselves
+// contain dots, as flattened events often have, are matched too. A key
+// segment applied to an array applies to each element.
+type Path struct {
+	expr     string
+	segments []segment
+}
+
+type segment struct {
+	key   string // glob; empty for index segments
+	index int    // -1 means every element
+	array bool
+}
+
+// ParsePath checks and parses a path expression
+func ParsePath(expr string) (Path, error) {
+	if expr == "" {
+		return Path{}, fmt.Errorf("empty field path")
+	}
+	p := Path{expr: expr}
+	for _, part := range strings.Split(expr, ".") {
+		key, indexes, err := splitIndexes(part)
+		if err != nil {
+			return Path{}, fmt.Errorf("%v in field path %q", err, expr)
+		}
+		if key == "" && len(indexes) == 0 {
+			return Path{}, fmt.Errorf("empty segment in field path %q", expr)
+		}
+		if key != "" {
+			if _, err := path.Match(key, ""); err != nil {
+				return Path{}, fmt.Errorf("bad pattern %q in field path %q", key, expr)
+			}
+			p.segments = append(p.segments, segment{key: key})
+		}
+		p.segments = append(p.segments, indexes...)
+	}
+	return p, nil
+}
+
+// splitIndexes takes the trailing [n] and [*] index suffixes off a segment.
+// Any other bracket is left in the key as a glob character class, so
+// "*[Hh]ash*" is a key pattern while "hashes[0]" indexes an array.
+func splitIndexes(part string) (string, []segment, error) {
+	var indexes []segment
+	for strings.HasSuffix(part, "]") {
+		open := strings.LastIndex(part, "[")
+		if open < 0 {
+			return "", nil, fmt.Errorf("unmatched ]")
+		}
+		inner := part[open+1 : len(part)-1]
+		seg := segment{array: true, index: -1}
+		if inner != "*" {
+			n, err := strconv.Atoi(inner)
+			if err != nil || n < 0 || strings.TrimLeft(inner, "0123456789") != "" {
+				break
+			}
+			seg.index = n
+		}
+		indexes = append([]segment{seg}, indexes...)
+		part = part[:open]
+	}
+	return part, indexes, nil
+}
+
+// String returns the expression the path was parsed from
+func (p Path) String() string {
+	return p.expr
+}
+
+// Concrete reports whether the path names exactly one location, so Set can
+// create it when it is missing
+func (p Path) Concrete() bool {
+	for _, seg := range p.segments {
+		if (seg.array && seg.index < 0) || strings.ContainsAny(seg.key, "*?[") {
+			return false
+		}
+	}
+	return true
+}
+
+// Visit is called for each value a path matches. It returns the replacement
+// value, or keep=false to remove the field or array element.
+type Visit func(value interface{}) (replacement interface{}, keep bool)
+
+// Apply calls visit for every value the path matches in root, in place, and
+// returns root
+func (p Path) Apply(root interface{}, visit Visit) interface{} {
+	out, _ := p.apply(root, p.segments, visit)
+	return out
+}
+
+func (p Path) apply(node interface{}, segs []segment, visit Visit) (interface{}, bool) {
+	if len(segs) == 0 {
+		return visit(node)
+	}
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if segs[0].array {
+			return node, true
+		}
+		// A key may span several segments when it contains dots. Each key is
+		// walked once, under the longest prefix that matches it.
+		done := map[string]bool{}
+		for n := len(segs); n >= 1; n-- {
+			pattern, ok := joinKeys(segs[:n])
+			if !ok {
+				continue
+			}
+			for key, child := range v {
+				if matched, _ := path.Match(pattern, key); !matched || done[key] {
+					continue
+				}
+				done[key] = true
+				replacement, keep := p.apply(child, segs[n:], visit)
+				if keep {
+					v[key] = replacement
+				} else {
+					delete(v, key)
+				}
+			}
+		}
+		return v, true
+	case []interface{}:
+		seg := segs[0]
+		rest := segs
+		if seg.array || seg.key == "*" {
+			rest = segs[1:]
+		}
+		kept := v[:0]
+		for i, item := range v {
+			if seg.array && seg.index >= 0 && seg.index != i {
+				kept = append(kept, item)
+				continue
+			}
+			if replacement, keep := p.apply(item, rest, visit); keep {
+				kept = append(kept, replacement)
+			}
+		}
+		return kept, true
+	}
+	return node, true
+}
+
+// joinKeys joins consecutive key segments back into a dotted key pattern
+func joinKeys(segs []segment) (string, bool) {
+	keys := make([]string, len(segs))
+	for i, seg := range segs {
+		if seg.array {
+			return "", false
+		}
+		keys[i] = seg.key
+	}
+	return strings.Join(keys, "."), true
+}
+
+// Values returns every value the path matches in root
+func (p Path) Values(root interface{}) []interface{} {
+	values := []interface{}{}
+	p.Apply(root, func(value interface{}) (interface{}, bool) {
+		values = append(values, value)
+		return value, true
+	})
+	return values
+}
+
+// Set stores value at every location the path matches. A concrete path that
+// matches nothing is created, along with any missing parent objects.
+func (p Path) Set(root interface{}, value interface{}) interface{} {
+	found := false
+	root = p.Apply(root, func(interface{}) (interface{}, bool) {
+		found = true
+		return value, true
+	})
+	if found || !p.Concrete() {
+		return root
+	}
+
+	obj, ok := root.(map[string]interface{})
+	if !ok {
+		return root
+	}
+	for i, seg := range p.segments {
+		if seg.array {
+			return root
+		}
+		if i == len(p.segments)-1 {
+			obj[seg.key] = value
+			break
+		}
+		child, ok := obj[seg.key].(map[string]interface{})
+		if !ok {
+			if _, exists := obj[seg.key]; exists {
+				return root
+			}
+			child = map[string]interface{}{}
+			obj[seg.key] = child
+		}
+		obj = child
+	}
+	return root
+}
+
+// Drop removes every field or array element the path matches
+func (p Path) Drop(root interface{}) interface{} {
+	return p.Apply(root, func(interface{}) (interface{}, bool) { return nil, false })
+}
@@ -0,0 +1,159 @@
+package sanitize
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []segment
+		err  bool
+	}{
+		{expr: "@sentinelone.filePath", want: []segment{{key: "@sentinelone"}, {key: "filePath"}}},
+		{expr: "@behaviors[*].name", want: []segment{{key: "@behaviors"}, {array: true, index: -1}, {key: "name"}}},
+		{expr: "@behaviors[0]", want: []segment{{key: "@behaviors"}, {array: true, index: 0}}},
+		{expr: "matrix[1][*]", want: []segment{{key: "matrix"}, {array: true, index: 1}, {array: true, index: -1}}},
+		{expr: "[2].id", want: []segment{{array: true, index: 2}, {key: "id"}}},
+		{expr: "@sentinelone.*[Hh]ash*", want: []segment{{key: "@sentinelone"}, {key: "*[Hh]ash*"}}},
+		{expr: "file[0-9]", want: []segment{{key: "file[0-9]"}}},
+		{expr: "hash[Ss][0]", want: []segment{{key: "hash[Ss]"}, {array: true, index: 0}}},
+		{expr: "", err: true},
+		{expr: "a..b", err: true},
+		{expr: "a.", err: true},
+		{expr: "a[", err: true},
+		{expr: "a[]", err: true},
+		{expr: "a[-1]", err: true},
+		{expr: "a]", err: true},
+	}
+	for _, tt := range tests {
+		p, err := ParsePath(tt.expr)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParsePath(%q) = %+v, want an error", tt.expr, p.segments)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePath(%q): %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(p.segments, tt.want) {
+			t.Errorf("ParsePath(%q) = %+v, want %+v", tt.expr, p.segments, tt.want)
+		}
+		if p.String() != tt.expr {
+			t.Errorf("String() = %q, want %q", p.String(), tt.expr)
+		}
+	}
+}
+
+// testEvent decodes JSON so tests see the same types the sanitizer does
+func testEvent(t *testing.T, data string) interface{} {
+	var event interface{}
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestPathValues(t *testing.T) {
+	event := `{
+		"@sentinelone": {"sha1Hash": "a", "SHA256Hash": "b", "filePath": "c"},
+		"@behaviors": [{"name": "x"}, {"name": "y"}],
+		"host.name": "flat",
+		"user": {"name.full": "dotted"},
+		"ids": [1, 2, 3]
+	}`
+	tests := []struct {
+		expr string
+		want []interface{}
+	}{
+		{"@sentinelone.filePath", []interface{}{"c"}},
+		{"@sentinelone.*[Hh]ash*", []interface{}{"a", "b"}},
+		{"@behaviors[*].name", []interface{}{"x", "y"}},
+		{"@behaviors.name", []interface{}{"x", "y"}},
+		{"@behaviors[1].name", []interface{}{"y"}},
+		{"host.name", []interface{}{"flat"}},
+		{"user.name.full", []interface{}{"dotted"}},
+		{"ids[2]", []interface{}{float64(3)}},
+		{"ids[*]", []interface{}{float64(1), float64(2), float64(3)}},
+		{"missing.field", []interface{}{}},
+		{"ids[9]", []interface{}{}},
+	}
+	for _, tt := range tests {
+		p, err := ParsePath(tt.expr)
+		if err != nil {
+			t.Fatalf("ParsePath(%q): %v", tt.expr, err)
+		}
+		got := p.Values(testEvent(t, event))
+		sort.Slice(got, func(i, j int) bool { return fmt.Sprint(got[i]) < fmt.Sprint(got[j]) })
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Values(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+// A key matched by more than one joined prefix must still be visited once
+func TestPathVisitsEachKeyOnce(t *testing.T) {
+	tests := []struct {
+		expr  string
+		event string
+		want  int
+	}{
+		{"*.*", `{"a.b": {"c": "v"}}`, 1},
+		{"*.*", `{"a": {"b": "v", "c": "w"}}`, 2},
+		{"a.*", `{"a.b": "v", "a": {"b": "w"}}`, 2},
+		{"**", `{"a": "v", "b": "w"}`, 2},
+	}
+	for _, tt := range tests {
+		p, err := ParsePath(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		visits := 0
+		p.Apply(testEvent(t, tt.event), func(value interface{}) (interface{}, bool) {
+			visits++
+			return value, true
+		})
+		if visits != tt.want {
+			t.Errorf("%q on %s visited %d values, want %d", tt.expr, tt.event, visits, tt.want)
+		}
+	}
+}
+
+func TestPathSetAndDrop(t *testing.T) {
+	tests := []struct {
+		op, expr, event, want string
+	}{
+		{"set", "user.name", `{"user": {"name": "alice"}}`, `{"user": {"name": "X"}}`},
+		{"set", "user.name", `{}`, `{"user": {"name": "X"}}`},
+		{"set", "user.*", `{}`, `{}`},
+		{"set", "user.name", `{"user": "alice"}`, `{"user": "alice"}`},
+		{"set", "tags[*]", `{"tags": ["a", "b"]}`, `{"tags": ["X", "X"]}`},
+		{"drop", "user.name", `{"user": {"name": "alice", "id": 1}}`, `{"user": {"id": 1}}`},
+		{"drop", "tags[*].secret", `{"tags": [{"secret": 1, "id": 2}, "b"]}`, `{"tags": [{"id": 2}, "b"]}`},
+		{"drop", "*[Hh]ash", `{"sha1Hash": "a", "md5hash": "b", "name": "c"}`, `{"name": "c"}`},
+		{"drop", "host.name", `{"host.name": "a", "host": {"name": "b", "ip": "c"}}`, `{"host": {"ip": "c"}}`},
+	}
+	for _, tt := range tests {
+		p, err := ParsePath(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		apply := func(event interface{}) interface{} { return p.Drop(event) }
+		if tt.op == "set" {
+			apply = func(event interface{}) interface{} { return p.Set(event, "X") }
+		}
+		once := apply(testEvent(t, tt.event))
+		if want := testEvent(t, tt.want); !reflect.DeepEqual(once, want) {
+			t.Errorf("%s %q on %s = %v, want %v", tt.op, tt.expr, tt.event, once, want)
+		}
+		if twice := apply(deepCopy(once)); !reflect.DeepEqual(twice, once) {
+			t.Errorf("%s %q is not idempotent: %v then %v", tt.op, tt.expr, once, twice)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package sanitize
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// ipRedraws is how many times an address is re-drawn when its fake is
+// already taken by another address in the same scenario
+const ipRedraws = 16
+
+// Entity types a PseudonymRule can name
+const (
+	EntityIP       = "ip"
+	EntityHostname = "hostname"
+	EntityUser     = "user"
+	EntityEmail    = "email"
+	EntityDomain   = "domain"
+	EntityPath     = "path"
+)
+
+// PseudonymRule replaces the value of a field with a consistent fake of the given type
+type PseudonymRule struct {
+	Field string `json:"field"`
+	Type  string `json:"type"`
+}
+
+// Pseudonymizer maps real values to realistic fakes with a keyed HMAC, so the
+// same value always becomes the same fake under one key and nothing can be
+// mapped back without it. Names carry a digest suffix that makes two values
+// sharing a fake vanishingly rare; the address space is too small for that, so
+// addresses are also checked for collisions within the scenario.
+type Pseudonymizer struct {
+	key []byte
+
+	mu  sync.Mutex
+	ips map[string]string // fake address -> real address
+}
+
+// NewPseudonymizer creates a Pseudonymizer for a scenario's key
+func NewPseudonymizer(key []byte) (*Pseudonymizer, error) {
+	if len(key) < 16 {
+		return nil, fmt.Errorf("pseudonymization key must be at least 16 bytes")
+	}
+	return &Pseudonymizer{key: key, ips: map[string]string{}}, nil
+}
+
+// Value pseudonymizes a value of the given entity type
+func (p *Pseudonymizer) Value(entity, value string) (string, error) {
+	switch entity {
+	case EntityIP:
+		return p.IP(value), nil
+	case EntityHostname:
+		return p.Hostname(value), nil
+	case EntityUser:
+		return p.User(value), nil
+	case EntityEmail:
+		return p.Email(value), nil
+	case EntityDomain:
+		return p.Domain(value), nil
+	case EntityPath:
+		return p.Path(value), nil
+	}
+	return "", fmt.Errorf("unknown entity type %q", entity)
+}
+
+// digest is the HMAC of a value within one entity type. Values are compared
+// case-insensitively, as hosts, users and domains are in practice.
+func (p *Pseudonymizer) digest(entity, value string) []byte {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(entity))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strings.ToLower(value)))
+	return mac.Sum(nil)
+}
+
+// pick chooses an entry of list using four bytes of the digest
+func pick(list []string, digest []byte, at int) string {
+	return list[binary.BigEndian.Uint32(digest[at:at+4])%uint32(len(list))]
+}
+
+// suffix is six hex digits of the digest. It widens a name space of a few
+// hundred word combinations to billions.
+func suffix(digest []byte, at int) string {
+	return hex.EncodeToString(digest[at : at+3])
+}
+
+// IP maps an address to another of the same family. Private addresses stay
+// private and public ones stay public. If the fake is already used for another
+// address in this scenario the address is re-drawn, so distinct addresses stay
+// distinct; which one keeps the first draw depends on which was seen first.
+func (p *Pseudonymizer) IP(value string) string {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return value
+	}
+	addr := ip.String()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var fake string
+	for draw := 0; draw < ipRedraws; draw++ {
+		input := addr
+		if draw > 0 {
+			input = fmt.Sprintf("%s#%d", addr, draw)
+		}
+		fake = fakeIP(ip, p.digest(EntityIP, input))
+		if taken, ok := p.ips[fake]; !ok || taken == addr {
+			break
+		}
+	}
+	p.ips[fake] = addr
+	return fake
+}
+
+// fakeIP builds an address of ip's family and kind from a digest
+func fakeIP(ip net.IP, d []byte) string {
+	internal := ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast()
+	if v4 := ip.To4(); v4 != nil {
+		host := 1 + d[2]%254 // never the network or broadcast address
+		if internal {
+			return net.IPv4(10, d[0], d[1], host).String()
+		}
+		return net.IPv4(publicOctets[d[3]%byte(len(publicOctets))], d[0], d[1], host).String()
+	}
+	out := make(net.IP, net.IPv6len)
+	copy(out, d[:net.IPv6len])
+	if internal {
+		out[0] = 0xfd // unique local
+	} else {
+		out[0], out[1] = 0x20, 0x01|(out[1]&0x0e)
+	}
+	return out.String()
+}
+
+// publicOctets are first octets of ordinary, routable unicast space
+var publicOctets = []byte{23, 34, 35, 45, 52, 54, 64, 66, 74, 81, 89, 91, 104, 128, 142, 151, 162, 185, 193, 203, 212}
+
+// Hostname maps a host name to one that looks like a managed machine. Any
+// domain suffix is pseudonymized as a domain.
+func (p *Pseudonymizer) Hostname(value string) string {
+	if value == "" || net.ParseIP(value) != nil {
+		return p.IP(value)
+	}
+	host, domain, _ := strings.Cut(value, ".")
+	d := p.digest(EntityHostname, host)
+	fake := fmt.Sprintf("%s-%s-%s", pick(hostRoles, d, 0), pick(words, d, 4), suffix(d, 8))
+	if host == strings.ToUpper(host) {
+		fake = strings.ToUpper(fake)
+	}
+	if domain != "" {
+		fake += "." + p.Domain(domain)
+	}
+	return fake
+}
+
+// User maps an account name to a plausible one. DOMAIN\user and user@domain
+// forms keep their shape.
+func (p *Pseudonymizer) User(value string) string {
+	if domain, user, ok := strings.Cut(value, `\`); ok {
+		return p.netbios(domain) + `\` + p.User(user)
+	}
+	if strings.Contains(value, "@") {
+		return p.Email(value)
+	}
+	if value == "" || wellKnownAccounts[strings.ToLower(value)] {
+		return value
+	}
+	d := p.digest(EntityUser, value)
+	return pick(firstNames, d, 0)[:1] + pick(lastNames, d, 4) + suffix(d, 8)
+}
+
+// netbios maps a Windows domain name to an upper case one of at most the 15
+// characters NetBIOS allows
+func (p *Pseudonymizer) netbios(domain string) string {
+	if domain == "" || wellKnownAccounts[strings.ToLower(domain)] {
+		return domain
+	}
+	d := p.digest(EntityDomain, domain)
+	return strings.ToUpper(pick(words, d, 0) + suffix(d, 4))
+}
+
+// Email maps the user and domain parts of an address separately, so every
+// address at one domain stays at one fake domain
+func (p *Pseudonymizer) Email(value string) string {
+	user, domain, ok := strings.Cut(value, "@")
+	if !ok {
+		return p.User(value)
+	}
+	return p.User(user) + "@" + p.Domain(domain)
+}
+
+// Domain maps each label of a domain name on its own, keeping the TLD and
+// generic labels such as www, so subdomains stay under the same fake parent
+func (p *Pseudonymizer) Domain(value string) string {
+	labels := strings.Split(value, ".")
+	for i, label := range labels {
+		if label == "" || (i == len(labels)-1 && len(labels) > 1) || genericLabels[strings.ToLower(label)] {
+			continue
+		}
+		d := p.digest(EntityDomain, label)
+		labels[i] = pick(words, d, 0) + pick(domainSuffixes, d, 4) + "-" + suffix(d, 8)
+	}
+	return strings.Join(labels, ".")
+}
+
+// Path maps each directory and file name of a path, keeping the separator,
+// system directories and file extensions. User profile directories use the
+// same fake as the user.
+func (p *Pseudonymizer) Path(value string) string {
+	sep := "/"
+	if strings.Contains(value, `\`) {
+		sep = `\`
+	}
+	parts := strings.Split(value, sep)
+	for i, part := range parts {
+		lower := strings.ToLower(part)
+		switch {
+		case part == "" || strings.HasSuffix(part, ":") || systemDirs[lower]:
+			continue
+		case i > 0 && (strings.EqualFold(parts[i-1], "users") || strings.EqualFold(parts[i-1], "home")):
+			parts[i] = p.User(part)
+			continue
+		}
+		name, ext := part, ""
+		if dot := strings.LastIndex(part, "."); dot > 0 {
+			name, ext = part[:dot], part[dot:]
+		}
+		d := p.digest(EntityPath, name)
+		parts[i] = pick(words, d, 0) + "_" + pick(words, d, 4) + ext
+	}
+	return strings.Join(parts, sep)
+}
+
+var wellKnownAccounts = map[string]bool{
+	"system": true, "local service": true, "network service": true, "administrator": true,
+	"guest": true, "root": true, "nt authority": true, "builtin": true, "-": true,
+}
+
+var genericLabels = map[string]bool{
+	"www": true, "mail": true, "smtp": true, "vpn": true, "api": true, "cdn": true,
+	"co": true, "com": true, "org": true, "net": true, "gov": true, "ac": true, "local": true,
+}
+
+var systemDirs = map[string]bool{
+	"windows": true, "system32": true, "syswow64": true, "program files": true, "program files (x86)": true,
+	"programdata": true, "users": true, "appdata": true, "local": true, "roaming": true, "temp": true,
+	"desktop": true, "documents": true, "downloads": true, "home": true, "etc": true, "var": true,
+	"usr": true, "bin": true, "sbin": true, "lib": true, "opt": true, "tmp": true, "log": true,
+	"microsoft": true, "public": true, "root": true,
+}
+
+var hostRoles = []string{"wks", "lt", "srv", "dc", "sql", "web", "app", "file", "vdi", "mx"}
+
+var domainSuffixes = []string{"", "corp", "net", "group", "labs", "tech", "systems", "global"}
+
+var words = []string{
+	"amber", "aspen", "birch", "cobalt", "cedar", "delta", "ember", "falcon", "garnet", "harbor",
+	"indigo", "juniper", "kestrel", "lumen", "maple", "nimbus", "onyx", "pioneer", "quartz", "raven",
+	"sable", "tundra", "umber", "vertex", "willow", "xenon", "yarrow", "zephyr", "atlas", "beacon",
+	"canyon", "drift", "echo", "fjord", "glacier", "horizon", "iris", "jade", "keystone", "lagoon",
+	"meridian", "north", "orchid", "prairie", "quill", "ridge", "summit", "timber", "upland", "valley",
+}
+
+var firstNames = []string{
+	"alex", "blake", "casey", "dana", "eli", "frances", "gray", "harper", "ira", "jordan",
+	"kai", "logan", "morgan", "noel", "oakley", "parker", "quinn", "reese", "sam", "taylor",
+}
+
+var lastNames = []string{
+	"abbott", "barnes", "carver", "dalton", "ellis", "fisher", "garner", "hughes", "irving", "jensen",
+	"keller", "lawson", "mercer", "nolan", "owens", "porter", "quincy", "reyes", "sutton", "turner",
+	"underwood", "vance", "walsh", "young", "zimmer", "bishop", "coleman", "dixon", "foster", "grant",
+}
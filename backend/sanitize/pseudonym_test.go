@@ -0,0 +1,154 @@
+package sanitize
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var (
+	testKey      = []byte("0123456789abcdef0123456789abcdef")
+	otherTestKey = []byte("fedcba9876543210fedcba9876543210")
+)
+
+func newTestPseudonymizer(t *testing.T, key []byte) *Pseudonymizer {
+	p, err := NewPseudonymizer(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestPseudonymizerShapes(t *testing.T) {
+	p := newTestPseudonymizer(t, testKey)
+	tests := []struct {
+		entity, value string
+		shape         *regexp.Regexp
+	}{
+		{EntityHostname, "DESKTOP-4F7K2", regexp.MustCompile(`^[A-Z]+-[A-Z]+-[0-9A-F]{6}$`)},
+		{EntityHostname, "web01.acme.com", regexp.MustCompile(`^[a-z]+-[a-z]+-[0-9a-f]{6}\.[a-z]+-[0-9a-f]{6}\.com$`)},
+		{EntityUser, "jsmith", regexp.MustCompile(`^[a-z]+[0-9a-f]{6}$`)},
+		{EntityUser, `ACME\jsmith`, regexp.MustCompile(`^[A-Z0-9]{7,15}\\[a-z]+[0-9a-f]{6}$`)},
+		{EntityUser, "jsmith@acme.com", regexp.MustCompile(`^[a-z]+[0-9a-f]{6}@[a-z]+-[0-9a-f]{6}\.com$`)},
+		{EntityEmail, "j.smith@mail.acme.co.uk", regexp.MustCompile(`^[a-z]+[0-9a-f]{6}@mail\.[a-z]+-[0-9a-f]{6}\.co\.uk$`)},
+		{EntityDomain, "www.acme.com", regexp.MustCompile(`^www\.[a-z]+-[0-9a-f]{6}\.com$`)},
+		{EntityPath, `C:\Users\jsmith\Documents\payroll.xlsx`, regexp.MustCompile(`^C:\\Users\\[a-z]+[0-9a-f]{6}\\Documents\\[a-z]+_[a-z]+\.xlsx$`)},
+		{EntityPath, "/home/jsmith/.ssh/id_rsa", regexp.MustCompile(`^/home/[a-z]+[0-9a-f]{6}/[a-z]+_[a-z]+/[a-z]+_[a-z]+$`)},
+	}
+	for _, tt := range tests {
+		got, err := p.Value(tt.entity, tt.value)
+		if err != nil {
+			t.Fatalf("Value(%s, %q): %v", tt.entity, tt.value, err)
+		}
+		if got == tt.value || !tt.shape.MatchString(got) {
+			t.Errorf("Value(%s, %q) = %q, want a fake matching %s", tt.entity, tt.value, got, tt.shape)
+		}
+	}
+	if _, err := p.Value("ssn", "x"); err == nil {
+		t.Error("unknown entity type accepted")
+	}
+}
+
+func TestPseudonymizerKeepsWellKnownValues(t *testing.T) {
+	p := newTestPseudonymizer(t, testKey)
+	tests := []struct {
+		entity, value string
+	}{
+		{EntityUser, "SYSTEM"},
+		{EntityUser, `NT AUTHORITY\SYSTEM`},
+		{EntityUser, "-"},
+		{EntityUser, ""},
+		{EntityPath, `C:\Windows\System32`},
+		{EntityIP, "not an address"},
+	}
+	for _, tt := range tests {
+		if got, _ := p.Value(tt.entity, tt.value); got != tt.value {
+			t.Errorf("Value(%s, %q) = %q, want it unchanged", tt.entity, tt.value, got)
+		}
+	}
+}
+
+func TestPseudonymizerIPs(t *testing.T) {
+	p := newTestPseudonymizer(t, testKey)
+	for _, value := range []string{"10.1.2.3", "192.168.0.5", "127.0.0.1", "fd00::1"} {
+		if ip := net.ParseIP(p.IP(value)); ip == nil || !ip.IsPrivate() {
+			t.Errorf("IP(%s) = %s, want a private address", value, p.IP(value))
+		}
+	}
+	for _, value := range []string{"8.8.8.8", "93.184.216.34", "2606:4700::1111"} {
+		ip := net.ParseIP(p.IP(value))
+		if ip == nil || ip.IsPrivate() || ip.IsLoopback() || (ip.To4() == nil) != (net.ParseIP(value).To4() == nil) {
+			t.Errorf("IP(%s) = %s, want a public address of the same family", value, p.IP(value))
+		}
+	}
+}
+
+// Distinct values keep distinct fakes, even where the fake space is small
+func TestPseudonymizerAvoidsCollisions(t *testing.T) {
+	p := newTestPseudonymizer(t, testKey)
+	entities := map[string]func(i int) string{
+		EntityIP:       func(i int) string { return net.IPv4(10, byte(i>>16), byte(i>>8), byte(i)).String() },
+		EntityUser:     func(i int) string { return fmt.Sprintf("user%d", i) },
+		EntityHostname: func(i int) string { return fmt.Sprintf("host%d", i) },
+		EntityDomain:   func(i int) string { return fmt.Sprintf("site%d.com", i) },
+	}
+	for entity, value := range entities {
+		fakes := map[string]string{}
+		for i := 0; i < 20000; i++ {
+			fake, _ := p.Value(entity, value(i))
+			if earlier, ok := fakes[fake]; ok {
+				t.Fatalf("%s: %q and %q both became %q", entity, earlier, value(i), fake)
+			}
+			fakes[fake] = value(i)
+		}
+	}
+
+	// A re-drawn address keeps its fake for the rest of the scenario
+	first := p.IP("10.0.0.1")
+	if again := p.IP("10.0.0.1"); again != first {
+		t.Errorf("IP(10.0.0.1) gave %s then %s", first, again)
+	}
+}
+
+// The same value always gets the same fake under one key, whatever its case
+// and wherever it appears, and a different one under another key
+func TestPseudonymizerIsConsistent(t *testing.T) {
+	p, again, other := newTestPseudonymizer(t, testKey), newTestPseudonymizer(t, testKey), newTestPseudonymizer(t, otherTestKey)
+	differs := 0
+	for _, value := range []string{"jsmith", "acme.com", "10.0.0.7", "finance-report"} {
+		for _, entity := range []string{EntityUser, EntityDomain, EntityIP, EntityPath} {
+			a, _ := p.Value(entity, value)
+			b, _ := again.Value(entity, value)
+			if a != b {
+				t.Errorf("Value(%s, %q) gave %q then %q", entity, value, a, b)
+			}
+			if c, _ := other.Value(entity, value); c != a {
+				differs++
+			}
+		}
+	}
+	if differs == 0 {
+		t.Error("different keys gave the same pseudonyms")
+	}
+
+	if p.User("JSmith") != p.User("jsmith") {
+		t.Error("user names are not case-insensitive")
+	}
+	user := p.User("jsmith")
+	if got := p.Path(`C:\Users\jsmith\Desktop`); !strings.Contains(got, `\`+user+`\`) {
+		t.Errorf("profile directory %q does not use the user's pseudonym %q", got, user)
+	}
+	if got := p.Email("jsmith@acme.com"); !strings.HasPrefix(got, user+"@") {
+		t.Errorf("email %q does not use the user's pseudonym %q", got, user)
+	}
+	domain := p.Domain("acme.com")
+	if got := p.Hostname("web01.acme.com"); !strings.HasSuffix(got, "."+domain) {
+		t.Errorf("host %q is not under the domain's pseudonym %q", got, domain)
+	}
+
+	if _, err := NewPseudonymizer([]byte("short")); err == nil {
+		t.Error("short key accepted")
+	}
+}
@@ -0,0 +1,240 @@
+package sanitize
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// ReplaceRule replaces every occurrence of Find in string values with Replace
+type ReplaceRule struct {
+	Find    string `json:"find"`
+	Replace string `json:"replace"`
+}
+
+// SetRule overwrites a field with a fixed value
+type SetRule struct {
+	Field   string `json:"field"`
+	Replace string `json:"replace"`
+}
+
+// Rules is a rule set applied to captured or uploaded events before they are
+// stored. Every field is a path expression; see Path.
+type Rules struct {
+	Replace     []ReplaceRule `json:"replace"`
+	Drop        []string      `json:"drop"`
+	Set         []SetRule     `json:"set"`
+	IPObfuscate []string      `json:"ipObfuscate"`
+	// Pseudonymize, AnonymizeIPs and hash actions need the scenario's key
+	Pseudonymize []PseudonymRule `json:"pseudonymize"`
+	AnonymizeIPs IPAnonymizeRule `json:"anonymizeIPs"`
+	Actions      []FieldAction   `json:"actions"`
+}
+
+// Empty reports whether the rules would leave events unchanged
+func (r Rules) Empty() bool {
+	return len(r.Replace) == 0 && len(r.Drop) == 0 && len(r.Set) == 0 && len(r.IPObfuscate) == 0 &&
+		len(r.Pseudonymize) == 0 && r.AnonymizeIPs.Empty() && len(r.Actions) == 0
+}
+
+// NeedsKey reports whether the rules pseudonymize, anonymize or hash anything, and so need a key
+func (r Rules) NeedsKey() bool {
+	if len(r.Pseudonymize) > 0 || !r.AnonymizeIPs.Empty() {
+		return true
+	}
+	for _, action := range r.Actions {
+		if action.Action == ActionHash {
+			return true
+		}
+	}
+	return false
+}
+
+// step is one compiled rule, applied to an event in place
+type step func(event interface{}) interface{}
+
+// Sanitizer applies a validated rule set
+type Sanitizer struct {
+	steps []step
+}
+
+// New checks a rule set and prepares it for use. key is the scenario's
+// key and may be nil when the rules don't need one.
+func New(rules Rules, key []byte) (*Sanitizer, error) {
+	s := &Sanitizer{}
+	var pseudo *Pseudonymizer
+	var anon *IPAnonymizer
+	if rules.NeedsKey() {
+		var err error
+		if pseudo, err = NewPseudonymizer(key); err != nil {
+			return nil, err
+		}
+		if anon, err = NewIPAnonymizer(key); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, field := range rules.Drop {
+		p, err := ParsePath(field)
+		if err != nil {
+			return nil, fmt.Errorf("drop rule %d: %v", i, err)
+		}
+		s.steps = append(s.steps, p.Drop)
+	}
+	for i, rule := range rules.Set {
+		p, err := ParsePath(rule.Field)
+		if err != nil {
+			return nil, fmt.Errorf("set rule %d: %v", i, err)
+		}
+		value := rule.Replace
+		s.steps = append(s.steps, func(event interface{}) interface{} { return p.Set(event, value) })
+	}
+	for i, field := range rules.IPObfuscate {
+		p, err := ParsePath(field)
+		if err != nil {
+			return nil, fmt.Errorf("ipObfuscate rule %d: %v", i, err)
+		}
+		s.steps = append(s.steps, stringStep(p, ObfuscateIP))
+	}
+	for i, rule := range rules.Pseudonymize {
+		p, err := ParsePath(rule.Field)
+		if err != nil {
+			return nil, fmt.Errorf("pseudonymize rule %d: %v", i, err)
+		}
+		if _, err := pseudo.Value(rule.Type, ""); err != nil {
+			return nil, fmt.Errorf("pseudonymize rule %d: %v", i, err)
+		}
+		entity := rule.Type
+		s.steps = append(s.steps, stringStep(p, func(v string) string {
+			fake, _ := pseudo.Value(entity, v)
+			return fake
+		}))
+	}
+	for i, field := range rules.AnonymizeIPs.Fields {
+		p, err := ParsePath(field)
+		if err != nil {
+			return nil, fmt.Errorf("anonymizeIPs field %d: %v", i, err)
+		}
+		s.steps = append(s.steps, stringStep(p, anon.String))
+	}
+	for i, action := range rules.Actions {
+		st, err := action.compile(key)
+		if err != nil {
+			return nil, fmt.Errorf("action %d: %v", i, err)
+		}
+		s.steps = append(s.steps, st)
+	}
+	if rules.AnonymizeIPs.All {
+		s.steps = append(s.steps, func(event interface{}) interface{} { return mapStrings(event, anon.Text) })
+	}
+	for i, rule := range rules.Replace {
+		if rule.Find == "" {
+			return nil, fmt.Errorf("replace rule %d has an empty find", i)
+		}
+		re := regexp.MustCompile(regexp.QuoteMeta(rule.Find))
+		replace := rule.Replace
+		s.steps = append(s.steps, func(event interface{}) interface{} { return replaceStrings(event, re, replace) })
+	}
+	return s, nil
+}
+
+// stringStep applies fn to every string the path matches, including strings
+// inside matched lists and objects
+func stringStep(p Path, fn func(string) string) step {
+	return func(event interface{}) interface{} {
+		return p.Apply(event, func(value interface{}) (interface{}, bool) {
+			return mapStrings(value, fn), true
+		})
+	}
+}
+
+// Events sanitizes a batch of events. The input is left untouched.
+func (s *Sanitizer) Events(events []interface{}) []interface{} {
+	out := make([]interface{}, len(events))
+	for i, event := range events {
+		out[i] = s.Event(event)
+	}
+	return out
+}
+
+// Event returns a sanitized copy of one event
+func (s *Sanitizer) Event(event interface{}) interface{} {
+	out := deepCopy(event)
+	for _, st := range s.steps {
+		out = st(out)
+	}
+	return out
+}
+
+// replaceStrings rewrites every string value in obj in place
+func replaceStrings(obj interface{}, re *regexp.Regexp, replace string) interface{} {
+	return mapStrings(obj, func(v string) string { return re.ReplaceAllLiteralString(v, replace) })
+}
+
+// mapStrings applies fn to every string value in obj, in place
+func mapStrings(obj interface{}, fn func(string) string) interface{} {
+	switch v := obj.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = mapStrings(value, fn)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = mapStrings(item, fn)
+		}
+		return v
+	case string:
+		return fn(v)
+	default:
+		return obj
+	}
+}
+
+// ObfuscateIP masks the host part of RFC1918 addresses as 10.x.x.x style.
+// Other addresses are returned unchanged; use AnonymizeIPs for those.
+func ObfuscateIP(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !addr.Is4() || !addr.IsPrivate() {
+		return ip
+	}
+	parts := strings.Split(addr.String(), ".")
+	return parts[0] + ".x.x.x"
+}
+
+// deepCopy copies decoded JSON so sanitizing never touches the original
+func deepCopy(obj interface{}) interface{} {
+	switch v := obj.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			out[key] = deepCopy(value)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = deepCopy(item)
+		}
+		return out
+	default:
+		return obj
+	}
+}
+
+// Merge returns r followed by other, as one rule set
+func (r Rules) Merge(other Rules) Rules {
+	return Rules{
+		Replace:      append(append([]ReplaceRule{}, r.Replace...), other.Replace...),
+		Drop:         append(append([]string{}, r.Drop...), other.Drop...),
+		Set:          append(append([]SetRule{}, r.Set...), other.Set...),
+		IPObfuscate:  append(append([]string{}, r.IPObfuscate...), other.IPObfuscate...),
+		Pseudonymize: append(append([]PseudonymRule{}, r.Pseudonymize...), other.Pseudonymize...),
+		AnonymizeIPs: IPAnonymizeRule{
+			Fields: append(append([]string{}, r.AnonymizeIPs.Fields...), other.AnonymizeIPs.Fields...),
+			All:    r.AnonymizeIPs.All || other.AnonymizeIPs.All,
+		},
+		Actions: append(append([]FieldAction{}, r.Actions...), other.Actions...),
+	}
+}
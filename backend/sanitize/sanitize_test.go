@@ -0,0 +1,156 @@
+package sanitize
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Drop runs before Set, Set before IPObfuscate, and Replace last over the
+// result, so each step sees what the one before it left
+func TestEventStepOrder(t *testing.T) {
+	s, err := New(Rules{
+		Replace:     []ReplaceRule{{Find: "alice", Replace: "user1"}},
+		Drop:        []string{"password"},
+		Set:         []SetRule{{Field: "password", Replace: "[redacted]"}, {Field: "owner", Replace: "alice"}, {Field: "ip", Replace: "10.1.2.3"}},
+		IPObfuscate: []string{"ip"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := map[string]interface{}{
+		"password": "hunter2",
+		"user":     "alice",
+		"tags":     []interface{}{"alice", 1.0},
+	}
+	got := s.Event(event)
+	want := map[string]interface{}{
+		"password": "[redacted]",
+		"owner":    "user1",
+		"ip":       "10.x.x.x",
+		"user":     "user1",
+		"tags":     []interface{}{"user1", 1.0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Event() = %v, want %v", got, want)
+	}
+	if event["password"] != "hunter2" || event["tags"].([]interface{})[0] != "alice" {
+		t.Errorf("Event() changed its input: %v", event)
+	}
+}
+
+func TestNewRejectsEmptyRules(t *testing.T) {
+	for _, rules := range []Rules{
+		{Replace: []ReplaceRule{{Find: ""}}},
+		{Drop: []string{""}},
+		{Set: []SetRule{{Field: ""}}},
+		{IPObfuscate: []string{""}},
+	} {
+		if _, err := New(rules, nil); err == nil {
+			t.Errorf("New(%+v) accepted an empty rule", rules)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	before := map[string]interface{}{
+		"user":   map[string]interface{}{"name": "alice", "id": 7.0},
+		"secret": "s3cr3t",
+		"tags":   []interface{}{"a", "b"},
+		"hosts":  []interface{}{"x"},
+	}
+	after := map[string]interface{}{
+		"user":   map[string]interface{}{"name": "user1", "id": 7.0},
+		"tags":   []interface{}{"a", "c"},
+		"hosts":  []interface{}{"x", "y"},
+		"marker": true,
+	}
+	want := []Change{
+		{Path: "hosts", Kind: ChangeModified, Before: []interface{}{"x"}, After: []interface{}{"x", "y"}},
+		{Path: "marker", Kind: ChangeAdded, After: true},
+		{Path: "secret", Kind: ChangeRemoved, Before: "s3cr3t"},
+		{Path: "tags[1]", Kind: ChangeModified, Before: "b", After: "c"},
+		{Path: "user.name", Kind: ChangeModified, Before: "alice", After: "user1"},
+	}
+	if got := Diff(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() = %+v, want %+v", got, want)
+	}
+	if got := Diff(before, before); len(got) != 0 {
+		t.Errorf("Diff() of identical events = %+v, want none", got)
+	}
+}
+
+func TestPreview(t *testing.T) {
+	s, err := New(Rules{Drop: []string{"secret"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := []interface{}{
+		map[string]interface{}{"secret": 1.0, "keep": "a"},
+		map[string]interface{}{"keep": "b"},
+		map[string]interface{}{"secret": 3.0},
+	}
+	diffs := s.Preview(events, 2)
+	if len(diffs) != 2 || diffs[1].Index != 1 {
+		t.Fatalf("Preview() returned %d records, want the first 2", len(diffs))
+	}
+	if want := []Change{{Path: "secret", Kind: ChangeRemoved, Before: 1.0}}; !reflect.DeepEqual(diffs[0].Changes, want) {
+		t.Errorf("record 0 changes = %+v, want %+v", diffs[0].Changes, want)
+	}
+	if len(diffs[1].Changes) != 0 {
+		t.Errorf("record 1 changes = %+v, want none", diffs[1].Changes)
+	}
+	if len(s.Preview(events, 0)) != len(events) {
+		t.Error("Preview() with no limit didn't cover every event")
+	}
+}
+
+func TestRulesMerge(t *testing.T) {
+	profile := Rules{
+		Drop:         []string{"user.password"},
+		Pseudonymize: []PseudonymRule{{Field: "user.name", Type: EntityUser}},
+		AnonymizeIPs: IPAnonymizeRule{Fields: []string{"src_ip"}},
+	}
+	inline := Rules{
+		Drop:         []string{"session.token"},
+		Set:          []SetRule{{Field: "host.name", Replace: "redacted"}},
+		AnonymizeIPs: IPAnonymizeRule{Fields: []string{"dst_ip"}, All: true},
+		Actions:      []FieldAction{{Path: "user.email", Action: ActionHash}},
+	}
+	merged := profile.Merge(inline)
+	want := Rules{
+		Replace:      []ReplaceRule{},
+		Drop:         []string{"user.password", "session.token"},
+		Set:          []SetRule{{Field: "host.name", Replace: "redacted"}},
+		IPObfuscate:  []string{},
+		Pseudonymize: []PseudonymRule{{Field: "user.name", Type: EntityUser}},
+		AnonymizeIPs: IPAnonymizeRule{Fields: []string{"src_ip", "dst_ip"}, All: true},
+		Actions:      []FieldAction{{Path: "user.email", Action: ActionHash}},
+	}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("Merge() = %+v, want %+v", merged, want)
+	}
+
+	// The merged rules must not share storage with either input
+	merged.Drop[0] = "changed"
+	merged.AnonymizeIPs.Fields[0] = "changed"
+	if profile.Drop[0] != "user.password" || profile.AnonymizeIPs.Fields[0] != "src_ip" {
+		t.Error("Merge() result aliases the profile's rules")
+	}
+	if !profile.Merge(Rules{}).NeedsKey() || (Rules{}).Merge(Rules{}).NeedsKey() {
+		t.Error("NeedsKey() changed across Merge()")
+	}
+}
+
+// Profile rules run before inline ones, so inline rules see their output
+func TestMergedRulesOrder(t *testing.T) {
+	profile := Rules{Set: []SetRule{{Field: "user", Replace: "profile"}}}
+	inline := Rules{Replace: []ReplaceRule{{Find: "profile", Replace: "inline"}}}
+	s, err := New(profile.Merge(inline), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := s.Event(map[string]interface{}{"user": "alice"})
+	if want := map[string]interface{}{"user": "inline"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Event() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,142 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		spec string
+		ok   bool
+	}{
+		{"* * * * *", true},
+		{"*/15 * * * *", true},
+		{"0 9-17/2 * * 1-5", true},
+		{"5,10,15 0 1,15 * *", true},
+		{"0 0 * * 7", true},
+		{"@daily", true},
+		{" @hourly ", true},
+		{"60 * * * *", false},
+		{"0 24 * * *", false},
+		{"0 0 0 * *", false},
+		{"0 0 32 * *", false},
+		{"0 0 * 13 *", false},
+		{"0 0 * * 8", false},
+		{"5-1 * * * *", false},
+		{"*/0 * * * *", false},
+		{"a * * * *", false},
+		{"1-x * * * *", false},
+		{"* * * *", false},
+		{"* * * * * *", false},
+		{"@never", false},
+	}
+	for _, tt := range tests {
+		_, err := ParseCron(tt.spec)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseCron(%q) error = %v, want ok %v", tt.spec, err, tt.ok)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		name string
+		spec string
+		from string
+		want string // empty when there is no next run
+	}{
+		{"every minute", "* * * * *", "2024-01-01 10:07", "2024-01-01 10:08"},
+		{"strictly after", "0 10 * * *", "2024-01-01 10:00", "2024-01-02 10:00"},
+		{"step", "*/15 * * * *", "2024-01-01 10:07", "2024-01-01 10:15"},
+		{"step from value", "5/20 * * * *", "2024-01-01 10:06", "2024-01-01 10:25"},
+		{"list", "5,10 * * * *", "2024-01-01 10:06", "2024-01-01 10:10"},
+		{"range with step", "0 9-17/2 * * *", "2024-01-01 12:00", "2024-01-01 13:00"},
+		{"range with step ends", "0 9-17/2 * * *", "2024-01-01 17:30", "2024-01-02 09:00"},
+		{"weekdays skip weekend", "30 8 * * 1-5", "2024-01-05 09:00", "2024-01-08 08:30"},
+		{"day of month only", "0 0 13 * *", "2024-01-01 00:00", "2024-01-13 00:00"},
+		{"day of week only", "0 0 * * 5", "2024-01-01 00:00", "2024-01-05 00:00"},
+		{"either day field matches", "0 0 13 * 5", "2024-01-06 00:00", "2024-01-12 00:00"},
+		{"either day field matches dom", "0 0 13 * 5", "2024-01-12 00:00", "2024-01-13 00:00"},
+		{"sunday as 7", "0 0 * * 7", "2024-01-01 00:00", "2024-01-07 00:00"},
+		{"month rollover", "0 0 1 * *", "2024-01-31 23:59", "2024-02-01 00:00"},
+		{"year rollover", "@yearly", "2024-06-01 00:00", "2025-01-01 00:00"},
+		{"leap day", "0 12 29 2 *", "2024-03-01 00:00", "2028-02-29 12:00"},
+		{"impossible date", "0 0 31 2 *", "2024-01-01 00:00", ""},
+	}
+	for _, tt := range tests {
+		expr, err := ParseCron(tt.spec)
+		if err != nil {
+			t.Fatalf("%s: ParseCron(%q): %v", tt.name, tt.spec, err)
+		}
+		got, ok := expr.Next(at(tt.from))
+		if tt.want == "" {
+			if ok {
+				t.Errorf("%s: Next = %v, want none", tt.name, got)
+			}
+			continue
+		}
+		if !ok || !got.Equal(at(tt.want)) {
+			t.Errorf("%s: Next(%s) = %v, %v, want %s", tt.name, tt.from, got, ok, tt.want)
+		}
+	}
+}
+
+func TestCronNextDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04", s, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	// Clocks go forward 2024-03-10 02:00 EST and back 2024-11-03 02:00 EDT
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"skipped time does not run", "30 2 * * *", at("2024-03-10 00:00"), at("2024-03-11 02:30")},
+		{"hour after the gap runs", "0 3 * * *", at("2024-03-10 00:00"), at("2024-03-10 03:00")},
+		{"hourly across the gap", "0 * * * *", at("2024-03-10 01:30"), at("2024-03-10 03:00")},
+		{"repeated time runs first", "30 1 * * *", at("2024-11-03 00:00"), at("2024-11-03 01:30")},
+		{"repeated time runs once", "30 1 * * *", at("2024-11-03 01:30"), at("2024-11-04 01:30")},
+		{"hourly runs in both passes", "0 * * * *", at("2024-11-03 01:00"), at("2024-11-03 01:00").Add(time.Hour)},
+		{"daily keeps wall time", "0 9 * * *", at("2024-11-02 09:00"), at("2024-11-03 09:00")},
+	}
+	// Cuba moves its clocks forward at midnight, so that day has no 00:00
+	havana, err := time.LoadLocation("America/Havana")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests = append(tests, struct {
+		name string
+		spec string
+		from time.Time
+		want time.Time
+	}{"day with no midnight", "0 12 * * *", time.Date(2024, 3, 9, 13, 0, 0, 0, havana), time.Date(2024, 3, 10, 12, 0, 0, 0, havana)})
+
+	for _, tt := range tests {
+		expr, err := ParseCron(tt.spec)
+		if err != nil {
+			t.Fatalf("%s: ParseCron(%q): %v", tt.name, tt.spec, err)
+		}
+		got, ok := expr.Next(tt.from)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("%s: Next(%v) = %v, want %v", tt.name, tt.from, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// misfireGrace is how late a run may still start, e.g. after a restart.
+// Runs missed by more than this are skipped and recorded as missed.
+const misfireGrace = 5 * time.Minute
+
+// pollInterval bounds how long the scheduler sleeps, so schedules changed
+// directly in the store are picked up without an API call
+const pollInterval = time.Minute
+
+// Schedule is a replay that starts by itself, either once or on a cron rule
+type Schedule struct {
+	ID           string `firestore:"id" json:"id"`
+	Name         string `firestore:"name" json:"name"`
+	ScenarioName string `firestore:"scenario_name" json:"scenario_name"`
+	// ProfileID names the profile whose HEC URL and token are used at run
+	// time. Credentials are looked up then, never copied into the schedule.
+	ProfileID    string  `firestore:"profile_id" json:"profile_id"`
+	Speed        float64 `firestore:"speed" json:"speed"`
+	Workers      int     `firestore:"workers" json:"workers"`
+	PartitionKey string  `firestore:"partition_key" json:"partition_key"`
+	// Exactly one of RunAt (one-shot) and Cron is set
+	RunAt    time.Time `firestore:"run_at" json:"run_at,omitempty"`
+	Cron     string    `firestore:"cron" json:"cron,omitempty"`
+	Timezone string    `firestore:"timezone" json:"timezone,omitempty"`
+	Enabled  bool      `firestore:"enabled" json:"enabled"`
+
+	NextRun       time.Time `firestore:"next_run" json:"next_run,omitempty"`
+	LastRun       time.Time `firestore:"last_run" json:"last_run,omitempty"`
+	LastSessionID string    `firestore:"last_session_id" json:"last_session_id,omitempty"`
+	LastError     string    `firestore:"last_error" json:"last_error,omitempty"`
+	CreatedBy     string    `firestore:"created_by" json:"created_by,omitempty"`
+	CreatedAt     time.Time `firestore:"created_at" json:"created_at"`
+	UpdatedAt     time.Time `firestore:"updated_at" json:"updated_at"`
+}
+
+// Validate checks a schedule before it is stored
+func (s Schedule) Validate() error {
+	if s.ScenarioName == "" {
+		return fmt.Errorf("scenario_name is required")
+	}
+	if s.ProfileID == "" {
+		return fmt.Errorf("profile_id is required")
+	}
+	if s.RunAt.IsZero() == (s.Cron == "") {
+		return fmt.Errorf("exactly one of run_at and cron must be set")
+	}
+	if s.Speed < 0 {
+		return fmt.Errorf("speed must not be negative")
+	}
+	if _, err := s.location(); err != nil {
+		return err
+	}
+	if s.Cron != "" {
+		if _, err := ParseCron(s.Cron); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s Schedule) location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", s.Timezone)
+	}
+	return loc, nil
+}
+
+// nextAfter computes the next run strictly after t. A zero time means the
+// schedule will not run again.
+func (s Schedule) nextAfter(t time.Time) time.Time {
+	if s.Cron == "" {
+		if s.LastRun.IsZero() && s.RunAt.After(t.Add(-misfireGrace)) {
+			return s.RunAt
+		}
+		return time.Time{}
+	}
+	expr, err := ParseCron(s.Cron)
+	if err != nil {
+		return time.Time{}
+	}
+	loc, err := s.location()
+	if err != nil {
+		return time.Time{}
+	}
+	next, ok := expr.Next(t.In(loc))
+	if !ok {
+		return time.Time{}
+	}
+	return next
+}
+
+// Missed reports whether a one-shot schedule's time is already too far past
+// for it ever to run
+func (s Schedule) Missed(now time.Time) bool {
+	return s.Cron == "" && !s.RunAt.IsZero() && now.Sub(s.RunAt) > misfireGrace
+}
+
+// ErrChanged is returned by Store.RecordRun when the schedule was edited or
+// deleted since it was listed
+var ErrChanged = errors.New("schedule was changed or deleted")
+
+// Store persists schedules
+type Store interface {
+	List() ([]Schedule, error)
+	Get(id string) (Schedule, error)
+	Save(s Schedule) error
+	Delete(id string) error
+	// RecordRun writes only the run fields (NextRun, LastRun, LastSessionID,
+	// LastError, Enabled and UpdatedAt) of s, and only if the stored schedule
+	// was last updated at seen; otherwise it returns ErrChanged
+	RecordRun(s Schedule, seen time.Time) error
+}
+
+// Launcher starts the replay for a schedule and returns its session ID
+type Launcher func(s Schedule) (string, error)
+
+// Scheduler runs schedules from a Store when they are due
+type Scheduler struct {
+	store  Store
+	launch Launcher
+	wake   chan struct{}
+	mu     sync.Mutex
+}
+
+// New creates a Scheduler; call Run to start it
+func New(store Store, launch Launcher) *Scheduler {
+	return &Scheduler{store: store, launch: launch, wake: make(chan struct{}, 1)}
+}
+
+// Run checks for due schedules until stop is closed
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	for {
+		wait := s.tick(time.Now())
+		timer := time.NewTimer(wait)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-s.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// Wake makes Run re-read the schedules, e.g. after one was changed
+func (s *Scheduler) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// tick launches every due schedule and returns how long to sleep
+func (s *Scheduler) tick(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedules, err := s.store.List()
+	if err != nil {
+		log.Printf("⚠️ Scheduler could not list schedules: %v", err)
+		return pollInterval
+	}
+
+	wait := pollInterval
+	for _, sched := range schedules {
+		if !sched.Enabled {
+			continue
+		}
+		seen := sched.UpdatedAt
+		if sched.NextRun.IsZero() {
+			sched.NextRun = sched.nextAfter(now.Add(-time.Minute))
+			if sched.NextRun.IsZero() {
+				continue
+			}
+		}
+
+		if sched.NextRun.After(now) {
+			if until := sched.NextRun.Sub(now); until < wait {
+				wait = until
+			}
+			continue
+		}
+
+		if now.Sub(sched.NextRun) > misfireGrace {
+			sched.LastError = fmt.Sprintf("missed run at %s", sched.NextRun.Format(time.RFC3339))
+			log.Printf("⚠️ Schedule %s %s", sched.ID, sched.LastError)
+		} else {
+			sched.LastRun = now
+			sessionID, err := s.launch(sched)
+			if err != nil {
+				sched.LastError = err.Error()
+				log.Printf("❌ Schedule %s failed to start: %v", sched.ID, err)
+			} else {
+				sched.LastSessionID = sessionID
+				sched.LastError = ""
+				log.Printf("⏰ Schedule %s started replay session %s", sched.ID, sessionID)
+			}
+		}
+
+		sched.NextRun = sched.nextAfter(now)
+		if sched.NextRun.IsZero() {
+			sched.Enabled = false
+		}
+		sched.UpdatedAt = now
+		// An edit made meanwhile wins; it has already worked out its next run
+		if err := s.store.RecordRun(sched, seen); err != nil {
+			log.Printf("⚠️ Scheduler could not record the run of schedule %s: %v", sched.ID, err)
+		}
+	}
+	return wait
+}
+
+// SortByNextRun orders schedules by their next run; ones that won't run again go last
+func SortByNextRun(schedules []Schedule) {
+	sort.SliceStable(schedules, func(i, j int) bool {
+		a, b := schedules[i].NextRun, schedules[j].NextRun
+		if a.IsZero() || b.IsZero() {
+			return !a.IsZero()
+		}
+		return a.Before(b)
+	})
+}
+
+// Prepare fills in the next run for a new or edited schedule
+func Prepare(sched Schedule, now time.Time) Schedule {
+	sched.UpdatedAt = now
+	if sched.CreatedAt.IsZero() {
+		sched.CreatedAt = now
+	}
+	sched.NextRun = time.Time{}
+	if sched.Enabled {
+		sched.NextRun = sched.nextAfter(now)
+	}
+	return sched
+}
@@ -0,0 +1,167 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// memoryStore keeps schedules in a map, like the Firestore store keeps documents
+type memoryStore struct {
+	schedules map[string]Schedule
+}
+
+func newMemoryStore(schedules ...Schedule) *memoryStore {
+	store := &memoryStore{schedules: map[string]Schedule{}}
+	for _, sched := range schedules {
+		store.schedules[sched.ID] = sched
+	}
+	return store
+}
+
+func (m *memoryStore) List() ([]Schedule, error) {
+	schedules := []Schedule{}
+	for _, sched := range m.schedules {
+		schedules = append(schedules, sched)
+	}
+	return schedules, nil
+}
+
+func (m *memoryStore) Get(id string) (Schedule, error) {
+	sched, ok := m.schedules[id]
+	if !ok {
+		return Schedule{}, errors.New("not found")
+	}
+	return sched, nil
+}
+
+func (m *memoryStore) Save(s Schedule) error {
+	m.schedules[s.ID] = s
+	return nil
+}
+
+func (m *memoryStore) Delete(id string) error {
+	delete(m.schedules, id)
+	return nil
+}
+
+func (m *memoryStore) RecordRun(s Schedule, seen time.Time) error {
+	current, ok := m.schedules[s.ID]
+	if !ok || !current.UpdatedAt.Equal(seen) {
+		return ErrChanged
+	}
+	current.NextRun, current.LastRun = s.NextRun, s.LastRun
+	current.LastSessionID, current.LastError = s.LastSessionID, s.LastError
+	current.Enabled, current.UpdatedAt = s.Enabled, s.UpdatedAt
+	m.schedules[s.ID] = current
+	return nil
+}
+
+func TestTick(t *testing.T) {
+	now := time.Date(2026, 3, 2, 9, 0, 30, 0, time.UTC)
+	tests := []struct {
+		name      string
+		sched     Schedule
+		launchErr error
+		launched  bool
+		want      Schedule
+	}{
+		{
+			name:     "one-shot runs once and is disabled",
+			sched:    Schedule{RunAt: now.Add(-time.Minute), NextRun: now.Add(-time.Minute), Enabled: true},
+			launched: true,
+			want:     Schedule{LastRun: now, LastSessionID: "session-1"},
+		},
+		{
+			name:     "cron runs and moves on",
+			sched:    Schedule{Cron: "0 * * * *", Timezone: "UTC", NextRun: now.Add(-30 * time.Second), Enabled: true},
+			launched: true,
+			want:     Schedule{LastRun: now, LastSessionID: "session-1", NextRun: now.Add(time.Hour - 30*time.Second), Enabled: true},
+		},
+		{
+			name:  "misfire is skipped",
+			sched: Schedule{Cron: "0 * * * *", Timezone: "UTC", NextRun: now.Add(-time.Hour), Enabled: true},
+			want:  Schedule{LastError: "missed run at 2026-03-02T08:00:30Z", NextRun: now.Add(time.Hour - 30*time.Second), Enabled: true},
+		},
+		{
+			name:      "launch failure is recorded",
+			sched:     Schedule{RunAt: now, NextRun: now, Enabled: true, LastSessionID: "earlier"},
+			launchErr: errors.New("profile p1 has no HEC URL or token"),
+			launched:  true,
+			want:      Schedule{LastRun: now, LastSessionID: "earlier", LastError: "profile p1 has no HEC URL or token"},
+		},
+		{
+			name:  "not due yet",
+			sched: Schedule{RunAt: now.Add(time.Minute), NextRun: now.Add(time.Minute), Enabled: true},
+			want:  Schedule{NextRun: now.Add(time.Minute), Enabled: true},
+		},
+		{
+			name:  "disabled",
+			sched: Schedule{RunAt: now, NextRun: now},
+			want:  Schedule{NextRun: now},
+		},
+	}
+	for _, tt := range tests {
+		tt.sched.ID = "s1"
+		store := newMemoryStore(tt.sched)
+		launched := false
+		s := New(store, func(Schedule) (string, error) {
+			launched = true
+			return "session-1", tt.launchErr
+		})
+		s.tick(now)
+
+		got := store.schedules["s1"]
+		if launched != tt.launched || !got.LastRun.Equal(tt.want.LastRun) || !got.NextRun.Equal(tt.want.NextRun) ||
+			got.LastSessionID != tt.want.LastSessionID || got.LastError != tt.want.LastError || got.Enabled != tt.want.Enabled {
+			t.Errorf("%s: launched = %v, got %+v; want launched %v, %+v", tt.name, launched, got, tt.launched, tt.want)
+		}
+	}
+}
+
+// An edit made while a run was launching is kept rather than overwritten
+func TestTickKeepsConcurrentEdit(t *testing.T) {
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	store := newMemoryStore(Schedule{ID: "s1", RunAt: now, NextRun: now, Enabled: true, Name: "before"})
+	s := New(store, func(Schedule) (string, error) {
+		edited := store.schedules["s1"]
+		edited.Name, edited.UpdatedAt = "edited", now.Add(time.Second)
+		store.schedules["s1"] = edited
+		return "session-1", nil
+	})
+	s.tick(now)
+
+	if got := store.schedules["s1"]; got.Name != "edited" || !got.Enabled || got.LastSessionID != "" {
+		t.Errorf("schedule = %+v, want the edit kept", got)
+	}
+}
+
+func TestMissed(t *testing.T) {
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		sched Schedule
+		want  bool
+	}{
+		{Schedule{RunAt: now.Add(-misfireGrace)}, false},
+		{Schedule{RunAt: now.Add(-misfireGrace - time.Second)}, true},
+		{Schedule{RunAt: now.Add(time.Hour)}, false},
+		{Schedule{Cron: "@daily"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.sched.Missed(now); got != tt.want {
+			t.Errorf("Missed() of run_at %s = %v, want %v", tt.sched.RunAt.Format(time.RFC3339), got, tt.want)
+		}
+	}
+}
+
+func TestTickWaitsForNextRun(t *testing.T) {
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	store := newMemoryStore(Schedule{ID: "s1", RunAt: now.Add(20 * time.Second), NextRun: now.Add(20 * time.Second), Enabled: true})
+	s := New(store, func(Schedule) (string, error) { return "", nil })
+	if wait := s.tick(now); wait != 20*time.Second {
+		t.Errorf("tick() wait = %v, want 20s", wait)
+	}
+	if wait := New(newMemoryStore(), nil).tick(now); wait != pollInterval {
+		t.Errorf("tick() with nothing scheduled waits %v, want %v", wait, pollInterval)
+	}
+}